@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	rpcErrorType = reflect.TypeOf((*Error)(nil)).Elem()
+)
+
+// rpcAdaptedHandler is a handler written with idiomatic go signature
+type rpcAdaptedHandler struct {
+	fn interface{}
+}
+
+// Adapt wrap a function with idiomatic go signature, so that it can be
+// mounted as an echo handler. for example:
+//
+//	func(ctx rpc.Context, a int64, b int64) (int64, error)
+//	func(a int64, b int64) int64
+//
+// The Context argument is optional, the arguments must be rpc types, and the
+// results must be (), (error), (T) or (T, error).
+// The signature is checked when the echo is mounted.
+func Adapt(fn interface{}) interface{} {
+	return &rpcAdaptedHandler{fn: fn}
+}
+
+func isAdaptableReturnType(tp reflect.Type) bool {
+	switch tp {
+	case bytesType, arrayType, mapType:
+		return true
+	}
+
+	switch tp.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		return true
+	case reflect.Interface:
+		return tp.NumMethod() == 0
+	default:
+		return false
+	}
+}
+
+func isAdaptableErrorType(tp reflect.Type) bool {
+	return tp == errorType || tp == rpcErrorType
+}
+
+// convertAdaptedReturn convert the value to the type that rpcStream can write
+func convertAdaptedReturn(v reflect.Value) interface{} {
+	switch v.Type() {
+	case bytesType, arrayType, mapType:
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	default:
+		return v.Interface()
+	}
+}
+
+func writeAdaptedError(ctx Context, v reflect.Value) (Return, bool) {
+	if v.IsNil() {
+		return nilReturn, false
+	}
+
+	if err, ok := v.Interface().(Error); ok {
+		return ctx.Error(err), true
+	}
+
+	return ctx.Error(NewErrorBySystemError(v.Interface().(error))), true
+}
+
+// buildAdaptedHandler check the adapted function signature, and build a
+// standard echo handler func(ctx rpc.Context, ...) rpc.Return from it
+func buildAdaptedHandler(
+	adapted *rpcAdaptedHandler,
+	debug string,
+) (interface{}, Error) {
+	if adapted.fn == nil {
+		return nil, NewErrorByDebug(
+			"Echo handler is nil",
+			debug,
+		)
+	}
+
+	fn := reflect.ValueOf(adapted.fn)
+	if fn.Kind() != reflect.Func {
+		return nil, NewErrorByDebug(
+			fmt.Sprintf(
+				"Echo handler must be func(ctx %s, ...) (T, error)",
+				convertTypeToString(contextType),
+			),
+			debug,
+		)
+	}
+
+	fnType := fn.Type()
+	if fnType.IsVariadic() {
+		return nil, NewErrorByDebug(
+			"Echo handler variadic arguments not supported",
+			debug,
+		)
+	}
+
+	// check arguments types
+	hasContext := fnType.NumIn() > 0 && fnType.In(0) == contextType
+	argTypes := []reflect.Type{contextType}
+	for i := 0; i < fnType.NumIn(); i++ {
+		if i == 0 && hasContext {
+			continue
+		}
+		argType := fnType.In(i)
+		switch argType.Kind() {
+		case reflect.Int64, reflect.Uint64, reflect.Float64,
+			reflect.Bool, reflect.String:
+		default:
+			if argType != bytesType && argType != arrayType && argType != mapType {
+				return nil, NewErrorByDebug(
+					fmt.Sprintf(
+						"Echo handler %s argument type <%s> not supported",
+						convertOrdinalToString(1+uint(i)),
+						argType,
+					),
+					debug,
+				)
+			}
+		}
+		argTypes = append(argTypes, argType)
+	}
+
+	// check return types
+	valuePos, errorPos := -1, -1
+	switch fnType.NumOut() {
+	case 0:
+	case 1:
+		if isAdaptableErrorType(fnType.Out(0)) {
+			errorPos = 0
+		} else {
+			valuePos = 0
+		}
+	case 2:
+		if !isAdaptableErrorType(fnType.Out(1)) {
+			return nil, NewErrorByDebug(
+				"Echo handler return type must be (), (error), (T) or (T, error)",
+				debug,
+			)
+		}
+		valuePos, errorPos = 0, 1
+	default:
+		return nil, NewErrorByDebug(
+			"Echo handler return type must be (), (error), (T) or (T, error)",
+			debug,
+		)
+	}
+	if valuePos >= 0 && !isAdaptableReturnType(fnType.Out(valuePos)) {
+		return nil, NewErrorByDebug(
+			fmt.Sprintf(
+				"Echo handler return type <%s> not supported",
+				fnType.Out(valuePos),
+			),
+			debug,
+		)
+	}
+
+	handlerType := reflect.FuncOf(
+		argTypes,
+		[]reflect.Type{returnType},
+		false,
+	)
+
+	return reflect.MakeFunc(
+		handlerType,
+		func(args []reflect.Value) []reflect.Value {
+			ctx := args[0].Interface().(Context)
+			if !hasContext {
+				args = args[1:]
+			}
+
+			rets := fn.Call(args)
+			if errorPos >= 0 {
+				if ret, ok := writeAdaptedError(ctx, rets[errorPos]); ok {
+					return []reflect.Value{reflect.ValueOf(ret)}
+				}
+			}
+
+			if valuePos >= 0 {
+				return []reflect.Value{
+					reflect.ValueOf(ctx.OK(convertAdaptedReturn(rets[valuePos]))),
+				}
+			}
+
+			return []reflect.Value{reflect.ValueOf(ctx.OK(nil))}
+		},
+	).Interface(), nil
+}
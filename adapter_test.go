@@ -0,0 +1,221 @@
+package rpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdapt(t *testing.T) {
+	assert := newAssert(t)
+
+	fn := func(a int64) int64 { return a }
+	adapted, ok := Adapt(fn).(*rpcAdaptedHandler)
+	assert(ok).IsTrue()
+	assert(adapted.fn).IsNotNil()
+}
+
+func TestBuildAdaptedHandler(t *testing.T) {
+	assert := newAssert(t)
+
+	// handler is nil
+	assert(buildAdaptedHandler(&rpcAdaptedHandler{}, "DebugMessage")).
+		Equals(nil, NewErrorByDebug("Echo handler is nil", "DebugMessage"))
+
+	// handler is not func
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: 3},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler must be func(ctx rpc.Context, ...) (T, error)",
+		"DebugMessage",
+	))
+
+	// variadic arguments
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func(a ...interface{}) {}},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler variadic arguments not supported",
+		"DebugMessage",
+	))
+
+	// arguments type error
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func(ctx Context, a int64, b chan bool) {}},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler 3rd argument type <chan bool> not supported",
+		"DebugMessage",
+	))
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func(a int32) {}},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler 1st argument type <int32> not supported",
+		"DebugMessage",
+	))
+
+	// return type error
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func() (bool, bool) { return true, true }},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler return type must be (), (error), (T) or (T, error)",
+		"DebugMessage",
+	))
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func() (bool, bool, error) { return true, true, nil }},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler return type must be (), (error), (T) or (T, error)",
+		"DebugMessage",
+	))
+	assert(buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func() (chan bool, error) { return nil, nil }},
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo handler return type <chan bool> not supported",
+		"DebugMessage",
+	))
+
+	// ok
+	handler, err := buildAdaptedHandler(
+		&rpcAdaptedHandler{fn: func(a int64, b string) (int32, error) {
+			return 0, nil
+		}},
+		"DebugMessage",
+	)
+	assert(err).IsNil()
+	_, ok := handler.(func(Context, int64, string) Return)
+	assert(ok).IsTrue()
+}
+
+func TestAdapt_mount(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService(
+		"user",
+		NewService().Echo("sayHello", true, Adapt(func(b chan bool) {})),
+		"DebugMessage",
+	).GetMessage()).Equals(
+		"Echo handler 1st argument type <chan bool> not supported",
+	)
+
+	assert(processor.AddService(
+		"user",
+		NewService().Echo("add", true, Adapt(func(a int64, b int64) int64 {
+			return a + b
+		})),
+		"DebugMessage",
+	)).IsNil()
+	assert(processor.echosMap["$.user:add"].callString).
+		Equals("$.user:add(rpc.Context, rpc.Int64, rpc.Int64) rpc.Return")
+}
+
+func TestAdapt_eval(t *testing.T) {
+	assert := newAssert(t)
+
+	getStream := func(args ...interface{}) func(_ *rpcProcessor) *rpcStream {
+		return func(_ *rpcProcessor) *rpcStream {
+			stream := newStream()
+			stream.WriteString("$.user:sayHello")
+			stream.WriteUint64(3)
+			stream.WriteString("#")
+			for _, arg := range args {
+				stream.Write(arg)
+			}
+			return stream
+		}
+	}
+
+	// (T, error) with context
+	runWithProcessor(
+		Adapt(func(ctx Context, name string) (string, error) {
+			return "hello " + name, nil
+		}),
+		getStream("world"),
+		func(in *rpcStream, out *rpcStream, success bool) {
+			assert(success).IsTrue()
+			assert(out.ReadBool()).Equals(true, true)
+			assert(out.Read()).Equals("hello world", true)
+			assert(out.CanRead()).IsFalse()
+		},
+	)
+
+	// (T) without context, T is converted
+	runWithProcessor(
+		Adapt(func(a int64, b int64) int32 {
+			return int32(a + b)
+		}),
+		getStream(int64(3), int64(4)),
+		func(in *rpcStream, out *rpcStream, success bool) {
+			assert(success).IsTrue()
+			assert(out.ReadBool()).Equals(true, true)
+			assert(out.Read()).Equals(int64(7), true)
+			assert(out.CanRead()).IsFalse()
+		},
+	)
+
+	// ()
+	runWithProcessor(
+		Adapt(func() {}),
+		getStream(),
+		func(in *rpcStream, out *rpcStream, success bool) {
+			assert(success).IsTrue()
+			assert(out.ReadBool()).Equals(true, true)
+			assert(out.Read()).Equals(nil, true)
+			assert(out.CanRead()).IsFalse()
+		},
+	)
+
+	// system error
+	runWithProcessor(
+		Adapt(func(name string) (string, error) {
+			return "", errors.New("system error")
+		}),
+		getStream("world"),
+		func(in *rpcStream, out *rpcStream, success bool) {
+			assert(success).IsFalse()
+			assert(out.ReadBool()).Equals(false, true)
+			assert(out.Read()).Equals("system error", true)
+			dbgMessage, ok := out.Read()
+			assert(ok).IsTrue()
+			assert(dbgMessage).Contains("$.user:sayHello")
+		},
+	)
+
+	// rpc error
+	runWithProcessor(
+		Adapt(func(name string) error {
+			return NewErrorByDebug("rpc error", "DebugMessage")
+		}),
+		getStream("world"),
+		func(in *rpcStream, out *rpcStream, success bool) {
+			assert(success).IsFalse()
+			assert(out.ReadBool()).Equals(false, true)
+			assert(out.Read()).Equals("rpc error", true)
+			dbgMessage, ok := out.Read()
+			assert(ok).IsTrue()
+			assert(dbgMessage).Contains("DebugMessage")
+		},
+	)
+
+	// arguments not match
+	runWithProcessor(
+		Adapt(func(name string) error {
+			return nil
+		}),
+		getStream(true),
+		func(in *rpcStream, out *rpcStream, success bool) {
+			assert(success).IsFalse()
+			assert(out.ReadBool()).Equals(false, true)
+			assert(out.Read()).Equals(
+				"rpc echo arguments not match\n"+
+					"Called: $.user:sayHello(rpc.Context, rpc.Bool) rpc.Return\n"+
+					"Required: $.user:sayHello(rpc.Context, rpc.String) rpc.Return",
+				true,
+			)
+		},
+	)
+}
@@ -0,0 +1,158 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	// ErrorKindUnauthenticated the connection is not authenticated
+	ErrorKindUnauthenticated = "Unauthenticated"
+)
+
+// Principal is the identity of the authenticated caller
+type Principal struct {
+	Name       string
+	Roles      []string
+	Attributes map[string]string
+	Claims     map[string]interface{} // the token claims, it can be nil
+}
+
+// HasRole report whether the principal has the role
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, v := range p.Roles {
+		if v == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticate the websocket connection before it is upgraded.
+// it can inspect the headers, query tokens or cookies of the request, and
+// returns the principal of the caller, or an error to reject the connection.
+// it returns (nil, nil) to accept the connection without principal, which can
+// login later by the login echo (see WebSocketServer.SetLoginEcho)
+type Authenticator interface {
+	Authenticate(req *http.Request) (*Principal, Error)
+}
+
+// AuthenticatorFunc adapt a function to Authenticator
+type AuthenticatorFunc func(req *http.Request) (*Principal, Error)
+
+// Authenticate call the function
+func (p AuthenticatorFunc) Authenticate(req *http.Request) (*Principal, Error) {
+	return p(req)
+}
+
+// Principal get the principal of the caller connection, it returns nil if
+// the connection is not authenticated
+func (p *rpcContext) Principal() *Principal {
+	if conn := p.getServerConn(); conn != nil {
+		return conn.getPrincipal()
+	}
+	return nil
+}
+
+// SetPrincipal attach the principal to the caller connection, it is used by
+// the login echo. it returns false if the call does not come from a
+// connection
+func (p *rpcContext) SetPrincipal(principal *Principal) bool {
+	if conn := p.getServerConn(); conn != nil {
+		conn.setPrincipal(principal)
+		return true
+	}
+	return false
+}
+
+// SetAuthenticator set the authenticator which is invoked when the websocket
+// connection is upgraded. nil removes the authenticator
+func (p *WebSocketServer) SetAuthenticator(authenticator Authenticator) {
+	p.Lock()
+	p.authenticator = authenticator
+	p.Unlock()
+}
+
+// SetLoginEcho set the echo path which the connection without principal
+// can call, the other calls of the connection are rejected until the login
+// echo sets the principal by ctx.SetPrincipal. "" removes the login echo
+func (p *WebSocketServer) SetLoginEcho(path string) {
+	p.Lock()
+	p.loginEcho = path
+	p.Unlock()
+}
+
+// authenticate authenticate the upgrade request, it returns the principal
+// and whether the request is accepted. the rejected request is responded 401
+func (p *WebSocketServer) authenticate(
+	w http.ResponseWriter,
+	req *http.Request,
+) (*Principal, bool) {
+	principal, err := p.authenticateRequest(req)
+	if err != nil {
+		http.Error(w, err.GetMessage(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return principal, true
+}
+
+// authenticateRequest authenticate the upgrade request of websocket, or the
+// handshake request of the other transports
+func (p *WebSocketServer) authenticateRequest(
+	req *http.Request,
+) (*Principal, Error) {
+	p.Lock()
+	authenticator := p.authenticator
+	p.Unlock()
+
+	if authenticator == nil {
+		return nil, nil
+	}
+
+	principal, err := authenticator.Authenticate(req)
+	if err != nil {
+		p.logger.Warnf(
+			"WebSocketServer: %s is rejected: %s",
+			getRemoteIP(req),
+			err.GetMessage(),
+		)
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+// checkAuthentication check the connection without principal only calls the
+// login echo
+func (p *WebSocketServer) checkAuthentication(
+	serverConn *wsServerConn,
+	stream *rpcStream,
+) Error {
+	p.Lock()
+	loginEcho := p.loginEcho
+	p.Unlock()
+
+	if loginEcho == "" || serverConn.getPrincipal() != nil {
+		return nil
+	}
+
+	readPos := stream.GetReadPos()
+	echoPath, _ := stream.ReadString()
+	stream.SetReadPos(readPos)
+	if echoPath == loginEcho {
+		return nil
+	}
+
+	return NewErrorByKind(
+		ErrorKindUnauthenticated,
+		fmt.Sprintf(
+			"rpc echo %s requires authentication, call %s to login",
+			echoPath,
+			loginEcho,
+		),
+		Map{"path": echoPath, "loginEcho": loginEcho},
+	)
+}
@@ -0,0 +1,148 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrincipal_HasRole(t *testing.T) {
+	assert := newAssert(t)
+
+	assert((*Principal)(nil).HasRole("admin")).IsFalse()
+	principal := &Principal{Name: "tom", Roles: []string{"user", "admin"}}
+	assert(principal.HasRole("admin")).IsTrue()
+	assert(principal.HasRole("root")).IsFalse()
+}
+
+func TestRpcContext_Principal(t *testing.T) {
+	assert := newAssert(t)
+
+	assert((&rpcContext{thread: nil}).Principal()).IsNil()
+	assert((&rpcContext{thread: nil}).SetPrincipal(&Principal{})).IsFalse()
+
+	conn := &testServerConn{}
+	processor := newTestProcessor(nil)
+	processor.getConn = func(connID uint32) rpcServerConn {
+		if connID == 6 {
+			return conn
+		}
+		return nil
+	}
+	assert(processor.AddService("user", NewService().
+		Echo("login", true, func(ctx Context, name string) Return {
+			return ctx.OK(ctx.SetPrincipal(&Principal{Name: name}))
+		}).
+		Echo("whoami", true, func(ctx Context) Return {
+			if principal := ctx.Principal(); principal != nil {
+				return ctx.OK(principal.Name)
+			}
+			return ctx.OK("")
+		}), "")).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	call := func(connID uint32, path string, args ...interface{}) Any {
+		stream := newStream()
+		stream.SetClientConnID(connID)
+		stream.WriteString(path)
+		stream.WriteUint64(3)
+		stream.WriteString("@")
+		for _, arg := range args {
+			stream.Write(arg)
+		}
+		processor.PutStream(stream)
+		ret, _ := parseTestReturnStream(<-processor.retCH)
+		return ret
+	}
+
+	assert(call(6, "$.user:whoami")).Equals("")
+	assert(call(6, "$.user:login", "tom")).Equals(true)
+	assert(call(6, "$.user:whoami")).Equals("tom")
+	assert(call(7, "$.user:login", "tom")).Equals(false)
+	assert(call(7, "$.user:whoami")).Equals("")
+}
+
+func TestWebSocketServer_authenticate(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	req := httptest.NewRequest("GET", "/ws?token=secret", nil)
+
+	// no authenticator
+	assert(server.authenticate(httptest.NewRecorder(), req)).Equals(nil, true)
+
+	server.SetAuthenticator(AuthenticatorFunc(
+		func(req *http.Request) (*Principal, Error) {
+			switch req.URL.Query().Get("token") {
+			case "secret":
+				return &Principal{Name: "tom"}, nil
+			case "":
+				return nil, nil
+			default:
+				return nil, NewError("token is invalid")
+			}
+		},
+	))
+	assert(server.authenticate(httptest.NewRecorder(), req)).
+		Equals(&Principal{Name: "tom"}, true)
+	assert(server.authenticate(
+		httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/ws", nil),
+	)).Equals(nil, true)
+
+	recorder := httptest.NewRecorder()
+	assert(server.authenticate(
+		recorder,
+		httptest.NewRequest("GET", "/ws?token=wrong", nil),
+	)).Equals(nil, false)
+	assert(recorder.Code).Equals(http.StatusUnauthorized)
+	assert(recorder.Body.String()).Equals("token is invalid\n")
+
+	server.SetAuthenticator(nil)
+	assert(server.authenticate(httptest.NewRecorder(), req)).Equals(nil, true)
+}
+
+func TestWebSocketServer_checkAuthentication(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	serverConn := &wsServerConn{id: 1}
+	newEchoStream := func(path string) *rpcStream {
+		stream := newStream()
+		stream.WriteString(path)
+		stream.WriteUint64(3)
+		return stream
+	}
+
+	// no login echo
+	assert(server.checkAuthentication(
+		serverConn,
+		newEchoStream("$.user:sayHello"),
+	)).IsNil()
+
+	server.SetLoginEcho("$.user:login")
+	stream := newEchoStream("$.user:sayHello")
+	err := server.checkAuthentication(serverConn, stream)
+	assert(err.GetKind()).Equals(ErrorKindUnauthenticated)
+	assert(err.GetMessage()).Equals(
+		"rpc echo $.user:sayHello requires authentication, " +
+			"call $.user:login to login",
+	)
+	assert(err.GetDetails()).Equals(Map{
+		"path":      "$.user:sayHello",
+		"loginEcho": "$.user:login",
+	})
+	assert(stream.ReadString()).Equals("$.user:sayHello", true)
+	assert(server.checkAuthentication(
+		serverConn,
+		newEchoStream("$.user:login"),
+	)).IsNil()
+
+	serverConn.setPrincipal(&Principal{Name: "tom"})
+	assert(serverConn.getPrincipal().Name).Equals("tom")
+	assert(server.checkAuthentication(
+		serverConn,
+		newEchoStream("$.user:sayHello"),
+	)).IsNil()
+}
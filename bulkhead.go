@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"fmt"
+)
+
+const (
+	// ErrorKindBusy the call is rejected by the concurrency limit
+	ErrorKindBusy = "Busy"
+)
+
+// rpcBulkhead limit the concurrent calls of the echo or the service
+type rpcBulkhead struct {
+	scope string // the scope of the limit, like "echo $.user:get"
+	limit int    // the max concurrent calls
+	sem   chan bool
+}
+
+func newBulkhead(scope string, limit int) *rpcBulkhead {
+	return &rpcBulkhead{
+		scope: scope,
+		limit: limit,
+		sem:   make(chan bool, limit),
+	}
+}
+
+// EchoMaxConcurrency limit the concurrent calls of the echo. when the limit is
+// reached, the call fails immediately with a Busy error, it does not wait,
+// so that it does not hold the processor thread
+func EchoMaxConcurrency(limit int) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.maxConcurrency = limit
+	}
+}
+
+// MaxConcurrency limit the concurrent calls of all the echos beneath the
+// service (including the child services), see EchoMaxConcurrency
+func (p *rpcService) MaxConcurrency(limit int) Service {
+	p.DoWithLock(func() {
+		p.policy.maxConcurrency = limit
+		p.policy.concurrencyDebug = getStackString(3)
+	})
+	return p
+}
+
+// acquire take a slot of the bulkhead, it returns false if there is no free
+// slot
+func (p *rpcBulkhead) acquire() bool {
+	select {
+	case p.sem <- true:
+		return true
+	default:
+		return false
+	}
+}
+
+// release free the slot taken by acquire
+func (p *rpcBulkhead) release() {
+	<-p.sem
+}
+
+func (p *rpcBulkhead) newBusyError(path string) Error {
+	return NewErrorByKind(
+		ErrorKindBusy,
+		fmt.Sprintf(
+			"rpc echo %s is busy, %s is limited to %d concurrent calls",
+			path,
+			p.scope,
+			p.limit,
+		),
+		Map{
+			"path":  path,
+			"scope": p.scope,
+			"limit": int64(p.limit),
+		},
+	)
+}
+
+// acquireBulkheads take the slots of the service bulkheads and the echo
+// bulkhead, the taken bulkheads are released when the call is finished
+func (p *rpcThread) acquireBulkheads(path string) Error {
+	acquire := func(bulkhead *rpcBulkhead) Error {
+		if !bulkhead.acquire() {
+			p.countRejected()
+			return bulkhead.newBusyError(path)
+		}
+		p.execBulkheads = append(p.execBulkheads, bulkhead)
+		return nil
+	}
+
+	if policy := p.execEchoNode.serviceNode.policy; policy != nil {
+		for _, bulkhead := range policy.bulkheads {
+			if err := acquire(bulkhead); err != nil {
+				return err
+			}
+		}
+	}
+
+	if bulkhead := p.execEchoNode.bulkhead; bulkhead != nil {
+		return acquire(bulkhead)
+	}
+
+	return nil
+}
+
+// releaseBulkheads release the slots taken by acquireBulkheads
+func (p *rpcThread) releaseBulkheads() {
+	for i := len(p.execBulkheads) - 1; i >= 0; i-- {
+		p.execBulkheads[i].release()
+		p.execBulkheads[i] = nil
+	}
+	p.execBulkheads = p.execBulkheads[:0]
+}
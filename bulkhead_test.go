@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRpcBulkhead_acquire(t *testing.T) {
+	assert := newAssert(t)
+
+	bulkhead := newBulkhead("echo $.user:get", 2)
+	assert(bulkhead.acquire()).IsTrue()
+	assert(bulkhead.acquire()).IsTrue()
+
+	// the full bulkhead fails immediately, it does not wait for a free slot
+	start := time.Now()
+	assert(bulkhead.acquire()).IsFalse()
+	assert(time.Since(start) < 10*time.Millisecond).IsTrue()
+
+	bulkhead.release()
+	assert(bulkhead.acquire()).IsTrue()
+}
+
+func TestRpcBulkhead_newBusyError(t *testing.T) {
+	assert := newAssert(t)
+
+	err := newBulkhead("service $.user", 3).newBusyError("$.user:get")
+	assert(err.GetKind()).Equals(ErrorKindBusy)
+	assert(err.GetMessage()).Equals(
+		"rpc echo $.user:get is busy, service $.user is limited to 3 concurrent calls",
+	)
+	assert(err.GetDetails()).Equals(Map{
+		"path":  "$.user:get",
+		"scope": "service $.user",
+		"limit": int64(3),
+	})
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	assert := newAssert(t)
+
+	service := NewService().
+		MaxConcurrency(2).
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoMaxConcurrency(1)).(*rpcService)
+	assert(service.policy.maxConcurrency).Equals(2)
+	assert(service.policy.concurrencyDebug).Contains("bulkhead_test.go")
+	assert(service.echos[0].maxConcurrency).Equals(1)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService("user", NewService().Echo(
+		"get",
+		true,
+		func(ctx Context) Return { return ctx.OK(true) },
+		EchoMaxConcurrency(-1),
+	), "").GetMessage()).Equals("Echo $.user:get max concurrency is illegal")
+	assert(processor.AddService(
+		"user",
+		NewService().MaxConcurrency(0),
+		"",
+	).GetMessage()).Equals("Service $.user max concurrency is illegal")
+	assert(processor.AddService("user", service, "")).IsNil()
+	assert(processor.echosMap["$.user:get"].bulkhead.scope).
+		Equals("echo $.user:get")
+	assert(processor.nodesMap["$.user"].policy.bulkheads[0].scope).
+		Equals("service $.user")
+}
+
+func TestRpcThread_acquireBulkheads(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newTestProcessor(nil)
+	startCH := make(chan bool)
+	finishCH := make(chan bool)
+	assert(processor.AddService(
+		"user",
+		NewService().
+			MaxConcurrency(2).
+			Echo("slow", true, func(ctx Context) Return {
+				startCH <- true
+				<-finishCH
+				return ctx.OK(true)
+			}, EchoMaxConcurrency(1)).
+			Echo("fast", true, func(ctx Context) Return {
+				return ctx.OK(true)
+			}),
+		"",
+	)).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	// put the first call without waiting, so that only the current goroutine
+	// receives the return streams
+	stream := newStream()
+	stream.WriteString("$.user:slow")
+	stream.WriteUint64(3)
+	stream.WriteString("@")
+	processor.PutStream(stream)
+	<-startCH
+
+	_, err := processor.call("$.user:slow")
+	assert(err.GetKind()).Equals(ErrorKindBusy)
+	assert(err.GetDetails()["scope"]).Equals("echo $.user:slow")
+	// the rejected call is not counted as failed
+	assert(processor.echosMap["$.user:slow"].indicator.GetRejected()).
+		Equals(int64(1))
+	assert(atomic.LoadInt64(&processor.echosMap["$.user:slow"].indicator.failed)).
+		Equals(int64(0))
+
+	assert(processor.call("$.user:fast")).Equals(true, nil)
+
+	finishCH <- true
+	assert(parseTestReturnStream(<-processor.retCH)).Equals(true, nil)
+	assert(processor.call("$.user:fast")).Equals(true, nil)
+	assert(len(processor.nodesMap["$.user"].policy.bulkheads[0].sem)).
+		Equals(0)
+	assert(len(processor.echosMap["$.user:slow"].bulkhead.sem)).Equals(0)
+}
@@ -0,0 +1,432 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// The connection is connecting
+	rpcClientRunning = int32(1)
+	rpcClientClosed  = int32(2)
+)
+
+// rpcClientCallback is the pending call, the return stream is sent to ch
+// (nil if timeout). the return is read into its own stream, because the
+// send stream may still be written by doSend
+type rpcClientCallback struct {
+	id        uint32
+	timeNS    int64
+	ch        chan *rpcStream
+	stream    *rpcStream
+	isTimeout int32
+}
+
+// fnClientDial dial the server by the transport, query is the handshake
+// parameters of the connection
+type fnClientDial = func(
+	query url.Values,
+	readSizeLimit int64,
+) (rpcStreamConn, error)
+
+// rpcClient is the client core of the transports, it sends the streams in
+// order, and matches the responses to the callbacks
+type rpcClient struct {
+	status        int32
+	conn          rpcStreamConn
+	seed          uint32
+	serverConn    string
+	sequence      uint32
+	msgTimeoutNS  int64
+	readTimeoutNS int64
+	readSizeLimit int64
+	fnDial        fnClientDial
+	sendChannel   chan *rpcClientCallback
+	sendCurrent   *rpcClientCallback
+	doConnectCH   chan bool
+	doSendCH      chan bool
+	doTimeoutCH   chan bool
+	closeCH       chan bool
+	sync.Map
+	sync.Mutex
+}
+
+func newRPCClient(fnDial fnClientDial) *rpcClient {
+	client := &rpcClient{
+		status:        rpcClientRunning,
+		conn:          nil,
+		seed:          1,
+		serverConn:    "",
+		sequence:      0,
+		msgTimeoutNS:  20 * int64(time.Second),
+		readTimeoutNS: 60 * int64(time.Second),
+		readSizeLimit: 10 * 1024 * 1024,
+		fnDial:        fnDial,
+		sendChannel:   make(chan *rpcClientCallback, 1024),
+		sendCurrent:   nil,
+		doConnectCH:   make(chan bool, 1),
+		doSendCH:      make(chan bool, 1),
+		doTimeoutCH:   make(chan bool, 1),
+		closeCH:       make(chan bool),
+	}
+
+	go client.doConnect()
+	go client.doSend()
+	go client.doTimeout()
+
+	return client
+}
+
+func (p *rpcClient) isRunning() bool {
+	return atomic.LoadInt32(&p.status) == rpcClientRunning
+}
+
+func (p *rpcClient) doConnect() {
+	time.Sleep(30 * time.Millisecond)
+	for p.isRunning() {
+		startConnMS := timeNowMS()
+		p.connect()
+		connMS := timeNowMS() - startConnMS
+		if connMS < 2000 && p.isRunning() {
+			// the wait is interrupted by Close
+			select {
+			case <-p.closeCH:
+			case <-time.After(time.Duration(2000-connMS) * time.Millisecond):
+			}
+		}
+	}
+	p.doConnectCH <- true
+}
+
+func (p *rpcClient) doSend() {
+	for p.isRunning() {
+		if p.sendCurrent == nil {
+			p.sendCurrent = <-p.sendChannel
+		}
+
+		// ignore timeout msg
+		if p.sendCurrent != nil &&
+			atomic.LoadInt32(&p.sendCurrent.isTimeout) != 0 {
+			p.sendCurrent = nil
+			continue
+		}
+
+		// try to send, if success, the program will continue soon
+		if conn := p.getConn(); conn != nil && p.sendCurrent != nil {
+			// the sequence of the stream is the callback id of the last one
+			stream := p.sendCurrent.stream
+			p.Lock()
+			stream.SetClientSequence(p.sequence)
+			p.Unlock()
+
+			err := conn.WriteStream(stream.GetBufferUnsafe())
+			if err == nil {
+				p.Lock()
+				p.sequence = p.sendCurrent.id
+				p.Unlock()
+				p.sendCurrent = nil
+				continue
+			}
+			p.onError(err.Error())
+		}
+
+		// wait if send error
+		if p.isRunning() {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	p.doSendCH <- true
+}
+
+func (p *rpcClient) doTimeout() {
+	for p.isRunning() {
+		nowNS := timeNowNS()
+		msgTimeoutNS := atomic.LoadInt64(&p.msgTimeoutNS)
+		p.Range(func(key, value interface{}) bool {
+			v, ok := value.(*rpcClientCallback)
+			if ok && v != nil {
+				if nowNS-v.timeNS > msgTimeoutNS {
+					atomic.StoreInt32(&v.isTimeout, 1)
+					select {
+					case v.ch <- nil:
+					default:
+					}
+				}
+			}
+			return true
+		})
+		time.Sleep(100 * time.Millisecond)
+	}
+	p.doTimeoutCH <- true
+}
+
+func (p *rpcClient) setConn(conn rpcStreamConn) {
+	p.Lock()
+	p.conn = conn
+	p.Unlock()
+}
+
+func (p *rpcClient) getConn() rpcStreamConn {
+	p.Lock()
+	ret := p.conn
+	p.Unlock()
+	return ret
+}
+
+// onOpenInformation read the connection id, security and sequence which the
+// server sends when the connection is opened
+func (p *rpcClient) onOpenInformation(msg []byte) bool {
+	stream := newStream()
+	defer stream.Release()
+	stream.SetWritePos(0)
+	stream.PutBytes(msg)
+
+	if stream.GetClientCallbackID() != 0 {
+		return false
+	}
+	if name, ok := stream.ReadString(); !ok ||
+		name != "#.connection.openInformation" {
+		return false
+	}
+	id, ok := stream.ReadUint64()
+	if !ok {
+		return false
+	}
+	security, ok := stream.ReadString()
+	if !ok {
+		return false
+	}
+	sequence, ok := stream.ReadUint64()
+	if !ok {
+		return false
+	}
+
+	p.Lock()
+	p.serverConn = fmt.Sprintf("%d-%s", id, security)
+	p.sequence = uint32(sequence)
+	p.Unlock()
+	return true
+}
+
+func (p *rpcClient) connect() {
+	if p.getConn() == nil {
+		p.Lock()
+		query := url.Values{"conn": {p.serverConn}}
+		p.Unlock()
+
+		conn, err := p.fnDial(query, p.readSizeLimit)
+		if err != nil {
+			p.onError(err.Error())
+			return
+		}
+
+		// receive server conn info
+		msg, err := conn.ReadStream(2 * time.Second)
+		if err != nil {
+			p.onError(err.Error())
+		}
+		if err != nil || !p.onOpenInformation(msg) {
+			if err := conn.Close(); err != nil {
+				p.onError(err.Error())
+			}
+			return
+		}
+
+		p.setConn(conn)
+		// the client is closed while dialing, the read loop must not block
+		if !p.isRunning() {
+			_ = conn.Close()
+		}
+		p.onOpen()
+
+		for {
+			msg, err := conn.ReadStream(time.Duration(p.readTimeoutNS))
+			if err != nil {
+				if err != io.EOF {
+					p.onError(err.Error())
+				}
+				break
+			}
+			p.onBinary(msg)
+		}
+
+		if err := conn.Close(); err != nil {
+			p.onError(err.Error())
+		}
+
+		p.onClose()
+		p.setConn(nil)
+	}
+}
+
+func (p *rpcClient) registerCallback() *rpcClientCallback {
+	ret := (*rpcClientCallback)(nil)
+	p.Lock()
+	for {
+		p.seed++
+		if p.seed == math.MaxUint32 {
+			p.seed = 1
+		}
+		if _, ok := p.Load(p.seed); !ok {
+			ret = &rpcClientCallback{
+				id:        p.seed,
+				timeNS:    timeNowNS(),
+				ch:        make(chan *rpcStream, 1),
+				stream:    newStream(),
+				isTimeout: 0,
+			}
+			p.Store(ret.id, ret)
+			break
+		}
+	}
+	p.Unlock()
+	return ret
+}
+
+func (p *rpcClient) unregisterCallback(key uint32) bool {
+	if _, ok := p.Load(key); ok {
+		p.Delete(key)
+		return true
+	}
+	return false
+}
+
+func (p *rpcClient) getCallbackByID(key uint32) *rpcClientCallback {
+	if v, ok := p.Load(key); ok {
+		return v.(*rpcClientCallback)
+	}
+	return nil
+}
+
+// SendMessage ...
+func (p *rpcClient) SendMessage(
+	target string,
+	args ...interface{},
+) (interface{}, Error) {
+	if !p.isRunning() {
+		return nil, NewError("client closed")
+	}
+
+	callback := p.registerCallback()
+	defer p.unregisterCallback(callback.id)
+
+	stream := callback.stream
+	// set client callback id
+	stream.SetClientCallbackID(callback.id)
+	// write target
+	stream.WriteString(target)
+	// write depth
+	stream.WriteUint64(0)
+	// write from
+	stream.WriteString("@")
+
+	for i := 0; i < len(args); i++ {
+		if stream.Write(args[i]) != rpcStreamWriteOK {
+			return nil, NewError("args not supported")
+		}
+	}
+
+	// send to channel
+	p.sendChannel <- callback
+
+	retStream := <-callback.ch
+	if retStream == nil {
+		return nil, NewError("timeout")
+	}
+	defer retStream.Release()
+	return readReturnStream(retStream)
+}
+
+// readReturnStream read the return value or the error from the body of the
+// return stream
+func readReturnStream(stream *rpcStream) (interface{}, Error) {
+	success, ok := stream.ReadBool()
+	if !ok {
+		return nil, NewError("data format error")
+	}
+
+	if !success {
+		message, ok := stream.ReadString()
+		if !ok {
+			return nil, NewError("data format error")
+		}
+		debug, ok := stream.ReadString()
+		if !ok {
+			return nil, NewError("data format error")
+		}
+		if !stream.CanRead() {
+			return nil, NewErrorByDebug(message, debug)
+		}
+		kind, ok := stream.ReadString()
+		if !ok {
+			return nil, NewError("data format error")
+		}
+		details, ok := stream.ReadMap()
+		if !ok {
+			return nil, NewError("data format error")
+		}
+		err := NewErrorByKind(kind, message, details)
+		err.AddDebug(debug)
+		return nil, err
+	}
+
+	if ret, ok := stream.Read(); ok {
+		return ret, nil
+	}
+	return nil, NewError("data format error")
+}
+
+// Close close the client
+func (p *rpcClient) Close() (ret Error) {
+	if atomic.CompareAndSwapInt32(&p.status, rpcClientRunning, rpcClientClosed) {
+		close(p.sendChannel)
+		close(p.closeCH)
+		if conn := p.getConn(); conn != nil {
+			if err := conn.Close(); err != nil {
+				p.onError(err.Error())
+				ret = NewErrorBySystemError(err)
+			}
+		}
+		<-p.doConnectCH
+		<-p.doSendCH
+		<-p.doTimeoutCH
+	} else {
+		ret = NewError("client is not running")
+	}
+	return
+}
+
+func (p *rpcClient) onOpen() {
+	//fmt.Println("client onOpen", conn)
+}
+
+func (p *rpcClient) onError(msg string) {
+	//fmt.Println("client onError", conn, err)
+}
+
+func (p *rpcClient) onClose() {
+	//fmt.Println("client onClose", conn)
+}
+
+func (p *rpcClient) onBinary(bytes []byte) {
+	if len(bytes) > 5 {
+		b := bytes[1:5]
+		clientID := binary.LittleEndian.Uint32(b)
+		if cbItem := p.getCallbackByID(clientID); cbItem != nil {
+			stream := newStream()
+			stream.SetWritePos(0)
+			stream.PutBytes(bytes)
+			select {
+			case cbItem.ch <- stream:
+			default:
+				stream.Release()
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestOpenInformation(callbackID uint32, name string) []byte {
+	stream := newStream()
+	defer stream.Release()
+	stream.SetClientCallbackID(callbackID)
+	stream.WriteString(name)
+	stream.WriteUint64(12)
+	stream.WriteString("security")
+	stream.WriteUint64(34)
+	return append([]byte(nil), stream.GetBufferUnsafe()...)
+}
+
+func TestRpcClient_onOpenInformation(t *testing.T) {
+	assert := newAssert(t)
+
+	client := &rpcClient{}
+	assert(client.onOpenInformation(
+		newTestOpenInformation(1, "#.connection.openInformation"),
+	)).IsFalse()
+	assert(client.onOpenInformation(
+		newTestOpenInformation(0, "#.connection.other"),
+	)).IsFalse()
+	assert(client.serverConn).Equals("")
+
+	assert(client.onOpenInformation(
+		newTestOpenInformation(0, "#.connection.openInformation"),
+	)).IsTrue()
+	assert(client.serverConn).Equals("12-security")
+	assert(client.sequence).Equals(uint32(34))
+}
+
+func TestRpcClient_dialError(t *testing.T) {
+	assert := newAssert(t)
+
+	dialCH := make(chan url.Values, 1)
+	client := newRPCClient(func(
+		query url.Values,
+		readSizeLimit int64,
+	) (rpcStreamConn, error) {
+		select {
+		case dialCH <- query:
+		default:
+		}
+		return nil, errors.New("dial error")
+	})
+	atomic.StoreInt64(&client.msgTimeoutNS, int64(100*time.Millisecond))
+
+	// the first connection has no server conn
+	assert(<-dialCH).Equals(url.Values{"conn": {""}})
+
+	// the call is timeout if the connection is not opened
+	_, err := client.SendMessage("$.user:sayHello", "world")
+	assert(err.GetMessage()).Equals("timeout")
+	assert(client.Close()).IsNil()
+}
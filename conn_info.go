@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+)
+
+// ConnInfo is the information of the caller connection, it is taken from
+// the HTTP upgrade request when the connection is opened or resumed. it
+// should be treated as read only
+type ConnInfo struct {
+	ID         uint32
+	RemoteAddr string
+	Header     http.Header
+	Query      url.Values
+	TLS        *tls.ConnectionState
+	PeerCred   *PeerCred
+}
+
+func newConnInfo(id uint32, req *http.Request) *ConnInfo {
+	ret := &ConnInfo{ID: id}
+	if req != nil {
+		ret.RemoteAddr = req.RemoteAddr
+		ret.Header = req.Header.Clone()
+		if req.URL != nil {
+			ret.Query = req.URL.Query()
+		}
+		ret.TLS = req.TLS
+		ret.PeerCred = getRequestPeerCred(req)
+	}
+	return ret
+}
+
+// ConnInfo get the information of the caller connection. it returns nil if
+// the call does not come from a connection
+func (p *rpcContext) ConnInfo() *ConnInfo {
+	if conn := p.getServerConn(); conn != nil {
+		return conn.getConnInfo()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNewConnInfo(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(newConnInfo(3, nil)).Equals(&ConnInfo{ID: 3})
+
+	reqURL, _ := url.Parse("ws://127.0.0.1/ws?conn=1-abc&token=t1")
+	req := &http.Request{
+		RemoteAddr: "127.0.0.1:5678",
+		Header:     http.Header{"User-Agent": []string{"test"}},
+		URL:        reqURL,
+		TLS:        &tls.ConnectionState{ServerName: "localhost"},
+	}
+	info := newConnInfo(5, req)
+	assert(info.ID).Equals(uint32(5))
+	assert(info.RemoteAddr).Equals("127.0.0.1:5678")
+	assert(info.Header.Get("User-Agent")).Equals("test")
+	assert(info.Query.Get("token")).Equals("t1")
+	assert(info.TLS.ServerName).Equals("localhost")
+	assert(info.PeerCred).IsNil()
+
+	// the header is copied
+	req.Header.Set("User-Agent", "changed")
+	assert(info.Header.Get("User-Agent")).Equals("test")
+
+	// the peer credentials of the Unix domain socket
+	cred := &PeerCred{PID: 3, UID: 1000, GID: 100}
+	assert(newConnInfo(6, withPeerCred(req, cred)).PeerCred).Equals(cred)
+}
+
+func TestRpcContext_ConnInfo(t *testing.T) {
+	assert := newAssert(t)
+
+	assert((&rpcContext{thread: nil}).ConnInfo()).IsNil()
+
+	conn := &testServerConn{connInfo: &ConnInfo{
+		ID:         6,
+		RemoteAddr: "127.0.0.1:5678",
+	}}
+	processor := newTestProcessor(nil)
+	processor.getConn = func(connID uint32) rpcServerConn {
+		if connID == 6 {
+			return conn
+		}
+		return nil
+	}
+	assert(processor.AddService("user", NewService().
+		Echo("addr", true, func(ctx Context) Return {
+			if info := ctx.ConnInfo(); info != nil {
+				return ctx.OK(info.RemoteAddr)
+			}
+			return ctx.OK("")
+		}), "")).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	call := func(connID uint32) Any {
+		stream := newStream()
+		stream.SetClientConnID(connID)
+		stream.WriteString("$.user:addr")
+		stream.WriteUint64(3)
+		stream.WriteString("@")
+		processor.PutStream(stream)
+		ret, _ := parseTestReturnStream(<-processor.retCH)
+		return ret
+	}
+
+	assert(call(6)).Equals("127.0.0.1:5678")
+	assert(call(7)).Equals("")
+}
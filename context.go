@@ -18,7 +18,48 @@ func (p *rpcContext) stop() {
 	atomic.StorePointer(&p.thread, nil)
 }
 
+func (p *rpcContext) getProcessor() *rpcProcessor {
+	if thread := p.getThread(); thread != nil && thread.threadPool != nil {
+		return thread.threadPool.processor
+	}
+	return nil
+}
+
+// getServerConn get the connection which the call comes from, it returns nil
+// if the call does not come from a connection
+func (p *rpcContext) getServerConn() rpcServerConn {
+	if thread := p.getThread(); thread != nil &&
+		thread.inStream != nil &&
+		thread.threadPool != nil &&
+		thread.threadPool.processor != nil &&
+		thread.threadPool.processor.getConn != nil {
+		return thread.threadPool.processor.getConn(
+			thread.inStream.GetClientConnID(),
+		)
+	}
+	return nil
+}
+
+// Session get the session of the caller connection, the values in it are
+// kept between the calls of the connection. it returns nil if the call does
+// not come from a connection
+func (p *rpcContext) Session() Session {
+	if conn := p.getServerConn(); conn != nil {
+		return conn.getSession()
+	}
+	return nil
+}
+
 func (p *rpcContext) writeError(message string, debug string) *rpcReturn {
+	return p.writeErrorWithKind(message, debug, "", nil)
+}
+
+func (p *rpcContext) writeErrorWithKind(
+	message string,
+	debug string,
+	kind string,
+	details Map,
+) *rpcReturn {
 	if thread := p.getThread(); thread != nil {
 		if thread.threadPool != nil &&
 			thread.threadPool.processor != nil &&
@@ -27,16 +68,32 @@ func (p *rpcContext) writeError(message string, debug string) *rpcReturn {
 				NewErrorByDebug(message, debug).Error(),
 			)
 		}
-		execStream := thread.outStream
-		execStream.SetWritePos(17)
-		execStream.WriteBool(false)
-		execStream.WriteString(message)
-		execStream.WriteString(debug)
+		writeStreamError(thread.outStream, message, debug, kind, details)
 		thread.execSuccessful = false
 	}
 	return nilReturn
 }
 
+// writeStreamError write the error return to the body of stream
+func writeStreamError(
+	stream *rpcStream,
+	message string,
+	debug string,
+	kind string,
+	details Map,
+) {
+	stream.SetWritePos(17)
+	stream.WriteBool(false)
+	stream.WriteString(message)
+	stream.WriteString(debug)
+	if kind != "" {
+		stream.WriteString(kind)
+		if stream.WriteMap(details) != rpcStreamWriteOK {
+			stream.WriteNil()
+		}
+	}
+}
+
 // OK get success Return  by value
 func (p *rpcContext) OK(value interface{}) *rpcReturn {
 	if thread := p.getThread(); thread != nil {
@@ -64,7 +121,12 @@ func (p *rpcContext) Error(err Error) *rpcReturn {
 		err.AddDebug(thread.execEchoNode.debugString)
 	}
 
-	return p.writeError(err.GetMessage(), err.GetDebug())
+	return p.writeErrorWithKind(
+		err.GetMessage(),
+		err.GetDebug(),
+		err.GetKind(),
+		err.GetDetails(),
+	)
 }
 
 func (p *rpcContext) Errorf(format string, a ...interface{}) *rpcReturn {
@@ -74,3 +136,14 @@ func (p *rpcContext) Errorf(format string, a ...interface{}) *rpcReturn {
 			getStackString(1),
 		))
 }
+
+// SuggestEchoPath get the mounted echo path which is closest to path, it can
+// be used by the fallback handler to tell the caller "did you mean". it
+// returns "" if there is no similar echo path. the echos which are not
+// exported or which the caller is not authorized to call are not suggested
+func (p *rpcContext) SuggestEchoPath(path string) string {
+	if processor := p.getProcessor(); processor != nil {
+		return processor.getClosestEchoPath(path, p.Principal())
+	}
+	return ""
+}
@@ -151,3 +151,124 @@ func TestRpcContext_Errorf(t *testing.T) {
 	assert(ok).IsTrue()
 	assert(dbgMessage).Contains("TestRpcContext_Errorf")
 }
+
+func TestRpcContext_writeErrorWithKind(t *testing.T) {
+	assert := newAssert(t)
+
+	thread := newThread(nil)
+	thread.stop()
+	ctx := rpcContext{thread: unsafe.Pointer(thread)}
+	assert(ctx.Error(
+		NewErrorByKind("kind", "errorMessage", Map{"key": "value"}),
+	)).IsNil()
+	thread.outStream.SetReadPos(17)
+	assert(thread.outStream.ReadBool()).Equals(false, true)
+	assert(thread.outStream.ReadString()).Equals("errorMessage", true)
+	assert(thread.outStream.ReadString()).Equals("", true)
+	assert(thread.outStream.ReadString()).Equals("kind", true)
+	assert(thread.outStream.ReadMap()).Equals(Map{"key": "value"}, true)
+	assert(thread.outStream.CanRead()).IsFalse()
+
+	// details is not rpc type
+	thread1 := newThread(nil)
+	thread1.stop()
+	ctx1 := rpcContext{thread: unsafe.Pointer(thread1)}
+	ctx1.writeErrorWithKind("errorMessage", "", "kind", Map{"key": make(chan bool)})
+	thread1.outStream.SetReadPos(17)
+	assert(thread1.outStream.ReadBool()).Equals(false, true)
+	assert(thread1.outStream.ReadString()).Equals("errorMessage", true)
+	assert(thread1.outStream.ReadString()).Equals("", true)
+	assert(thread1.outStream.ReadString()).Equals("kind", true)
+	assert(thread1.outStream.ReadNil()).IsTrue()
+	assert(thread1.outStream.CanRead()).IsFalse()
+}
+
+func TestWriteStreamError(t *testing.T) {
+	assert := newAssert(t)
+
+	stream := newStream()
+	stream.WriteString("$.user:sayHello")
+	writeStreamError(stream, "errorMessage", "debug", "", nil)
+	assert(stream.ReadBool()).Equals(false, true)
+	assert(stream.ReadString()).Equals("errorMessage", true)
+	assert(stream.ReadString()).Equals("debug", true)
+	assert(stream.CanRead()).IsFalse()
+
+	stream.SetReadPos(17)
+	writeStreamError(stream, "errorMessage", "", "kind", Map{"key": "value"})
+	assert(stream.ReadBool()).Equals(false, true)
+	assert(stream.ReadString()).Equals("errorMessage", true)
+	assert(stream.ReadString()).Equals("", true)
+	assert(stream.ReadString()).Equals("kind", true)
+	assert(stream.ReadMap()).Equals(Map{"key": "value"}, true)
+	assert(stream.CanRead()).IsFalse()
+}
+
+type testServerConn struct {
+	session   *rpcSession
+	connInfo  *ConnInfo
+	principal *Principal
+}
+
+func (p *testServerConn) getSession() *rpcSession {
+	return p.session
+}
+
+func (p *testServerConn) getConnInfo() *ConnInfo {
+	return p.connInfo
+}
+
+func (p *testServerConn) getPrincipal() *Principal {
+	return p.principal
+}
+
+func (p *testServerConn) setPrincipal(principal *Principal) {
+	p.principal = principal
+}
+
+func TestRpcContext_Session(t *testing.T) {
+	assert := newAssert(t)
+
+	assert((&rpcContext{thread: nil}).Session()).IsNil()
+
+	conn := &testServerConn{session: newSession(16)}
+	processor := newTestProcessor(nil)
+	processor.getConn = func(connID uint32) rpcServerConn {
+		if connID == 6 {
+			return conn
+		}
+		return nil
+	}
+	assert(processor.AddService("user", NewService().
+		Echo("count", true, func(ctx Context) Return {
+			session := ctx.Session()
+			if session == nil {
+				return ctx.OK(int64(-1))
+			}
+			count, _ := session.Get("count")
+			next := int64(1)
+			if v, ok := count.(int64); ok {
+				next = v + 1
+			}
+			session.Set("count", next)
+			return ctx.OK(next)
+		}), "")).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	call := func(connID uint32) Any {
+		stream := newStream()
+		stream.SetClientConnID(connID)
+		stream.WriteString("$.user:count")
+		stream.WriteUint64(3)
+		stream.WriteString("@")
+		processor.PutStream(stream)
+		ret, _ := parseTestReturnStream(<-processor.retCH)
+		return ret
+	}
+
+	assert(call(6)).Equals(int64(1))
+	assert(call(6)).Equals(int64(2))
+	assert(call(7)).Equals(int64(-1))
+	assert(conn.session.Get("count")).Equals(int64(2), true)
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"reflect"
+	"time"
 )
 
 var (
@@ -36,26 +37,90 @@ type fnProcessorCallback = func(
 	success bool,
 )
 
+// rpcServerConn is the server side connection which the stream comes from
+type rpcServerConn interface {
+	getSession() *rpcSession
+	getConnInfo() *ConnInfo
+	getPrincipal() *Principal
+	setPrincipal(principal *Principal)
+}
+
+type fnGetServerConn = func(connID uint32) rpcServerConn
+
+// INetClient is the rpc client over a transport, like WebSocketClient and
+// TCPClient
+type INetClient interface {
+	SendMessage(target string, args ...interface{}) (interface{}, Error)
+	Close() Error
+}
+
 // Error ...
 type Error interface {
 	GetMessage() string
 	GetDebug() string
+	GetKind() string
+	GetDetails() Map
 	AddDebug(debug string)
 	Error() string
 }
 
+// EchoOption config an echo when it is added to a service
+type EchoOption func(echoMeta *rpcEchoMeta)
+
 // Service ...
 type Service interface {
 	Echo(
 		name string,
 		export bool,
 		handler interface{},
+		options ...EchoOption,
+	) Service
+
+	Alias(
+		name string,
+		target string,
+	) Service
+
+	Fallback(
+		handler FallbackHandler,
 	) Service
 
 	AddService(
 		name string,
 		service Service,
 	) Service
+
+	Use(
+		interceptor Interceptor,
+	) Service
+
+	ACL(
+		check ACLChecker,
+	) Service
+
+	Timeout(
+		timeout time.Duration,
+	) Service
+
+	RateLimit(
+		rate float64,
+		burst int,
+	) Service
+
+	MaxConcurrency(
+		limit int,
+	) Service
+
+	RequireRoles(
+		roles ...string,
+	) Service
+}
+
+// EchoMethodMapper is optionally implemented by the struct passed to
+// NewServiceFromStruct. It returns the echo name, whether the echo is export
+// and whether the method is visible as an echo
+type EchoMethodMapper interface {
+	MapEchoMethod(method string) (name string, export bool, visible bool)
 }
 
 // Context ...
@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type rpcArgDoc struct {
+	index uint
+	name  string
+	doc   string
+}
+
+// DescribeEcho set the description of the echo
+func DescribeEcho(description string) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.description = description
+	}
+}
+
+// DescribeArg set the name and the document of the echo argument at index.
+// The index is the position of the argument in the echo handler, the first
+// argument after ctx is 1
+func DescribeArg(index uint, name string, doc string) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.argDocs = append(echoMeta.argDocs, rpcArgDoc{
+			index: index,
+			name:  name,
+			doc:   doc,
+		})
+	}
+}
+
+// DescribeReturn set the document of the echo return value
+func DescribeReturn(doc string) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.returnDoc = doc
+	}
+}
+
+// buildArgDocs check the argument documents, and return the names and the
+// documents indexed by the argument position
+func buildArgDocs(
+	argDocs []rpcArgDoc,
+	argTypes []reflect.Type,
+	debug string,
+) ([]string, []string, Error) {
+	argNames := make([]string, len(argTypes), len(argTypes))
+	argStrings := make([]string, len(argTypes), len(argTypes))
+	for _, item := range argDocs {
+		if item.index < 1 || item.index >= uint(len(argTypes)) {
+			return nil, nil, NewErrorByDebug(
+				fmt.Sprintf(
+					"Echo doc argument index %d is out of range",
+					item.index,
+				),
+				debug,
+			)
+		}
+
+		if item.name != "" {
+			if !echoNameRegex.MatchString(item.name) {
+				return nil, nil, NewErrorByDebug(
+					fmt.Sprintf("Echo argument name %s is illegal", item.name),
+					debug,
+				)
+			}
+			for i, name := range argNames {
+				if name == item.name && uint(i) != item.index {
+					return nil, nil, NewErrorByDebug(
+						fmt.Sprintf(
+							"Echo argument name %s is duplicated",
+							item.name,
+						),
+						debug,
+					)
+				}
+			}
+		}
+
+		argNames[item.index] = item.name
+		argStrings[item.index] = item.doc
+	}
+
+	return argNames, argStrings, nil
+}
+
+// getArgName get the argument name for messages, if the argument has no
+// name, the ordinal is returned
+func (p *rpcEchoNode) getArgName(index int) string {
+	if index < len(p.argNames) && p.argNames[index] != "" {
+		return p.argNames[index]
+	}
+	return convertOrdinalToString(1 + uint(index))
+}
@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDescribeEcho(t *testing.T) {
+	assert := newAssert(t)
+
+	echoMeta := &rpcEchoMeta{}
+	DescribeEcho("description")(echoMeta)
+	DescribeArg(1, "name", "doc")(echoMeta)
+	DescribeReturn("returnDoc")(echoMeta)
+	assert(echoMeta.description).Equals("description")
+	assert(echoMeta.argDocs).Equals([]rpcArgDoc{{
+		index: 1,
+		name:  "name",
+		doc:   "doc",
+	}})
+	assert(echoMeta.returnDoc).Equals("returnDoc")
+}
+
+func TestBuildArgDocs(t *testing.T) {
+	assert := newAssert(t)
+	argTypes := []reflect.Type{contextType, int64Type, stringType}
+
+	assert(buildArgDocs(nil, argTypes, "DebugMessage")).
+		Equals([]string{"", "", ""}, []string{"", "", ""}, nil)
+
+	assert(buildArgDocs(
+		[]rpcArgDoc{{index: 0, name: "ctx"}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, nil, NewErrorByDebug(
+		"Echo doc argument index 0 is out of range",
+		"DebugMessage",
+	))
+
+	assert(buildArgDocs(
+		[]rpcArgDoc{{index: 1, name: "a-b"}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, nil, NewErrorByDebug(
+		"Echo argument name a-b is illegal",
+		"DebugMessage",
+	))
+
+	assert(buildArgDocs(
+		[]rpcArgDoc{{index: 1, name: "a"}, {index: 2, name: "a"}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, nil, NewErrorByDebug(
+		"Echo argument name a is duplicated",
+		"DebugMessage",
+	))
+
+	assert(buildArgDocs(
+		[]rpcArgDoc{{index: 2, name: "b", doc: "docB"}, {index: 2, name: "b"}},
+		argTypes,
+		"DebugMessage",
+	)).Equals([]string{"", "", "b"}, []string{"", "", ""}, nil)
+}
+
+func TestRpcEchoNode_getArgName(t *testing.T) {
+	assert := newAssert(t)
+
+	node := &rpcEchoNode{argNames: []string{"", "", "age"}}
+	assert(node.getArgName(1)).Equals("2nd")
+	assert(node.getArgName(2)).Equals("age")
+	assert(node.getArgName(3)).Equals("4th")
+}
+
+func TestDescribeArg_mount(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService("user", NewService().Echo(
+		"setAge",
+		true,
+		func(ctx Context, name string, age int64) Return {
+			return ctx.OK(true)
+		},
+		DescribeArg(3, "age", ""),
+	), "").GetMessage()).Equals("Echo doc argument index 3 is out of range")
+
+	assert(processor.AddService("user", NewService().Echo(
+		"setAge",
+		true,
+		func(ctx Context, name string, age int64) Return {
+			return ctx.OK(true)
+		},
+		DescribeArg(2, "age", "the age of user"),
+	), "")).IsNil()
+	assert(processor.echosMap["$.user:setAge"].callString).Equals(
+		"$.user:setAge(rpc.Context, rpc.String, age rpc.Int64) rpc.Return",
+	)
+	assert(processor.echosMap["$.user:setAge"].argDocs).
+		Equals([]string{"", "", "the age of user"})
+}
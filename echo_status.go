@@ -0,0 +1,185 @@
+package rpc
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// EchoStatus is the runtime status of an echo, it can be changed without
+// remounting the echo
+type EchoStatus int32
+
+const (
+	// EchoStatusNormal the echo is called normally
+	EchoStatusNormal EchoStatus = iota
+	// EchoStatusDeprecated the echo is called, but every call is logged with
+	// the caller and counted
+	EchoStatusDeprecated
+	// EchoStatusDisabled the echo returns an error without invoking handler
+	EchoStatusDisabled
+	// EchoStatusMaintenance the echo returns an error with a retry-after hint
+	// without invoking handler
+	EchoStatusMaintenance
+)
+
+const (
+	// ErrorKindEchoDisabled the echo is disabled
+	ErrorKindEchoDisabled = "EchoDisabled"
+	// ErrorKindEchoMaintenance the echo is under maintenance
+	ErrorKindEchoMaintenance = "EchoMaintenance"
+)
+
+var echoStatusNames = []string{
+	"normal",
+	"deprecated",
+	"disabled",
+	"maintenance",
+}
+
+// String get the name of the status
+func (p EchoStatus) String() string {
+	if p >= 0 && int(p) < len(echoStatusNames) {
+		return echoStatusNames[p]
+	}
+	return fmt.Sprintf("EchoStatus(%d)", int32(p))
+}
+
+func parseEchoStatus(name string) (EchoStatus, bool) {
+	for i, statusName := range echoStatusNames {
+		if statusName == name {
+			return EchoStatus(i), true
+		}
+	}
+	return EchoStatusNormal, false
+}
+
+func (p *rpcEchoNode) getStatus() (EchoStatus, time.Duration) {
+	return EchoStatus(atomic.LoadInt32(&p.status)),
+		time.Duration(atomic.LoadInt64(&p.retryAfterNS))
+}
+
+// checkStatus check the echo status before the handler is invoked, it
+// returns the error if the handler should not be invoked
+func (p *rpcEchoNode) checkStatus(logger *Logger, from string) Error {
+	status, retryAfter := p.getStatus()
+	switch status {
+	case EchoStatusDeprecated:
+		atomic.AddInt64(&p.deprecatedCalls, 1)
+		if logger != nil {
+			logger.Warnf(
+				"rpc: deprecated echo %s is called by %s",
+				p.path,
+				from,
+			)
+		}
+		return nil
+	case EchoStatusDisabled:
+		return NewErrorByKind(
+			ErrorKindEchoDisabled,
+			fmt.Sprintf("rpc echo %s is disabled", p.path),
+			Map{"path": p.path},
+		)
+	case EchoStatusMaintenance:
+		retryAfterMS := uint64(retryAfter / time.Millisecond)
+		return NewErrorByKind(
+			ErrorKindEchoMaintenance,
+			fmt.Sprintf(
+				"rpc echo %s is under maintenance, retry after %dms",
+				p.path,
+				retryAfterMS,
+			),
+			Map{"path": p.path, "retryAfterMS": retryAfterMS},
+		)
+	default:
+		return nil
+	}
+}
+
+// setEchoStatus change the status of the echo at runtime, retryAfter is only
+// used by EchoStatusMaintenance
+func (p *rpcProcessor) setEchoStatus(
+	path string,
+	status EchoStatus,
+	retryAfter time.Duration,
+) Error {
+	if status < EchoStatusNormal || status > EchoStatusMaintenance {
+		return NewError(fmt.Sprintf("rpc: echo status %s is illegal", status))
+	}
+
+	echoNode, ok := p.getEchoNode(path)
+	if !ok {
+		return NewError(fmt.Sprintf("rpc: echo path %s is not mounted", path))
+	}
+
+	atomic.StoreInt64(&echoNode.retryAfterNS, int64(retryAfter))
+	atomic.StoreInt32(&echoNode.status, int32(status))
+
+	if p.logger != nil {
+		p.logger.Infof("rpc: echo %s status is set to %s", echoNode.path, status)
+	}
+	return nil
+}
+
+// NewAdminService create a service to manage the echos at runtime. it should
+// be mounted under a protected path, for example:
+//
+//	server.AddService("admin", rpc.NewAdminService())
+func NewAdminService() Service {
+	return NewService().
+		Echo(
+			"setEchoStatus",
+			false,
+			func(
+				ctx Context,
+				path string,
+				status string,
+				retryAfterMS uint64,
+			) Return {
+				processor := ctx.getProcessor()
+				if processor == nil {
+					return ctx.Errorf("rpc: processor is not available")
+				}
+				echoStatus, ok := parseEchoStatus(status)
+				if !ok {
+					return ctx.Errorf("rpc: echo status %s is illegal", status)
+				}
+				if err := processor.setEchoStatus(
+					path,
+					echoStatus,
+					time.Duration(retryAfterMS)*time.Millisecond,
+				); err != nil {
+					return ctx.Error(err)
+				}
+				return ctx.OK(true)
+			},
+			DescribeEcho("change the status of the echo at runtime"),
+			DescribeArg(1, "path", "the echo path"),
+			DescribeArg(2, "status", "normal, deprecated, disabled or maintenance"),
+			DescribeArg(3, "retryAfterMS", "the retry-after hint of maintenance"),
+		).
+		Echo(
+			"getEchoStatus",
+			false,
+			func(ctx Context, path string) Return {
+				processor := ctx.getProcessor()
+				if processor == nil {
+					return ctx.Errorf("rpc: processor is not available")
+				}
+				echoNode, ok := processor.getEchoNode(path)
+				if !ok {
+					return ctx.Errorf("rpc: echo path %s is not mounted", path)
+				}
+				status, retryAfter := echoNode.getStatus()
+				return ctx.OK(Map{
+					"path":            echoNode.path,
+					"status":          status.String(),
+					"retryAfterMS":    uint64(retryAfter / time.Millisecond),
+					"deprecatedCalls": atomic.LoadInt64(&echoNode.deprecatedCalls),
+					"rejectedCalls":   echoNode.indicator.GetRejected(),
+				})
+			},
+			DescribeEcho("get the status of the echo"),
+			DescribeArg(1, "path", "the echo path"),
+		)
+}
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEchoStatus_String(t *testing.T) {
+	assert := newAssert(t)
+	assert(EchoStatusNormal.String()).Equals("normal")
+	assert(EchoStatusDeprecated.String()).Equals("deprecated")
+	assert(EchoStatusDisabled.String()).Equals("disabled")
+	assert(EchoStatusMaintenance.String()).Equals("maintenance")
+	assert(EchoStatus(9).String()).Equals("EchoStatus(9)")
+}
+
+func TestParseEchoStatus(t *testing.T) {
+	assert := newAssert(t)
+	assert(parseEchoStatus("normal")).Equals(EchoStatusNormal, true)
+	assert(parseEchoStatus("maintenance")).Equals(EchoStatusMaintenance, true)
+	assert(parseEchoStatus("unknown")).Equals(EchoStatusNormal, false)
+}
+
+func TestRpcProcessor_setEchoStatus(t *testing.T) {
+	assert := newAssert(t)
+
+	logger := NewLogger()
+	warnCH := make(chan string, 10)
+	logger.Subscribe().Warn = func(msg string) {
+		warnCH <- msg
+	}
+	processor := newTestProcessor(logger)
+	_ = processor.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}), "")
+	processor.Start()
+	defer processor.Stop()
+
+	assert(processor.setEchoStatus("$.user:sayHello", EchoStatus(7), 0)).
+		Equals(NewError("rpc: echo status EchoStatus(7) is illegal"))
+	assert(processor.setEchoStatus("$.user:lost", EchoStatusDisabled, 0)).
+		Equals(NewError("rpc: echo path $.user:lost is not mounted"))
+
+	// deprecated
+	assert(processor.setEchoStatus(
+		"$.user:sayHello",
+		EchoStatusDeprecated,
+		0,
+	)).IsNil()
+	assert(processor.call("$.user:sayHello", "world")).
+		Equals("hello world", nil)
+	assert(<-warnCH).Contains(
+		"rpc: deprecated echo $.user:sayHello is called by @",
+	)
+	assert(processor.echosMap["$.user:sayHello"].deprecatedCalls).
+		Equals(int64(1))
+
+	// disabled
+	assert(processor.setEchoStatus(
+		"$.user:sayHello",
+		EchoStatusDisabled,
+		0,
+	)).IsNil()
+	_, err := processor.call("$.user:sayHello", "world")
+	assert(err.GetMessage()).Equals("rpc echo $.user:sayHello is disabled")
+	assert(err.GetKind()).Equals(ErrorKindEchoDisabled)
+	assert(err.GetDetails()).Equals(Map{"path": "$.user:sayHello"})
+
+	// maintenance
+	assert(processor.setEchoStatus(
+		"$.user:sayHello",
+		EchoStatusMaintenance,
+		3*time.Second,
+	)).IsNil()
+	_, err = processor.call("$.user:sayHello", "world")
+	assert(err.GetMessage()).Equals(
+		"rpc echo $.user:sayHello is under maintenance, retry after 3000ms",
+	)
+	assert(err.GetKind()).Equals(ErrorKindEchoMaintenance)
+	assert(err.GetDetails()).Equals(Map{
+		"path":         "$.user:sayHello",
+		"retryAfterMS": uint64(3000),
+	})
+
+	// normal
+	assert(processor.setEchoStatus(
+		"$.user:sayHello",
+		EchoStatusNormal,
+		0,
+	)).IsNil()
+	assert(processor.call("$.user:sayHello", "world")).
+		Equals("hello world", nil)
+}
+
+func TestNewAdminService(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newTestProcessor(nil)
+	_ = processor.AddService("admin", NewAdminService(), "")
+	_ = processor.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}), "")
+	processor.Start()
+	defer processor.Stop()
+
+	_, err := processor.call(
+		"$.admin:setEchoStatus",
+		"$.user:sayHello",
+		"unknown",
+		uint64(0),
+	)
+	assert(err.GetMessage()).Equals("rpc: echo status unknown is illegal")
+
+	_, err = processor.call(
+		"$.admin:setEchoStatus",
+		"$.user:lost",
+		"disabled",
+		uint64(0),
+	)
+	assert(err.GetMessage()).Equals("rpc: echo path $.user:lost is not mounted")
+
+	assert(processor.call(
+		"$.admin:setEchoStatus",
+		"$.user:sayHello",
+		"maintenance",
+		uint64(1500),
+	)).Equals(true, nil)
+	_, err = processor.call("$.user:sayHello", "world")
+	assert(err.GetKind()).Equals(ErrorKindEchoMaintenance)
+
+	assert(processor.call("$.admin:getEchoStatus", "$.user:sayHello")).
+		Equals(Map{
+			"path":            "$.user:sayHello",
+			"status":          "maintenance",
+			"retryAfterMS":    uint64(1500),
+			"deprecatedCalls": int64(0),
+			"rejectedCalls":   int64(0),
+		}, nil)
+
+	_, err = processor.call("$.admin:getEchoStatus", "$.user:lost")
+	assert(err.GetMessage()).Equals("rpc: echo path $.user:lost is not mounted")
+}
@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	aliasNameRegex = regexp.MustCompile(`^[_a-zA-Z][_0-9a-zA-Z]*(@[1-9][0-9]*)?$`)
+)
+
+type rpcAliasMeta struct {
+	name   string // the name of alias, it can have version like "get@1"
+	target string // the echo name in the same service, or the echo path
+	debug  string // where the alias add in source file
+}
+
+// EchoVersion mount the echo as a version of the echo name, the echo path
+// will be like "$.user:get@2". If the echo name is not mounted without
+// version, "$.user:get" call the default version, which is the version
+// marked by DefaultEchoVersion, or the highest version
+func EchoVersion(version uint) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.version = version
+	}
+}
+
+// DefaultEchoVersion mark the echo version as the default version
+func DefaultEchoVersion() EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.isDefault = true
+	}
+}
+
+func getEchoPath(servicePath string, name string, version uint) string {
+	if version > 0 {
+		return fmt.Sprintf("%s:%s@%d", servicePath, name, version)
+	}
+	return servicePath + ":" + name
+}
+
+// updateDefaultVersion update the default version of the echo name
+func (p *rpcProcessor) updateDefaultVersion(echoNode *rpcEchoNode) Error {
+	echoMeta := echoNode.echoMeta
+	basePath := getEchoPath(echoNode.serviceNode.path, echoMeta.name, 0)
+	current, ok := p.versionsMap[basePath]
+
+	if echoMeta.isDefault {
+		if ok && current.echoMeta.isDefault {
+			return NewErrorByDebug(
+				fmt.Sprintf(
+					"Echo %s default version is duplicated",
+					basePath,
+				),
+				fmt.Sprintf(
+					"Current:\n%s\nConflict:\n%s",
+					addPrefixPerLine(echoMeta.debug, "\t"),
+					addPrefixPerLine(current.echoMeta.debug, "\t"),
+				),
+			)
+		}
+		p.versionsMap[basePath] = echoNode
+	} else if !ok ||
+		(!current.echoMeta.isDefault &&
+			current.echoMeta.version < echoMeta.version) {
+		p.versionsMap[basePath] = echoNode
+	}
+
+	return nil
+}
+
+func (p *rpcProcessor) mountAlias(
+	serviceNode *rpcServiceNode,
+	aliasMeta *rpcAliasMeta,
+) Error {
+	if serviceNode == nil {
+		return NewError("rpc: mountAlias: node is nil")
+	}
+
+	if aliasMeta == nil {
+		return NewError("rpc: mountAlias: aliasMeta is nil")
+	}
+
+	if !aliasNameRegex.MatchString(aliasMeta.name) {
+		return NewErrorByDebug(
+			fmt.Sprintf("Echo alias name %s is illegal", aliasMeta.name),
+			aliasMeta.debug,
+		)
+	}
+
+	if aliasMeta.target == "" {
+		return NewErrorByDebug(
+			fmt.Sprintf("Echo alias %s target is empty", aliasMeta.name),
+			aliasMeta.debug,
+		)
+	}
+
+	aliasPath := serviceNode.path + ":" + aliasMeta.name
+	conflictDebug := ""
+	if item, ok := p.echosMap[aliasPath]; ok {
+		conflictDebug = item.echoMeta.debug
+	} else if item, ok := p.aliasesMap[aliasPath]; ok {
+		conflictDebug = item.debug
+	}
+	if conflictDebug != "" {
+		return NewErrorByDebug(
+			fmt.Sprintf(
+				"Echo alias name %s is duplicated",
+				aliasMeta.name,
+			),
+			fmt.Sprintf(
+				"Current:\n%s\nConflict:\n%s",
+				addPrefixPerLine(aliasMeta.debug, "\t"),
+				addPrefixPerLine(conflictDebug, "\t"),
+			),
+		)
+	}
+
+	targetPath := aliasMeta.target
+	if !strings.HasPrefix(targetPath, rootName) {
+		targetPath = serviceNode.path + ":" + targetPath
+	}
+
+	p.aliasesMap[aliasPath] = &rpcAliasNode{
+		path:       aliasPath,
+		targetPath: targetPath,
+		debug:      aliasMeta.debug,
+	}
+
+	if p.logger != nil {
+		p.logger.Infof("rpc: mounted alias %s -> %s", aliasPath, targetPath)
+	}
+
+	return nil
+}
+
+// checkAliases check the aliases beneath the service path (including the
+// child services) can be resolved to the echos. it is called after the
+// service tree is mounted, so the targets in the same tree can be mounted
+// after the aliases, but the targets in the other services must be added
+// before
+func (p *rpcProcessor) checkAliases(servicePath string) Error {
+	aliasPaths := make([]string, 0)
+	for aliasPath := range p.aliasesMap {
+		if isPathBeneath(aliasPath, servicePath) {
+			aliasPaths = append(aliasPaths, aliasPath)
+		}
+	}
+	sort.Strings(aliasPaths)
+
+	for _, aliasPath := range aliasPaths {
+		if _, ok := p.getEchoNode(aliasPath); !ok {
+			aliasNode := p.aliasesMap[aliasPath]
+			return NewErrorByDebug(
+				fmt.Sprintf(
+					"Echo alias %s target %s is not mounted",
+					aliasPath,
+					aliasNode.targetPath,
+				),
+				aliasNode.debug,
+			)
+		}
+	}
+
+	return nil
+}
+
+// getEchoNode find the echo node by path, the path can be the echo path,
+// the echo name without version, or an alias
+func (p *rpcProcessor) getEchoNode(path string) (*rpcEchoNode, bool) {
+	if alias, ok := p.aliasesMap[path]; ok {
+		path = alias.targetPath
+	}
+
+	if echoNode, ok := p.echosMap[path]; ok {
+		return echoNode, true
+	}
+
+	if echoNode, ok := p.versionsMap[path]; ok {
+		return echoNode, true
+	}
+
+	return nil, false
+}
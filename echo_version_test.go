@@ -0,0 +1,253 @@
+package rpc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEchoVersion(t *testing.T) {
+	assert := newAssert(t)
+
+	echoMeta := &rpcEchoMeta{}
+	EchoVersion(3)(echoMeta)
+	assert(echoMeta.version).Equals(uint(3))
+	assert(echoMeta.isDefault).IsFalse()
+	DefaultEchoVersion()(echoMeta)
+	assert(echoMeta.isDefault).IsTrue()
+}
+
+func TestGetEchoPath(t *testing.T) {
+	assert := newAssert(t)
+	assert(getEchoPath("$.user", "get", 0)).Equals("$.user:get")
+	assert(getEchoPath("$.user", "get", 2)).Equals("$.user:get@2")
+}
+
+func TestRpcProcessor_updateDefaultVersion(t *testing.T) {
+	assert := newAssert(t)
+
+	getService := func(versions ...uint) Service {
+		service := NewService()
+		for _, version := range versions {
+			v := version
+			service.Echo("get", true, func(ctx Context) Return {
+				return ctx.OK(uint64(v))
+			}, EchoVersion(v))
+		}
+		return service
+	}
+
+	// the highest version is the default
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService("user", getService(1, 3, 2), "")).IsNil()
+	assert(processor.echosMap["$.user:get@1"]).IsNotNil()
+	assert(processor.echosMap["$.user:get@2"]).IsNotNil()
+	assert(processor.echosMap["$.user:get@3"]).IsNotNil()
+	assert(processor.versionsMap["$.user:get"]).
+		Equals(processor.echosMap["$.user:get@3"])
+
+	// the marked version is the default
+	processor1 := newRPCProcessor(nil, 16, 16, nil, nil)
+	service1 := getService(1, 3).
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoVersion(2), DefaultEchoVersion())
+	assert(processor1.AddService("user", service1, "")).IsNil()
+	assert(processor1.versionsMap["$.user:get"]).
+		Equals(processor1.echosMap["$.user:get@2"])
+
+	// default version is duplicated
+	processor2 := newRPCProcessor(nil, 16, 16, nil, nil)
+	service2 := NewService().
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoVersion(1), DefaultEchoVersion()).
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoVersion(2), DefaultEchoVersion())
+	assert(processor2.AddService("user", service2, "").GetMessage()).
+		Equals("Echo $.user:get default version is duplicated")
+
+	// version is duplicated
+	processor3 := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor3.AddService("user", getService(1, 1), "").GetMessage()).
+		Equals("Echo name get is duplicated")
+}
+
+func TestRpcProcessor_mountAlias(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	rootNode := processor.nodesMap[rootName]
+
+	assert(processor.mountAlias(nil, nil)).
+		Equals(NewError("rpc: mountAlias: node is nil"))
+	assert(processor.mountAlias(rootNode, nil)).
+		Equals(NewError("rpc: mountAlias: aliasMeta is nil"))
+
+	assert(processor.mountAlias(rootNode, &rpcAliasMeta{
+		name:   "get@0",
+		target: "get",
+		debug:  "DebugMessage",
+	})).Equals(NewErrorByDebug(
+		"Echo alias name get@0 is illegal",
+		"DebugMessage",
+	))
+
+	assert(processor.mountAlias(rootNode, &rpcAliasMeta{
+		name:   "get@1",
+		target: "",
+		debug:  "DebugMessage",
+	})).Equals(NewErrorByDebug(
+		"Echo alias get@1 target is empty",
+		"DebugMessage",
+	))
+
+	_ = processor.mountEcho(rootNode, &rpcEchoMeta{
+		name:    "get",
+		export:  true,
+		handler: func(ctx Context) Return { return ctx.OK(true) },
+		debug:   "DebugMessage",
+	})
+	assert(processor.mountAlias(rootNode, &rpcAliasMeta{
+		name:   "get",
+		target: "$.user:get",
+		debug:  "DebugMessage",
+	})).Equals(NewErrorByDebug(
+		"Echo alias name get is duplicated",
+		"Current:\n\tDebugMessage\nConflict:\n\tDebugMessage",
+	))
+
+	assert(processor.mountAlias(rootNode, &rpcAliasMeta{
+		name:   "get@1",
+		target: "get",
+		debug:  "DebugMessage",
+	})).IsNil()
+	assert(processor.aliasesMap["$:get@1"]).Equals(&rpcAliasNode{
+		path:       "$:get@1",
+		targetPath: "$:get",
+		debug:      "DebugMessage",
+	})
+	assert(processor.mountAlias(rootNode, &rpcAliasMeta{
+		name:   "get@1",
+		target: "get",
+		debug:  "DebugMessage",
+	})).Equals(NewErrorByDebug(
+		"Echo alias name get@1 is duplicated",
+		"Current:\n\tDebugMessage\nConflict:\n\tDebugMessage",
+	))
+
+	// echo path is occupied by alias
+	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
+		name:    "get",
+		export:  true,
+		handler: func(ctx Context) Return { return ctx.OK(true) },
+		debug:   "DebugMessage",
+		version: 1,
+	})).Equals(NewErrorByDebug(
+		"Echo name get is duplicated",
+		"Current:\n\tDebugMessage\nConflict:\n\tDebugMessage",
+	))
+
+	// absolute target
+	assert(processor.mountAlias(rootNode, &rpcAliasMeta{
+		name:   "old",
+		target: "$.user:get@2",
+		debug:  "DebugMessage",
+	})).IsNil()
+	assert(processor.aliasesMap["$:old"].targetPath).Equals("$.user:get@2")
+}
+
+func TestRpcProcessor_getEchoNode(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	service := NewService().
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoVersion(1)).
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoVersion(2)).
+		Echo("find", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}).
+		Alias("getV1", "get@1").
+		Alias("query", "$.user:find")
+	assert(processor.AddService("user", service, "")).IsNil()
+
+	echoNode, ok := processor.getEchoNode("$.user:get@1")
+	assert(echoNode.path, ok).Equals("$.user:get@1", true)
+	echoNode, ok = processor.getEchoNode("$.user:get")
+	assert(echoNode.path, ok).Equals("$.user:get@2", true)
+	echoNode, ok = processor.getEchoNode("$.user:getV1")
+	assert(echoNode.path, ok).Equals("$.user:get@1", true)
+	echoNode, ok = processor.getEchoNode("$.user:query")
+	assert(echoNode.path, ok).Equals("$.user:find", true)
+	assert(processor.getEchoNode("$.user:get@3")).Equals(nil, false)
+}
+
+func TestRpcProcessor_checkAliases(t *testing.T) {
+	assert := newAssert(t)
+
+	handler := func(ctx Context) Return { return ctx.OK(true) }
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService("user", NewService().
+		Echo("get", true, handler, EchoVersion(2)).
+		Alias("fetch", "get").
+		AddService("admin", NewService().
+			Alias("find", "$.user:get@2")),
+		"",
+	)).IsNil()
+	assert(processor.checkAliases("$.user")).IsNil()
+
+	// the target is not mounted, the service is removed
+	newStoreService := func(target string) Service {
+		return NewService().
+			Echo("get", true, handler, EchoVersion(1)).
+			AddService("admin", NewService().
+				Echo("reset", true, handler).
+				Alias("lost", target).
+				Fallback(func(ctx Context, path string, args Array) Return {
+					return ctx.OK(path)
+				}))
+	}
+	err := processor.AddService("store", newStoreService("$.user:lost"), "")
+	assert(err.GetMessage()).
+		Equals("Echo alias $.store.admin:lost target $.user:lost is not mounted")
+	assert(strings.Contains(err.GetDebug(), "echo_version_test.go")).IsTrue()
+	for path := range processor.nodesMap {
+		assert(isPathBeneath(path, "$.store")).IsFalse()
+	}
+	for path := range processor.echosMap {
+		assert(isPathBeneath(path, "$.store")).IsFalse()
+	}
+	for path := range processor.versionsMap {
+		assert(isPathBeneath(path, "$.store")).IsFalse()
+	}
+	for path := range processor.aliasesMap {
+		assert(isPathBeneath(path, "$.store")).IsFalse()
+	}
+	for path := range processor.fallbacksMap {
+		assert(isPathBeneath(path, "$.store")).IsFalse()
+	}
+	assert(processor.getEchoNode("$.store:get")).Equals(nil, false)
+	assert(processor.getEchoNode("$.store.admin:lost")).Equals(nil, false)
+	assert(processor.AddService("store", newStoreService("$.user:get"), "")).
+		IsNil()
+	assert(processor.getEchoNode("$.store.admin:lost")).
+		Equals(processor.echosMap["$.user:get@2"], true)
+
+	// the service which has been mounted is not removed
+	assert(processor.AddService("store", newStoreService("$.user:lost"), "")).
+		IsNotNil()
+	_, ok := processor.getEchoNode("$.store:get")
+	assert(ok).IsTrue()
+
+	// the alias of an alias is not resolved
+	err = processor.AddService("shop", NewService().
+		Alias("get", "$.user:fetch"),
+		"",
+	)
+	assert(err.GetMessage()).
+		Equals("Echo alias $.shop:get target $.user:fetch is not mounted")
+}
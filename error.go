@@ -1,5 +1,10 @@
 package rpc
 
+const (
+	// ErrorKindInvalidArgs the echo arguments break the declared rules
+	ErrorKindInvalidArgs = "InvalidArgs"
+)
+
 // NewError create new error
 func NewError(message string) Error {
 	return &rpcError{
@@ -16,6 +21,17 @@ func NewErrorByDebug(message string, debug string) Error {
 	}
 }
 
+// NewErrorByKind create new structured error, kind is the machine readable
+// category of the error, and details carry the structured information
+func NewErrorByKind(kind string, message string, details Map) Error {
+	return &rpcError{
+		message: message,
+		debug:   "",
+		kind:    kind,
+		details: details,
+	}
+}
+
 // NewErrorBySystemError add debug segment to the error,
 // Note: if err is not Error type, we wrapped it
 func NewErrorBySystemError(err error) Error {
@@ -32,6 +48,8 @@ func NewErrorBySystemError(err error) Error {
 type rpcError struct {
 	message string
 	debug   string
+	kind    string
+	details Map
 }
 
 func (p *rpcError) GetMessage() string {
@@ -42,6 +60,14 @@ func (p *rpcError) GetDebug() string {
 	return p.debug
 }
 
+func (p *rpcError) GetKind() string {
+	return p.kind
+}
+
+func (p *rpcError) GetDetails() Map {
+	return p.details
+}
+
 func (p *rpcError) AddDebug(debug string) {
 	if p.debug != "" {
 		p.debug += "\n"
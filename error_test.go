@@ -80,3 +80,16 @@ func TestRpcError_AddDebug(t *testing.T) {
 	err.AddDebug("m2")
 	assert(err.GetDebug()).Equals("m1\nm2")
 }
+
+func TestNewErrorByKind(t *testing.T) {
+	assert := newAssert(t)
+
+	err := NewErrorByKind(ErrorKindInvalidArgs, "message", Map{"a": int64(1)})
+	assert(err.GetMessage()).Equals("message")
+	assert(err.GetDebug()).Equals("")
+	assert(err.GetKind()).Equals(ErrorKindInvalidArgs)
+	assert(err.GetDetails()).Equals(Map{"a": int64(1)})
+
+	assert(NewError("message").GetKind()).Equals("")
+	assert(NewError("message").GetDetails()).IsNil()
+}
@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FallbackHandler handle the calls to the echo paths which are not mounted
+// under a service. path is the called echo path, and args are the raw
+// arguments of the call
+type FallbackHandler func(ctx Context, path string, args Array) Return
+
+type rpcFallbackMeta struct {
+	handler FallbackHandler // fallback handler
+	debug   string          // where the fallback add in source file
+}
+
+func (p *rpcProcessor) mountFallback(
+	serviceNode *rpcServiceNode,
+	fallbackMeta *rpcFallbackMeta,
+) Error {
+	if serviceNode == nil {
+		return NewError("rpc: mountFallback: node is nil")
+	}
+
+	if fallbackMeta == nil {
+		return NewError("rpc: mountFallback: fallbackMeta is nil")
+	}
+
+	if fallbackMeta.handler == nil {
+		return NewErrorByDebug(
+			"Service fallback handler is nil",
+			fallbackMeta.debug,
+		)
+	}
+
+	fileLine := ""
+	debugArr := findLinesByPrefix(fallbackMeta.debug, "-01")
+	if len(debugArr) > 0 {
+		arr := strings.Split(debugArr[0], " ")
+		if len(arr) == 3 {
+			fileLine = arr[2]
+		}
+	}
+
+	requiredRoles := [][]string(nil)
+	if serviceNode.policy != nil {
+		requiredRoles = serviceNode.policy.requiredRoles
+	}
+
+	fallbackPath := serviceNode.path + ":*"
+	p.fallbacksMap[serviceNode.path] = &rpcEchoNode{
+		serviceNode: serviceNode,
+		path:        fallbackPath,
+		echoMeta: &rpcEchoMeta{
+			name:    "*",
+			handler: fallbackMeta.handler,
+			debug:   fallbackMeta.debug,
+		},
+		handler: fallbackMeta.handler,
+		callString: fmt.Sprintf(
+			"%s(rpc.Context, path rpc.String, args rpc.Array) rpc.Return",
+			fallbackPath,
+		),
+		debugString:   fmt.Sprintf("%s %s", fallbackPath, fileLine),
+		argTypes:      []reflect.Type{contextType, stringType, arrayType},
+		indicator:     newPerformanceIndicator(),
+		requiredRoles: requiredRoles,
+		isFallback:    true,
+	}
+
+	if p.logger != nil {
+		p.logger.Infof("rpc: mounted fallback %s %s", fallbackPath, fileLine)
+	}
+
+	return nil
+}
+
+// getFallbackNode find the fallback of the nearest service which contains
+// the echo path
+func (p *rpcProcessor) getFallbackNode(path string) (*rpcEchoNode, bool) {
+	servicePath := path
+	if idx := strings.LastIndexByte(path, ':'); idx >= 0 {
+		servicePath = path[:idx]
+	}
+
+	for {
+		if echoNode, ok := p.fallbacksMap[servicePath]; ok {
+			return echoNode, true
+		}
+		idx := strings.LastIndexByte(servicePath, '.')
+		if idx < 0 {
+			return nil, false
+		}
+		servicePath = servicePath[:idx]
+	}
+}
+
+// getClosestEchoPath find the mounted echo path or alias which is closest
+// to path, it returns "" if there is no similar one. only the exported echos
+// which the principal is authorized to call are suggested
+func (p *rpcProcessor) getClosestEchoPath(
+	path string,
+	principal *Principal,
+) string {
+	ret := ""
+	minDistance := len(path)/2 + 1
+
+	check := func(candidate string, echoNode *rpcEchoNode) {
+		if !echoNode.echoMeta.export || !echoNode.isAuthorized(principal) {
+			return
+		}
+		distance := getEditDistance(path, candidate)
+		if distance < minDistance ||
+			(distance == minDistance && ret != "" && candidate < ret) {
+			ret = candidate
+			minDistance = distance
+		}
+	}
+
+	for candidate, echoNode := range p.echosMap {
+		check(candidate, echoNode)
+	}
+	for candidate := range p.aliasesMap {
+		if echoNode, ok := p.getEchoNode(candidate); ok {
+			check(candidate, echoNode)
+		}
+	}
+
+	return ret
+}
+
+func (p *rpcThread) evalFallback(ctx Context, echoPath string) Return {
+	args := Array{}
+	for p.inStream.CanRead() {
+		val, ok := p.inStream.Read()
+		if !ok {
+			return ctx.writeError("rpc data format error", "")
+		}
+		args = append(args, val)
+	}
+
+	// echoPath is unsafe string, copy it for the handler
+	return p.execEchoNode.handler.(FallbackHandler)(
+		ctx,
+		string([]byte(echoPath)),
+		args,
+	)
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"testing"
+)
+
+func TestRpcProcessor_mountFallback(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	rootNode := processor.nodesMap[rootName]
+
+	assert(processor.mountFallback(nil, nil)).
+		Equals(NewError("rpc: mountFallback: node is nil"))
+	assert(processor.mountFallback(rootNode, nil)).
+		Equals(NewError("rpc: mountFallback: fallbackMeta is nil"))
+	assert(processor.mountFallback(rootNode, &rpcFallbackMeta{
+		handler: nil,
+		debug:   "DebugMessage",
+	})).Equals(NewErrorByDebug(
+		"Service fallback handler is nil",
+		"DebugMessage",
+	))
+
+	assert(processor.AddService(
+		"user",
+		NewService().Fallback(nil),
+		"",
+	).GetMessage()).Equals("Service fallback handler is nil")
+
+	assert(processor.AddService(
+		"user",
+		NewService().Fallback(func(ctx Context, path string, args Array) Return {
+			return ctx.OK(path)
+		}),
+		"",
+	)).IsNil()
+	assert(processor.fallbacksMap["$.user"].path).Equals("$.user:*")
+	assert(processor.fallbacksMap["$.user"].callString).Equals(
+		"$.user:*(rpc.Context, path rpc.String, args rpc.Array) rpc.Return",
+	)
+	assert(processor.fallbacksMap["$.user"].isFallback).IsTrue()
+}
+
+func TestRpcProcessor_getFallbackNode(t *testing.T) {
+	assert := newAssert(t)
+
+	handler := func(ctx Context, path string, args Array) Return {
+		return ctx.OK(path)
+	}
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService(
+		"user",
+		NewService().
+			Fallback(handler).
+			AddService("profile", NewService()).
+			AddService("admin", NewService().Fallback(handler)),
+		"",
+	)).IsNil()
+
+	echoNode, ok := processor.getFallbackNode("$.user:lost")
+	assert(echoNode.path, ok).Equals("$.user:*", true)
+	echoNode, ok = processor.getFallbackNode("$.user.profile:lost")
+	assert(echoNode.path, ok).Equals("$.user:*", true)
+	echoNode, ok = processor.getFallbackNode("$.user.admin:lost")
+	assert(echoNode.path, ok).Equals("$.user.admin:*", true)
+	echoNode, ok = processor.getFallbackNode("$.user.admin.x.y")
+	assert(echoNode.path, ok).Equals("$.user.admin:*", true)
+	assert(processor.getFallbackNode("$.system:lost")).Equals(nil, false)
+	assert(processor.getFallbackNode("lost")).Equals(nil, false)
+}
+
+func TestRpcProcessor_getClosestEchoPath(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.getClosestEchoPath("$.user:sayHello", nil)).Equals("")
+	assert(processor.AddService(
+		"user",
+		NewService().
+			Echo("sayHello", true, func(ctx Context) Return {
+				return ctx.OK(true)
+			}).
+			Echo("sayGoodbye", true, func(ctx Context) Return {
+				return ctx.OK(true)
+			}).
+			Alias("hello", "sayHello"),
+		"",
+	)).IsNil()
+	assert(processor.AddService(
+		"system",
+		NewService().
+			Echo("hidden", false, func(ctx Context) Return {
+				return ctx.OK(true)
+			}).
+			Echo("resetAll", true, func(ctx Context) Return {
+				return ctx.OK(true)
+			}, EchoRequireRoles("admin")).
+			Alias("reset", "resetAll"),
+		"",
+	)).IsNil()
+
+	assert(processor.getClosestEchoPath("$.user:sayHelo", nil)).
+		Equals("$.user:sayHello")
+	assert(processor.getClosestEchoPath("$.user:sayGoodBye", nil)).
+		Equals("$.user:sayGoodbye")
+	assert(processor.getClosestEchoPath("$.user:helo", nil)).
+		Equals("$.user:hello")
+	assert(processor.getClosestEchoPath("$.system.admin:lost", nil)).
+		Equals("")
+
+	// the echos which are not exported are not suggested
+	assert(processor.getClosestEchoPath("$.system:hiden", nil)).Equals("")
+
+	// the echos which the principal can not call are not suggested
+	admin := &Principal{Name: "tom", Roles: []string{"admin"}}
+	assert(processor.getClosestEchoPath("$.system:resetAl", nil)).Equals("")
+	assert(processor.getClosestEchoPath("$.system:resetAl", admin)).
+		Equals("$.system:resetAll")
+	assert(processor.getClosestEchoPath("$.system:rest", nil)).Equals("")
+	assert(processor.getClosestEchoPath("$.system:rest", admin)).
+		Equals("$.system:reset")
+}
+
+func TestRpcThread_evalFallback(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newTestProcessor(nil)
+	assert(processor.AddService(
+		"user",
+		NewService().
+			Echo("sayHello", true, func(ctx Context, name string) Return {
+				return ctx.OK("hello " + name)
+			}).
+			Fallback(func(ctx Context, path string, args Array) Return {
+				return ctx.Errorf(
+					"%s is not found, did you mean %s? args: %v",
+					path,
+					ctx.SuggestEchoPath(path),
+					args,
+				)
+			}),
+		"",
+	)).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	assert(processor.call("$.user:sayHello", "world")).
+		Equals("hello world", nil)
+
+	_, err := processor.call("$.user:sayHelo", "world", int64(3))
+	assert(err.GetMessage()).Equals(
+		"$.user:sayHelo is not found, did you mean $.user:sayHello? " +
+			"args: [world 3]",
+	)
+	assert(err.GetDebug()).Contains("$.user:*")
+	assert(processor.fallbacksMap["$.user"].indicator.failed).Equals(int64(1))
+
+	_, err = processor.call("$.system:sayHello")
+	assert(err.GetMessage()).
+		Equals("rpc-server: echo path $.system:sayHello is not mounted")
+}
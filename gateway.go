@@ -0,0 +1,456 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ErrorKindNotFound the echo does not exist or is not exported
+	ErrorKindNotFound = "NotFound"
+)
+
+// gatewayStreamConn is the rpcStreamConn of a gateway call, it receives the
+// return stream of the call
+type gatewayStreamConn struct {
+	retCH chan []byte
+}
+
+func (p *gatewayStreamConn) ReadStream(_ time.Duration) ([]byte, error) {
+	return nil, io.EOF
+}
+
+func (p *gatewayStreamConn) WriteStream(buf []byte) error {
+	select {
+	case p.retCH <- append([]byte(nil), buf...):
+	default:
+	}
+	return nil
+}
+
+func (p *gatewayStreamConn) Close() error {
+	return nil
+}
+
+// rpcGateway is the HTTP/JSON gateway of the exported echos
+type rpcGateway struct {
+	server *WebSocketServer
+	prefix string
+}
+
+// GatewayHandler create the HTTP/JSON gateway of the exported echos, it is
+// mounted at prefix like "/rpc/". "POST /rpc/user/profile/get" calls the echo
+// $.user.profile:get, the body is the JSON array of the arguments, and the
+// response is {"result": value} or {"error": {"message", "kind", "details"}}.
+//
+// the JSON values are converted by the echo argument types: the numbers of
+// rpc.Int64, rpc.Uint64 and rpc.Float64 arguments must fit the types, and
+// rpc.Bytes is the base64 string. the numbers in rpc.Array and rpc.Map are
+// rpc.Int64 if they are integers, rpc.Uint64 if they are integers beyond
+// rpc.Int64, and rpc.Float64 otherwise. rpc.Bytes in the return value are
+// base64 strings.
+//
+// the requests must be "Content-Type: application/json", and the Origin
+// header (if any) is checked like the websocket upgrades. the requests are
+// authenticated by the Authenticator, and limited like the connections of
+// the other transports. the WebSocketServer must be opened by Open (or Start)
+func (p *WebSocketServer) GatewayHandler(prefix string) http.Handler {
+	return &rpcGateway{server: p, prefix: prefix}
+}
+
+// getEchoPath map the url path to the echo path
+func (p *rpcGateway) getEchoPath(urlPath string) (string, bool) {
+	if !strings.HasPrefix(urlPath, p.prefix) {
+		return "", false
+	}
+	arr := strings.Split(strings.Trim(urlPath[len(p.prefix):], "/"), "/")
+	for _, name := range arr {
+		if name == "" {
+			return "", false
+		}
+	}
+
+	return getEchoPathByNames(arr), true
+}
+
+// getEchoPathByNames get the echo path by the service names and the echo
+// name, ["user", "profile", "get"] is "$.user.profile:get"
+func getEchoPathByNames(names []string) string {
+	services := append([]string{rootName}, names[:len(names)-1]...)
+	return strings.Join(services, ".") + ":" + names[len(names)-1]
+}
+
+func (p *rpcGateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	server := p.server
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, NewError(
+			fmt.Sprintf("gateway: method %s is not allowed", req.Method),
+		))
+		return
+	}
+
+	if !server.isOpened() {
+		writeGatewayError(
+			w,
+			http.StatusServiceUnavailable,
+			NewError("gateway: server is not opened"),
+		)
+		return
+	}
+
+	if req.Header.Get("Origin") != "" && !server.checkOrigin(req) {
+		writeGatewayError(
+			w,
+			http.StatusForbidden,
+			NewError("gateway: origin is not allowed"),
+		)
+		return
+	}
+
+	if !isJSONRequest(req) {
+		writeGatewayError(
+			w,
+			http.StatusUnsupportedMediaType,
+			NewError("gateway: content type must be application/json"),
+		)
+		return
+	}
+
+	// authenticate before the lookup, so that the echos are not revealed
+	principal, err := server.authenticateRequest(req)
+	if err != nil {
+		writeGatewayError(w, http.StatusUnauthorized, err)
+		return
+	}
+	principal = server.resolvePrincipal(req, principal)
+
+	echoPath, ok := p.getEchoPath(req.URL.Path)
+	echoNode := (*rpcEchoNode)(nil)
+	if ok {
+		echoNode, ok = server.processor.getEchoNode(echoPath)
+	}
+	if !ok || !echoNode.echoMeta.export {
+		writeGatewayError(w, http.StatusNotFound, NewErrorByKind(
+			ErrorKindNotFound,
+			fmt.Sprintf("gateway: echo %s is not found", req.URL.Path),
+			Map{"path": req.URL.Path},
+		))
+		return
+	}
+
+	args, err := decodeGatewayArgs(
+		http.MaxBytesReader(
+			w,
+			req.Body,
+			int64(atomic.LoadUint64(&server.readSizeLimit)),
+		),
+		echoNode,
+	)
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ret, err := server.callByConn(
+		req.Context(),
+		server.newRequestConn(req, principal),
+		getRemoteIP(req),
+		echoNode.path,
+		args,
+	)
+	if err != nil {
+		writeGatewayError(w, getGatewayStatusByKind(err.GetKind()), err)
+		return
+	}
+	writeGatewayJSON(w, http.StatusOK, Map{"result": ret})
+}
+
+// isJSONRequest check the body of the request is declared as JSON. the
+// browsers can not send it across sites without the CORS preflight, unlike
+// the simple requests like text/plain forms
+func isJSONRequest(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// newRequestConn create the unregistered connection of the HTTP request,
+// which has the principal and the information of the request
+func (p *WebSocketServer) newRequestConn(
+	req *http.Request,
+	principal *Principal,
+) *wsServerConn {
+	ret := &wsServerConn{
+		session: newSession(int(atomic.LoadUint64(&p.sessionLimit))),
+	}
+	ret.setConnInfo(req)
+	if principal != nil {
+		ret.setPrincipal(principal)
+	}
+	return ret
+}
+
+// callByConn call the echo on behalf of the owner connection. the call is
+// made by a temporary connection which receives the return, its session,
+// information and principal are the owner's
+func (p *WebSocketServer) callByConn(
+	ctx context.Context,
+	owner *wsServerConn,
+	remoteIP string,
+	echoPath string,
+	args Array,
+) (interface{}, Error) {
+	stream := newStream()
+	stream.SetClientCallbackID(1)
+	stream.WriteString(echoPath)
+	stream.WriteUint64(0)
+	stream.WriteString("@")
+	for _, arg := range args {
+		if stream.Write(arg) != rpcStreamWriteOK {
+			stream.Release()
+			return nil, NewErrorByKind(
+				ErrorKindInvalidArgs,
+				"gateway: args not supported",
+				Map{"path": echoPath},
+			)
+		}
+	}
+
+	err := p.checkAuthentication(owner, stream)
+	if err == nil {
+		err = p.checkRateLimit(owner, remoteIP, stream)
+	}
+	if err != nil {
+		stream.Release()
+		return nil, err
+	}
+
+	streamConn := &gatewayStreamConn{retCH: make(chan []byte, 1)}
+	callConn := p.registerConn(streamConn, 0, "")
+	callConn.setOwner(owner)
+	stream.SetClientConnID(callConn.id)
+	if !p.onStream(callConn, stream) {
+		p.freeConn(callConn)
+		return nil, NewError("gateway: server is not opened")
+	}
+
+	select {
+	case buf := <-streamConn.retCH:
+		p.freeConn(callConn)
+		retStream := newStream()
+		defer retStream.Release()
+		retStream.SetWritePos(0)
+		retStream.PutBytes(buf)
+		return readReturnStream(retStream)
+	case <-ctx.Done():
+		// the call may still return, it is dropped by the freed connection
+		p.freeConn(callConn)
+		return nil, NewError("gateway: request is canceled")
+	}
+}
+
+// decodeGatewayArgs decode the JSON array of the arguments, and convert the
+// values by the argument types of the echo
+func decodeGatewayArgs(body io.Reader, echoNode *rpcEchoNode) (Array, Error) {
+	values := make([]interface{}, 0)
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	err := decoder.Decode(&values)
+	if err == nil {
+		// the data after the array of the arguments is not allowed
+		_, err = decoder.Token()
+	}
+	if err != io.EOF {
+		return nil, NewErrorByKind(
+			ErrorKindInvalidArgs,
+			"gateway: body must be the JSON array of the arguments",
+			Map{"path": echoNode.path},
+		)
+	}
+
+	return convertGatewayArgs(values, echoNode)
+}
+
+// convertGatewayArgs convert the decoded JSON values by the argument types
+// of the echo
+func convertGatewayArgs(
+	values []interface{},
+	echoNode *rpcEchoNode,
+) (Array, Error) {
+	argTypes := echoNode.argTypes[1:]
+	if len(values) != len(argTypes) {
+		return nil, NewErrorByKind(
+			ErrorKindInvalidArgs,
+			fmt.Sprintf(
+				"gateway: echo %s requires %d arguments, but got %d",
+				echoNode.path,
+				len(argTypes),
+				len(values),
+			),
+			Map{"path": echoNode.path},
+		)
+	}
+
+	ret := make(Array, len(values))
+	for i, value := range values {
+		arg, ok := convertJSONValue(value, argTypes[i])
+		if !ok || !isValueMatchArgType(arg, argTypes[i]) {
+			return nil, NewErrorByKind(
+				ErrorKindInvalidArgs,
+				fmt.Sprintf(
+					"gateway: argument %d of echo %s must be %s",
+					i+1,
+					echoNode.path,
+					convertTypeToString(argTypes[i]),
+				),
+				Map{"path": echoNode.path, "index": int64(i + 1)},
+			)
+		}
+		ret[i] = arg
+	}
+	return ret, nil
+}
+
+// convertJSONValue convert the decoded JSON value to the argument type
+func convertJSONValue(value interface{}, argType reflect.Type) (interface{}, bool) {
+	number, isNumber := value.(json.Number)
+
+	switch argType {
+	case int64Type:
+		if !isNumber {
+			return value, true
+		}
+		v, err := number.Int64()
+		return v, err == nil
+	case uint64Type:
+		if !isNumber {
+			return value, true
+		}
+		v, err := strconv.ParseUint(string(number), 10, 64)
+		return v, err == nil
+	case float64Type:
+		if !isNumber {
+			return value, true
+		}
+		v, err := number.Float64()
+		return v, err == nil
+	case bytesType:
+		if s, ok := value.(string); ok {
+			v, err := base64.StdEncoding.DecodeString(s)
+			return v, err == nil
+		} else if value == nil {
+			return Bytes(nil), true
+		}
+		return value, true
+	case arrayType:
+		if value == nil {
+			return Array(nil), true
+		}
+		return convertJSONAny(value)
+	case mapType:
+		if value == nil {
+			return Map(nil), true
+		}
+		return convertJSONAny(value)
+	default:
+		return convertJSONAny(value)
+	}
+}
+
+// convertJSONAny convert the numbers in the decoded JSON value, it returns
+// false if there is a number which can not be converted
+func convertJSONAny(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, true
+		}
+		f, err := v.Float64()
+		return f, err == nil
+	case []interface{}:
+		ret := make(Array, len(v))
+		for i, item := range v {
+			arg, ok := convertJSONAny(item)
+			if !ok {
+				return nil, false
+			}
+			ret[i] = arg
+		}
+		return ret, true
+	case map[string]interface{}:
+		ret := make(Map, len(v))
+		for key, item := range v {
+			arg, ok := convertJSONAny(item)
+			if !ok {
+				return nil, false
+			}
+			ret[key] = arg
+		}
+		return ret, true
+	default:
+		return value, true
+	}
+}
+
+// getGatewayStatusByKind get the HTTP status code of the error kind
+func getGatewayStatusByKind(kind string) int {
+	switch kind {
+	case ErrorKindInvalidArgs:
+		return http.StatusBadRequest
+	case ErrorKindUnauthenticated:
+		return http.StatusUnauthorized
+	case ErrorKindUnauthorized, ErrorKindAccessDenied:
+		return http.StatusForbidden
+	case ErrorKindNotFound:
+		return http.StatusNotFound
+	case ErrorKindRateLimited:
+		return http.StatusTooManyRequests
+	case ErrorKindBusy, ErrorKindEchoDisabled, ErrorKindEchoMaintenance:
+		return http.StatusServiceUnavailable
+	case ErrorKindTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeGatewayJSON(w http.ResponseWriter, status int, body Map) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(Map{"error": Map{
+			"message": "gateway: " + err.Error(),
+			"kind":    "",
+			"details": Map{},
+		}})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeGatewayError(w http.ResponseWriter, status int, err Error) {
+	details := err.GetDetails()
+	if details == nil {
+		details = Map{}
+	}
+	writeGatewayJSON(w, status, Map{"error": Map{
+		"message": err.GetMessage(),
+		"kind":    err.GetKind(),
+		"details": details,
+	}})
+}
@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRpcGateway_getEchoPath(t *testing.T) {
+	assert := newAssert(t)
+
+	gateway := &rpcGateway{prefix: "/rpc/"}
+	assert(gateway.getEchoPath("/rpc/user/profile/get")).
+		Equals("$.user.profile:get", true)
+	assert(gateway.getEchoPath("/rpc/user/sayHello/")).
+		Equals("$.user:sayHello", true)
+	assert(gateway.getEchoPath("/rpc/ping")).Equals("$:ping", true)
+	assert(gateway.getEchoPath("/rpc/")).Equals("", false)
+	assert(gateway.getEchoPath("/rpc/user//get")).Equals("", false)
+	assert(gateway.getEchoPath("/other/user/get")).Equals("", false)
+}
+
+func TestConvertJSONValue(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(convertJSONValue(json.Number("-3"), int64Type)).Equals(int64(-3), true)
+	assert(convertJSONValue(json.Number("1.5"), int64Type)).Equals(int64(0), false)
+	assert(convertJSONValue("3", int64Type)).Equals("3", true)
+	assert(convertJSONValue(json.Number("18446744073709551615"), uint64Type)).
+		Equals(uint64(math.MaxUint64), true)
+	assert(convertJSONValue(json.Number("-1"), uint64Type)).
+		Equals(uint64(0), false)
+	assert(convertJSONValue(true, uint64Type)).Equals(true, true)
+	assert(convertJSONValue(json.Number("3"), float64Type)).Equals(float64(3), true)
+	assert(convertJSONValue("3", float64Type)).Equals("3", true)
+	assert(convertJSONValue("aGVsbG8=", bytesType)).Equals([]byte("hello"), true)
+	assert(convertJSONValue("!", bytesType)).Equals([]byte{}, false)
+	assert(convertJSONValue(nil, bytesType)).Equals(Bytes(nil), true)
+	assert(convertJSONValue(true, bytesType)).Equals(true, true)
+	assert(convertJSONValue(nil, arrayType)).Equals(Array(nil), true)
+	assert(convertJSONValue([]interface{}{json.Number("1")}, arrayType)).
+		Equals(Array{int64(1)}, true)
+	assert(convertJSONValue(nil, mapType)).Equals(Map(nil), true)
+	assert(convertJSONValue(map[string]interface{}{}, mapType)).
+		Equals(Map{}, true)
+	assert(convertJSONValue("hello", stringType)).Equals("hello", true)
+	assert(convertJSONValue(
+		[]interface{}{json.Number("1e400")},
+		arrayType,
+	)).Equals(nil, false)
+}
+
+func TestConvertJSONAny(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(convertJSONAny(json.Number("3"))).Equals(int64(3), true)
+	assert(convertJSONAny(json.Number("18446744073709551615"))).
+		Equals(uint64(math.MaxUint64), true)
+	assert(convertJSONAny(json.Number("1.5"))).Equals(1.5, true)
+	assert(convertJSONAny(json.Number("1e400"))).Equals(math.Inf(1), false)
+	assert(convertJSONAny(map[string]interface{}{
+		"a": []interface{}{json.Number("1"), "s", nil},
+	})).Equals(Map{"a": Array{int64(1), "s", nil}}, true)
+	assert(convertJSONAny(map[string]interface{}{
+		"a": []interface{}{json.Number("1e400")},
+	})).Equals(nil, false)
+	assert(convertJSONAny(true)).Equals(true, true)
+}
+
+func TestGetGatewayStatusByKind(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(getGatewayStatusByKind(ErrorKindInvalidArgs)).
+		Equals(http.StatusBadRequest)
+	assert(getGatewayStatusByKind(ErrorKindUnauthenticated)).
+		Equals(http.StatusUnauthorized)
+	assert(getGatewayStatusByKind(ErrorKindUnauthorized)).
+		Equals(http.StatusForbidden)
+	assert(getGatewayStatusByKind(ErrorKindAccessDenied)).
+		Equals(http.StatusForbidden)
+	assert(getGatewayStatusByKind(ErrorKindNotFound)).
+		Equals(http.StatusNotFound)
+	assert(getGatewayStatusByKind(ErrorKindRateLimited)).
+		Equals(http.StatusTooManyRequests)
+	assert(getGatewayStatusByKind(ErrorKindBusy)).
+		Equals(http.StatusServiceUnavailable)
+	assert(getGatewayStatusByKind(ErrorKindEchoDisabled)).
+		Equals(http.StatusServiceUnavailable)
+	assert(getGatewayStatusByKind(ErrorKindEchoMaintenance)).
+		Equals(http.StatusServiceUnavailable)
+	assert(getGatewayStatusByKind(ErrorKindTimeout)).
+		Equals(http.StatusGatewayTimeout)
+	assert(getGatewayStatusByKind("")).
+		Equals(http.StatusInternalServerError)
+}
+
+func TestWebSocketServer_GatewayHandler(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}).
+		Echo("add", true, func(ctx Context, a int64, b uint64, c float64) Return {
+			return ctx.OK(float64(a) + float64(b) + c)
+		}).
+		Echo("echo", true, func(ctx Context, b Bytes, m Map) Return {
+			return ctx.OK(Array{b, m})
+		}).
+		Echo("whoAmI", true, func(ctx Context) Return {
+			return ctx.OK(ctx.Principal().Name)
+		}, EchoRequireRoles("admin")).
+		Echo("limited", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoRateLimit(0.001, 1)).
+		Echo("fail", true, func(ctx Context) Return {
+			return ctx.Error(NewError("failed"))
+		}).
+		Echo("private", false, func(ctx Context) Return {
+			return ctx.OK(true)
+		}))
+
+	handler := server.GatewayHandler("/rpc/")
+	call := func(method string, path string, body string) (int, Map) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Name", "tom")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		ret := Map{}
+		decoder := json.NewDecoder(w.Body)
+		decoder.UseNumber()
+		assert(decoder.Decode(&ret)).IsNil()
+		assert(w.Header().Get("Content-Type")).
+			Equals("application/json; charset=utf-8")
+		return w.Code, ret
+	}
+	errorOf := func(message string, kind string, details Map) Map {
+		return Map{"error": Map{
+			"message": message,
+			"kind":    kind,
+			"details": details,
+		}}
+	}
+
+	// the server is not opened
+	assert(call("POST", "/rpc/user/sayHello", `["world"]`)).Equals(
+		http.StatusServiceUnavailable,
+		errorOf("gateway: server is not opened", "", Map{}),
+	)
+
+	assert(server.Open()).IsNil()
+	defer server.Close()
+
+	assert(call("GET", "/rpc/user/sayHello", "")).Equals(
+		http.StatusMethodNotAllowed,
+		errorOf("gateway: method GET is not allowed", "", Map{}),
+	)
+	assert(call("POST", "/rpc/user/sayHello", `["world"]`)).
+		Equals(http.StatusOK, Map{"result": "hello world"})
+	assert(call("POST", "/rpc/user/add", `[-1, 2, 0.5]`)).
+		Equals(http.StatusOK, Map{"result": json.Number("1.5")})
+	assert(call("POST", "/rpc/user/echo", `["aGVsbG8=", {"n": 1}]`)).Equals(
+		http.StatusOK,
+		Map{"result": Array{"aGVsbG8=", Map{"n": json.Number("1")}}},
+	)
+
+	// the echo is not found or not exported
+	for _, path := range []string{"/rpc/user/none", "/rpc/user/private"} {
+		assert(call("POST", path, `[]`)).Equals(
+			http.StatusNotFound,
+			errorOf(
+				"gateway: echo "+path+" is not found",
+				ErrorKindNotFound,
+				Map{"path": path},
+			),
+		)
+	}
+
+	// the arguments are invalid
+	assert(call("POST", "/rpc/user/sayHello", `{}`)).Equals(
+		http.StatusBadRequest,
+		errorOf(
+			"gateway: body must be the JSON array of the arguments",
+			ErrorKindInvalidArgs,
+			Map{"path": "$.user:sayHello"},
+		),
+	)
+	assert(call("POST", "/rpc/user/sayHello", `["world"] ["again"]`)).Equals(
+		http.StatusBadRequest,
+		errorOf(
+			"gateway: body must be the JSON array of the arguments",
+			ErrorKindInvalidArgs,
+			Map{"path": "$.user:sayHello"},
+		),
+	)
+	assert(call("POST", "/rpc/user/sayHello", `["world"]}`)).Equals(
+		http.StatusBadRequest,
+		errorOf(
+			"gateway: body must be the JSON array of the arguments",
+			ErrorKindInvalidArgs,
+			Map{"path": "$.user:sayHello"},
+		),
+	)
+	assert(call("POST", "/rpc/user/sayHello", ``)).Equals(
+		http.StatusBadRequest,
+		errorOf(
+			"gateway: echo $.user:sayHello requires 1 arguments, but got 0",
+			ErrorKindInvalidArgs,
+			Map{"path": "$.user:sayHello"},
+		),
+	)
+	assert(call("POST", "/rpc/user/echo", `["aGVsbG8=", {"n": 1e999}]`)).Equals(
+		http.StatusBadRequest,
+		errorOf(
+			"gateway: argument 2 of echo $.user:echo must be rpc.Map",
+			ErrorKindInvalidArgs,
+			Map{"path": "$.user:echo", "index": json.Number("2")},
+		),
+	)
+	assert(call("POST", "/rpc/user/add", `[1, -2, 3]`)).Equals(
+		http.StatusBadRequest,
+		errorOf(
+			"gateway: argument 2 of echo $.user:add must be rpc.Uint64",
+			ErrorKindInvalidArgs,
+			Map{"path": "$.user:add", "index": json.Number("2")},
+		),
+	)
+
+	// the errors of the call
+	code, ret := call("POST", "/rpc/user/whoAmI", `[]`)
+	assert(code).Equals(http.StatusForbidden)
+	assert(ret["error"].(Map)["kind"]).Equals(ErrorKindUnauthorized)
+	assert(call("POST", "/rpc/user/limited", `[]`)).
+		Equals(http.StatusOK, Map{"result": true})
+	code, ret = call("POST", "/rpc/user/limited", `[]`)
+	assert(code).Equals(http.StatusTooManyRequests)
+	assert(ret["error"].(Map)["kind"]).Equals(ErrorKindRateLimited)
+	assert(call("POST", "/rpc/user/fail", `[]`)).Equals(
+		http.StatusInternalServerError,
+		errorOf("failed", "", Map{}),
+	)
+
+	// the authentication
+	server.SetAuthenticator(AuthenticatorFunc(
+		func(req *http.Request) (*Principal, Error) {
+			if name := req.Header.Get("X-Name"); name == "tom" {
+				return &Principal{Name: name, Roles: []string{"admin"}}, nil
+			}
+			return nil, NewErrorByKind(ErrorKindUnauthenticated, "no name", nil)
+		},
+	))
+	assert(call("POST", "/rpc/user/whoAmI", `[]`)).
+		Equals(http.StatusOK, Map{"result": "tom"})
+	// the echos are not revealed to the unauthenticated callers
+	for _, path := range []string{"/rpc/user/whoAmI", "/rpc/user/none"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert(w.Code).Equals(http.StatusUnauthorized)
+	}
+
+	// the cross-site requests of the browsers
+	newRequest := func(contentType string, origin string) *http.Request {
+		req := httptest.NewRequest(
+			"POST",
+			"/rpc/user/sayHello",
+			strings.NewReader(`["world"]`),
+		)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("X-Name", "tom")
+		return req
+	}
+	for _, item := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{newRequest("text/plain", ""), http.StatusUnsupportedMediaType},
+		{newRequest("", ""), http.StatusUnsupportedMediaType},
+		{newRequest("application/json", "http://evil.com"), http.StatusForbidden},
+		{newRequest("application/json", "http://example.com"), http.StatusOK},
+		{newRequest("application/json; charset=utf-8", ""), http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, item.req)
+		assert(w.Code).Equals(item.code)
+	}
+
+	// the gateway connections are freed
+	count := 0
+	server.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	assert(count).Equals(0)
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// InProcessClient is implement of INetClient which is paired with the
+// WebSocketServer in the same process. the streams are moved in memory, but
+// the handshake, the authentication, the sequence checks, the limits and
+// the error format are the same as the other transports. it is useful to
+// test the services and to embed the server
+type InProcessClient struct {
+	*rpcClient
+	server *WebSocketServer
+	query  url.Values
+}
+
+// NewInProcessClient create an InProcessClient of server, query is the
+// handshake parameters, like the query of the websocket url. the server
+// must be opened by Open (or Start)
+func NewInProcessClient(
+	server *WebSocketServer,
+	query url.Values,
+) *InProcessClient {
+	client := &InProcessClient{
+		server: server,
+		query:  query,
+	}
+	client.rpcClient = newRPCClient(client.dial)
+	return client
+}
+
+func (p *InProcessClient) dial(
+	query url.Values,
+	readSizeLimit int64,
+) (rpcStreamConn, error) {
+	if !p.server.isOpened() {
+		return nil, errors.New("in process: server is not opened")
+	}
+
+	requestQuery := url.Values{}
+	for key, values := range p.query {
+		requestQuery[key] = values
+	}
+	for key, values := range query {
+		requestQuery[key] = values
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go p.server.serveTCPConn(serverConn)
+
+	streamConn := newTCPStreamConn(clientConn, readSizeLimit)
+	if err := streamConn.WriteStream([]byte(requestQuery.Encode())); err != nil {
+		_ = clientConn.Close()
+		return nil, err
+	}
+	return streamConn, nil
+}
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInProcessClient(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}).
+		Echo("whoAmI", true, func(ctx Context) Return {
+			return ctx.OK(ctx.Principal().Name)
+		}).
+		Echo("sleep", true, func(ctx Context) Return {
+			time.Sleep(100 * time.Millisecond)
+			return ctx.OK(true)
+		}, EchoRateLimit(0.001, 1)))
+	server.SetAuthenticator(AuthenticatorFunc(
+		func(req *http.Request) (*Principal, Error) {
+			if name := req.URL.Query().Get("name"); name != "" {
+				return &Principal{Name: name}, nil
+			}
+			return nil, NewErrorByKind(ErrorKindUnauthenticated, "no name", nil)
+		},
+	))
+
+	// the server is not opened
+	client := NewInProcessClient(server, url.Values{"name": {"tom"}})
+	atomic.StoreInt64(&client.msgTimeoutNS, int64(200*time.Millisecond))
+	_, err := client.SendMessage("$.user:sayHello", "world")
+	assert(err.GetMessage()).Equals("timeout")
+	assert(client.Close()).IsNil()
+
+	assert(server.Open()).IsNil()
+	defer server.Close()
+
+	client = NewInProcessClient(server, url.Values{"name": {"tom"}})
+	assert(client.SendMessage("$.user:sayHello", "world")).
+		Equals("hello world", nil)
+	assert(client.SendMessage("$.user:whoAmI")).Equals("tom", nil)
+
+	// the error format is the same as the other transports
+	_, err = client.SendMessage("$.user:sayHello", 3)
+	assert(err).IsNotNil()
+	assert(client.SendMessage("$.user:sleep")).Equals(true, nil)
+	_, err = client.SendMessage("$.user:sleep")
+	assert(err.GetKind()).Equals(ErrorKindRateLimited)
+	assert(err.GetDetails()["path"]).Equals("$.user:sleep")
+
+	// the concurrent calls
+	finishCH := make(chan bool, 100)
+	for i := 0; i < 100; i++ {
+		go func() {
+			ret, err := client.SendMessage("$.user:sayHello", "world")
+			finishCH <- ret == "hello world" && err == nil
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		assert(<-finishCH).IsTrue()
+	}
+	assert(client.Close()).IsNil()
+
+	// the handshake is rejected by the authenticator
+	client = NewInProcessClient(server, nil)
+	atomic.StoreInt64(&client.msgTimeoutNS, int64(200*time.Millisecond))
+	_, err = client.SendMessage("$.user:sayHello", "world")
+	assert(err.GetMessage()).Equals("timeout")
+	assert(client.Close()).IsNil()
+}
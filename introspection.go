@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// NewIntrospectionService create a service which describe the echos mounted
+// on the processor, the echos which the caller is not authorized to call are
+// not listed. mount it like this:
+//
+//	server.AddService("rpc", rpc.NewIntrospectionService())
+//
+// then call "$.rpc:echos" to get the echos description
+func NewIntrospectionService() Service {
+	return NewService().
+		Echo("echos", true, func(ctx Context) Return {
+			processor := ctx.getProcessor()
+			if processor == nil {
+				return ctx.OK(Array{})
+			}
+			return ctx.OK(processor.getEchosInfo(ctx.Principal()))
+		})
+}
+
+// getEchosInfo describe the mounted echos which the principal is authorized
+// to call, sorted by path. the aliases of the echos are listed with them
+func (p *rpcProcessor) getEchosInfo(principal *Principal) Array {
+	paths := make([]string, 0, len(p.echosMap))
+	for path, echoNode := range p.echosMap {
+		if echoNode.isAuthorized(principal) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	echoAliases := p.getEchoAliases()
+	ret := make(Array, 0, len(paths))
+	for _, path := range paths {
+		info := p.echosMap[path].getInfo()
+		if aliases, ok := echoAliases[path]; ok {
+			info["aliases"] = aliases
+		} else {
+			info["aliases"] = Array{}
+		}
+		ret = append(ret, info)
+	}
+	return ret
+}
+
+// getEchoAliases get the alias paths of the echos by the echo paths, the
+// alias paths are sorted
+func (p *rpcProcessor) getEchoAliases() map[string]Array {
+	aliasPaths := make([]string, 0, len(p.aliasesMap))
+	for aliasPath := range p.aliasesMap {
+		aliasPaths = append(aliasPaths, aliasPath)
+	}
+	sort.Strings(aliasPaths)
+
+	ret := make(map[string]Array)
+	for _, aliasPath := range aliasPaths {
+		if echoNode, ok := p.getEchoNode(aliasPath); ok {
+			ret[echoNode.path] = append(ret[echoNode.path], aliasPath)
+		}
+	}
+	return ret
+}
+
+// getInfo describe the echo
+func (p *rpcEchoNode) getInfo() Map {
+	args := make(Array, 0, len(p.argTypes))
+	for i := 1; i < len(p.argTypes); i++ {
+		rules := Array{}
+		if p.argRules != nil {
+			for _, rule := range p.argRules[i] {
+				rules = append(rules, rule.String())
+			}
+		}
+		args = append(args, Map{
+			"name":  p.argNames[i],
+			"type":  convertTypeToString(p.argTypes[i]),
+			"doc":   p.argDocs[i],
+			"rules": rules,
+		})
+	}
+
+	return Map{
+		"path":        p.path,
+		"export":      p.echoMeta.export,
+		"version":     uint64(p.echoMeta.version),
+		"isDefault":   p.echoMeta.isDefault,
+		"status":      EchoStatus(atomic.LoadInt32(&p.status)).String(),
+		"description": p.echoMeta.description,
+		"args":        args,
+		"return":      convertTypeToString(returnType),
+		"returnDoc":   p.echoMeta.returnDoc,
+	}
+}
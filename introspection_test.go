@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"testing"
+)
+
+func TestNewIntrospectionService(t *testing.T) {
+	assert := newAssert(t)
+
+	retStreamCH := make(chan *rpcStream)
+	processor := newRPCProcessor(
+		nil,
+		16,
+		16,
+		func(stream *rpcStream, success bool) {
+			retStreamCH <- stream
+		},
+		nil,
+	)
+	_ = processor.AddService("rpc", NewIntrospectionService(), "")
+	_ = processor.AddService("user", NewService().Echo(
+		"setAge",
+		false,
+		func(ctx Context, name string, age int64) Return {
+			return ctx.OK(true)
+		},
+		ValidateArg(2, RuleRange(0, 150)),
+		DescribeEcho("set the age of user"),
+		DescribeArg(1, "name", "user name"),
+		DescribeReturn("true if success"),
+	).Alias("updateAge", "setAge"), "")
+
+	stream := newStream()
+	stream.WriteString("$.rpc:echos")
+	stream.WriteUint64(3)
+	stream.WriteString("#")
+	processor.Start()
+	processor.PutStream(stream)
+	out := <-retStreamCH
+	processor.Stop()
+
+	assert(out.ReadBool()).Equals(true, true)
+	assert(out.ReadArray()).Equals(Array{
+		Map{
+			"path":        "$.rpc:echos",
+			"export":      true,
+			"version":     uint64(0),
+			"isDefault":   false,
+			"status":      "normal",
+			"description": "",
+			"args":        Array{},
+			"return":      "rpc.Return",
+			"returnDoc":   "",
+			"aliases":     Array{},
+		},
+		Map{
+			"path":        "$.user:setAge",
+			"export":      false,
+			"version":     uint64(0),
+			"isDefault":   false,
+			"status":      "normal",
+			"description": "set the age of user",
+			"args": Array{
+				Map{
+					"name":  "name",
+					"type":  "rpc.String",
+					"doc":   "user name",
+					"rules": Array{},
+				},
+				Map{
+					"name":  "",
+					"type":  "rpc.Int64",
+					"doc":   "",
+					"rules": Array{"range[0, 150]"},
+				},
+			},
+			"return":    "rpc.Return",
+			"returnDoc": "true if success",
+			"aliases":   Array{"$.user:updateAge"},
+		},
+	}, true)
+}
+
+func TestRpcProcessor_getEchosInfo(t *testing.T) {
+	assert := newAssert(t)
+
+	handler := func(ctx Context) Return { return ctx.OK(true) }
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService("user", NewService().
+		Echo("get", true, handler).
+		Echo("get", true, handler, EchoVersion(2)).
+		Echo("get", true, handler, EchoVersion(3), DefaultEchoVersion()).
+		Echo("set", true, handler, EchoRequireRoles("editor")).
+		Alias("fetch", "get").
+		Alias("fetch@1", "get@2").
+		AddService("admin", NewService().
+			RequireRoles("admin").
+			Echo("reset", true, handler),
+		), "")).IsNil()
+
+	getPaths := func(principal *Principal) []string {
+		ret := make([]string, 0)
+		for _, info := range processor.getEchosInfo(principal) {
+			ret = append(ret, info.(Map)["path"].(string))
+		}
+		return ret
+	}
+
+	assert(getPaths(nil)).
+		Equals([]string{"$.user:get", "$.user:get@2", "$.user:get@3"})
+	assert(getPaths(&Principal{Roles: []string{"editor"}})).Equals([]string{
+		"$.user:get", "$.user:get@2", "$.user:get@3", "$.user:set",
+	})
+	assert(getPaths(&Principal{Roles: []string{"admin", "editor"}})).
+		Equals([]string{
+			"$.user.admin:reset",
+			"$.user:get", "$.user:get@2", "$.user:get@3", "$.user:set",
+		})
+
+	// the default version and the aliases
+	infos := processor.getEchosInfo(nil)
+	for i, expected := range []Map{
+		{"isDefault": false, "aliases": Array{"$.user:fetch"}},
+		{"isDefault": false, "aliases": Array{"$.user:fetch@1"}},
+		{"isDefault": true, "aliases": Array{}},
+	} {
+		info := infos[i].(Map)
+		assert(Map{"isDefault": info["isDefault"], "aliases": info["aliases"]}).
+			Equals(expected)
+	}
+}
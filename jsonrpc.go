@@ -0,0 +1,486 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jsonRPCVersion        = "2.0"
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+	jsonRPCInternalError  = -32603
+	jsonRPCServerError    = -32000
+
+	// jsonRPCTextQueueSize is the max text messages of a connection which
+	// wait to be served
+	jsonRPCTextQueueSize = 16
+)
+
+// JSONRPCMethodMapper map the JSON-RPC method to the echo path, it returns
+// "" if the method is not found
+type JSONRPCMethodMapper func(method string) string
+
+// SetJSONRPCMethodMapper set the mapper of the JSON-RPC methods. by default,
+// the method "user.profile.get" is the echo $.user.profile:get, and the
+// method like "$.user:sayHello" is the echo path itself
+func (p *WebSocketServer) SetJSONRPCMethodMapper(mapper JSONRPCMethodMapper) {
+	p.Lock()
+	p.jsonRPCMapper = mapper
+	p.Unlock()
+}
+
+// getJSONRPCEchoPath map the JSON-RPC method to the echo path
+func (p *WebSocketServer) getJSONRPCEchoPath(method string) string {
+	p.Lock()
+	mapper := p.jsonRPCMapper
+	p.Unlock()
+
+	if mapper != nil {
+		return mapper(method)
+	}
+	return getEchoPathByMethod(method)
+}
+
+// getEchoPathByMethod map the dotted method to the echo path
+func getEchoPathByMethod(method string) string {
+	if strings.HasPrefix(method, rootName) {
+		return method
+	}
+	arr := strings.Split(method, ".")
+	for _, name := range arr {
+		if name == "" {
+			return ""
+		}
+	}
+	return getEchoPathByNames(arr)
+}
+
+// rpcJSONRPCHandler is the JSON-RPC 2.0 endpoint over HTTP
+type rpcJSONRPCHandler struct {
+	server *WebSocketServer
+}
+
+// JSONRPCHandler create the JSON-RPC 2.0 endpoint over HTTP for the exported
+// echos. the body is a request or a batch of requests, the params are the
+// array of the arguments, or the object of the arguments named by
+// DescribeArg. the notifications (the requests without id) are called but
+// not responded, and the response is 204 if there is nothing to respond.
+//
+// the same requests are also accepted by the text messages of the websocket
+// connections, and responded by the text messages.
+//
+// the errors of the echos are the server errors (-32000) whose data is
+// {"kind", "details"}, except that ErrorKindNotFound is -32601 and
+// ErrorKindInvalidArgs is -32602. the values are converted, and the requests
+// are checked like GatewayHandler. the WebSocketServer must be opened by Open
+// (or Start)
+func (p *WebSocketServer) JSONRPCHandler() http.Handler {
+	return &rpcJSONRPCHandler{server: p}
+}
+
+func (p *rpcJSONRPCHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	server := p.server
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONRPC(w, http.StatusMethodNotAllowed, newJSONRPCError(
+			nil,
+			jsonRPCInvalidRequest,
+			NewError(fmt.Sprintf("jsonrpc: method %s is not allowed", req.Method)),
+		))
+		return
+	}
+
+	if !server.isOpened() {
+		writeJSONRPC(w, http.StatusServiceUnavailable, newJSONRPCError(
+			nil,
+			jsonRPCServerError,
+			NewError("jsonrpc: server is not opened"),
+		))
+		return
+	}
+
+	if req.Header.Get("Origin") != "" && !server.checkOrigin(req) {
+		writeJSONRPC(w, http.StatusForbidden, newJSONRPCError(
+			nil,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: origin is not allowed"),
+		))
+		return
+	}
+
+	if !isJSONRequest(req) {
+		writeJSONRPC(w, http.StatusUnsupportedMediaType, newJSONRPCError(
+			nil,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: content type must be application/json"),
+		))
+		return
+	}
+
+	principal, err := server.authenticateRequest(req)
+	if err != nil {
+		writeJSONRPC(
+			w,
+			http.StatusUnauthorized,
+			newJSONRPCError(nil, jsonRPCServerError, err),
+		)
+		return
+	}
+	principal = server.resolvePrincipal(req, principal)
+
+	body, readErr := ioutil.ReadAll(http.MaxBytesReader(
+		w,
+		req.Body,
+		int64(atomic.LoadUint64(&server.readSizeLimit)),
+	))
+	if readErr != nil {
+		writeJSONRPC(w, http.StatusBadRequest, newJSONRPCError(
+			nil,
+			jsonRPCParseError,
+			NewErrorBySystemError(readErr),
+		))
+		return
+	}
+
+	ret := server.handleJSONRPC(
+		req.Context(),
+		server.newRequestConn(req, principal),
+		getRemoteIP(req),
+		body,
+	)
+	if ret == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONRPC(w, http.StatusOK, ret)
+}
+
+// serveJSONRPCTexts serve the JSON-RPC text messages of the connection in
+// order until textCH is closed, the messages are dropped if ctx is done
+func (p *WebSocketServer) serveJSONRPCTexts(
+	ctx context.Context,
+	conn rpcTextStreamConn,
+	serverConn *wsServerConn,
+	remoteIP string,
+	textCH <-chan []byte,
+) {
+	for text := range textCH {
+		if ctx.Err() == nil {
+			p.serveJSONRPCText(ctx, conn, serverConn, remoteIP, text)
+		}
+	}
+}
+
+// serveJSONRPCText serve the JSON-RPC text message of the connection, it is
+// canceled if ctx is done, or it is not finished in the read timeout
+func (p *WebSocketServer) serveJSONRPCText(
+	ctx context.Context,
+	conn rpcTextStreamConn,
+	serverConn *wsServerConn,
+	remoteIP string,
+	text []byte,
+) {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(atomic.LoadUint64(&p.readTimeoutNS)),
+	)
+	defer cancel()
+
+	ret := p.handleJSONRPC(ctx, serverConn, remoteIP, text)
+	if ret != nil {
+		if err := conn.WriteText(ret); err != nil {
+			p.onError(serverConn, err.Error())
+		}
+	}
+}
+
+// handleJSONRPC handle the JSON-RPC request or batch on behalf of the owner
+// connection, it returns nil if there is nothing to respond
+func (p *WebSocketServer) handleJSONRPC(
+	ctx context.Context,
+	owner *wsServerConn,
+	remoteIP string,
+	data []byte,
+) []byte {
+	data = bytes.TrimSpace(data)
+	if !json.Valid(data) {
+		return newJSONRPCError(
+			nil,
+			jsonRPCParseError,
+			NewError("jsonrpc: parse error"),
+		)
+	}
+
+	if data[0] != '[' {
+		return p.callJSONRPC(ctx, owner, remoteIP, data)
+	}
+
+	items := make([]json.RawMessage, 0)
+	_ = json.Unmarshal(data, &items)
+	if len(items) == 0 {
+		return newJSONRPCError(
+			nil,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: batch is empty"),
+		)
+	}
+
+	rets := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		if ret := p.callJSONRPC(ctx, owner, remoteIP, item); ret != nil {
+			rets = append(rets, ret)
+		}
+	}
+	if len(rets) == 0 {
+		return nil
+	}
+	ret, _ := json.Marshal(rets)
+	return ret
+}
+
+// callJSONRPC call the JSON-RPC request, it returns nil if the request is a
+// notification
+func (p *WebSocketServer) callJSONRPC(
+	ctx context.Context,
+	owner *wsServerConn,
+	remoteIP string,
+	data json.RawMessage,
+) []byte {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return newJSONRPCError(
+			nil,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: request must be an object"),
+		)
+	}
+
+	id, hasID := fields["id"]
+	if hasID && !isJSONRPCID(id) {
+		return newJSONRPCError(
+			nil,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: id must be a string, a number or null"),
+		)
+	}
+
+	version, method := "", ""
+	if err := json.Unmarshal(fields["jsonrpc"], &version); err != nil ||
+		version != jsonRPCVersion {
+		return newJSONRPCError(
+			id,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: jsonrpc must be \"2.0\""),
+		)
+	}
+	if err := json.Unmarshal(fields["method"], &method); err != nil ||
+		method == "" {
+		return newJSONRPCError(
+			id,
+			jsonRPCInvalidRequest,
+			NewError("jsonrpc: method must be a non-empty string"),
+		)
+	}
+
+	ret, err := p.callJSONRPCMethod(
+		ctx,
+		owner,
+		remoteIP,
+		method,
+		fields["params"],
+	)
+	if !hasID {
+		return nil
+	}
+	if err != nil {
+		return newJSONRPCError(id, getJSONRPCCodeByKind(err.GetKind()), err)
+	}
+	return newJSONRPCResult(id, ret)
+}
+
+// callJSONRPCMethod call the exported echo of the method by the params
+func (p *WebSocketServer) callJSONRPCMethod(
+	ctx context.Context,
+	owner *wsServerConn,
+	remoteIP string,
+	method string,
+	params json.RawMessage,
+) (interface{}, Error) {
+	echoPath := p.getJSONRPCEchoPath(method)
+	echoNode, ok := (*rpcEchoNode)(nil), false
+	if echoPath != "" {
+		echoNode, ok = p.processor.getEchoNode(echoPath)
+	}
+	if !ok || !echoNode.echoMeta.export {
+		return nil, NewErrorByKind(
+			ErrorKindNotFound,
+			fmt.Sprintf("jsonrpc: method %s is not found", method),
+			Map{"method": method},
+		)
+	}
+
+	args, err := decodeJSONRPCParams(params, echoNode)
+	if err != nil {
+		return nil, err
+	}
+	return p.callByConn(ctx, owner, remoteIP, echoNode.path, args)
+}
+
+// decodeJSONRPCParams decode the params by position or by name, the names
+// are the argument names of the echo
+func decodeJSONRPCParams(
+	params json.RawMessage,
+	echoNode *rpcEchoNode,
+) (Array, Error) {
+	value := interface{}(nil)
+	if len(params) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(params))
+		decoder.UseNumber()
+		_ = decoder.Decode(&value)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return convertGatewayArgs(make([]interface{}, 0), echoNode)
+	case []interface{}:
+		return convertGatewayArgs(v, echoNode)
+	case map[string]interface{}:
+		values := make([]interface{}, len(echoNode.argTypes)-1)
+		for i := range values {
+			name := ""
+			if i+1 < len(echoNode.argNames) {
+				name = echoNode.argNames[i+1]
+			}
+			if name == "" {
+				return nil, NewErrorByKind(
+					ErrorKindInvalidArgs,
+					fmt.Sprintf(
+						"jsonrpc: echo %s does not support named params",
+						echoNode.path,
+					),
+					Map{"path": echoNode.path},
+				)
+			}
+			item, ok := v[name]
+			if !ok {
+				return nil, NewErrorByKind(
+					ErrorKindInvalidArgs,
+					fmt.Sprintf(
+						"jsonrpc: param %s of echo %s is missing",
+						name,
+						echoNode.path,
+					),
+					Map{"path": echoNode.path, "name": name},
+				)
+			}
+			values[i] = item
+			delete(v, name)
+		}
+
+		if len(v) > 0 {
+			unknown := make([]string, 0, len(v))
+			for name := range v {
+				unknown = append(unknown, name)
+			}
+			sort.Strings(unknown)
+			return nil, NewErrorByKind(
+				ErrorKindInvalidArgs,
+				fmt.Sprintf(
+					"jsonrpc: param %s of echo %s is unknown",
+					unknown[0],
+					echoNode.path,
+				),
+				Map{"path": echoNode.path, "name": unknown[0]},
+			)
+		}
+		return convertGatewayArgs(values, echoNode)
+	default:
+		return nil, NewErrorByKind(
+			ErrorKindInvalidArgs,
+			"jsonrpc: params must be an array or an object",
+			Map{"path": echoNode.path},
+		)
+	}
+}
+
+// isJSONRPCID check the id is a string, a number or null
+func isJSONRPCID(id json.RawMessage) bool {
+	if len(id) == 0 {
+		return false
+	}
+	switch c := id[0]; {
+	case c == '"', c == '-', c >= '0' && c <= '9':
+		return true
+	default:
+		return string(id) == "null"
+	}
+}
+
+// getJSONRPCCodeByKind get the JSON-RPC error code of the error kind
+func getJSONRPCCodeByKind(kind string) int {
+	switch kind {
+	case ErrorKindNotFound:
+		return jsonRPCMethodNotFound
+	case ErrorKindInvalidArgs:
+		return jsonRPCInvalidParams
+	default:
+		return jsonRPCServerError
+	}
+}
+
+func newJSONRPCResult(id json.RawMessage, result interface{}) []byte {
+	return marshalJSONRPC(id, Map{"result": result})
+}
+
+func newJSONRPCError(id json.RawMessage, code int, err Error) []byte {
+	details := err.GetDetails()
+	if details == nil {
+		details = Map{}
+	}
+	return marshalJSONRPC(id, Map{"error": Map{
+		"code":    code,
+		"message": err.GetMessage(),
+		"data": Map{
+			"kind":    err.GetKind(),
+			"details": details,
+		},
+	}})
+}
+
+func marshalJSONRPC(id json.RawMessage, body Map) []byte {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	body["jsonrpc"] = jsonRPCVersion
+	body["id"] = id
+	ret, err := json.Marshal(body)
+	if err != nil {
+		ret, _ = json.Marshal(Map{
+			"jsonrpc": jsonRPCVersion,
+			"id":      id,
+			"error": Map{
+				"code":    jsonRPCInternalError,
+				"message": "jsonrpc: " + err.Error(),
+			},
+		})
+	}
+	return ret
+}
+
+func writeJSONRPC(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,378 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestGetEchoPathByMethod(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(getEchoPathByMethod("user.profile.get")).Equals("$.user.profile:get")
+	assert(getEchoPathByMethod("ping")).Equals("$:ping")
+	assert(getEchoPathByMethod("$.user:sayHello")).Equals("$.user:sayHello")
+	assert(getEchoPathByMethod("user..get")).Equals("")
+	assert(getEchoPathByMethod("user.")).Equals("")
+}
+
+func TestWebSocketServer_SetJSONRPCMethodMapper(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	assert(server.getJSONRPCEchoPath("user.get")).Equals("$.user:get")
+	server.SetJSONRPCMethodMapper(func(method string) string {
+		return "$.rpc:" + method
+	})
+	assert(server.getJSONRPCEchoPath("user.get")).Equals("$.rpc:user.get")
+}
+
+func TestIsJSONRPCID(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(isJSONRPCID(json.RawMessage(`"a"`))).IsTrue()
+	assert(isJSONRPCID(json.RawMessage(`1`))).IsTrue()
+	assert(isJSONRPCID(json.RawMessage(`-1.5`))).IsTrue()
+	assert(isJSONRPCID(json.RawMessage(`null`))).IsTrue()
+	assert(isJSONRPCID(json.RawMessage(`true`))).IsFalse()
+	assert(isJSONRPCID(json.RawMessage(`{}`))).IsFalse()
+	assert(isJSONRPCID(json.RawMessage(``))).IsFalse()
+}
+
+func TestGetJSONRPCCodeByKind(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(getJSONRPCCodeByKind(ErrorKindNotFound)).Equals(jsonRPCMethodNotFound)
+	assert(getJSONRPCCodeByKind(ErrorKindInvalidArgs)).Equals(jsonRPCInvalidParams)
+	assert(getJSONRPCCodeByKind(ErrorKindRateLimited)).Equals(jsonRPCServerError)
+	assert(getJSONRPCCodeByKind("")).Equals(jsonRPCServerError)
+}
+
+func TestDecodeJSONRPCParams(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newTestProcessor(NewLogger())
+	assert(processor.AddService("user", NewService().
+		Echo("add", true, func(ctx Context, a int64, b string) Return {
+			return ctx.OK(true)
+		}, DescribeArg(1, "a", ""), DescribeArg(2, "b", "")).
+		Echo("anonymous", true, func(ctx Context, a int64) Return {
+			return ctx.OK(true)
+		}), "")).IsNil()
+	add, _ := processor.getEchoNode("$.user:add")
+	anonymous, _ := processor.getEchoNode("$.user:anonymous")
+
+	assert(decodeJSONRPCParams(json.RawMessage(`[1, "s"]`), add)).
+		Equals(Array{int64(1), "s"}, nil)
+	assert(decodeJSONRPCParams(json.RawMessage(`{"b": "s", "a": 1}`), add)).
+		Equals(Array{int64(1), "s"}, nil)
+
+	errorOf := func(params string, node *rpcEchoNode) Error {
+		_, err := decodeJSONRPCParams(json.RawMessage(params), node)
+		assert(err.GetKind()).Equals(ErrorKindInvalidArgs)
+		return err
+	}
+	assert(errorOf(``, add).GetMessage()).
+		Equals("gateway: echo $.user:add requires 2 arguments, but got 0")
+	assert(errorOf(`{"a": 1}`, add).GetMessage()).
+		Equals("jsonrpc: param b of echo $.user:add is missing")
+	assert(errorOf(`{"a": 1, "b": "s", "d": 1, "c": 1}`, add).GetDetails()).
+		Equals(Map{"path": "$.user:add", "name": "c"})
+	assert(errorOf(`{"a": 1}`, anonymous).GetMessage()).
+		Equals("jsonrpc: echo $.user:anonymous does not support named params")
+	assert(errorOf(`"s"`, add).GetMessage()).
+		Equals("jsonrpc: params must be an array or an object")
+}
+
+func TestWebSocketServer_JSONRPCHandler(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}, DescribeArg(1, "name", "")).
+		Echo("whoAmI", true, func(ctx Context) Return {
+			return ctx.OK(ctx.Principal().Name)
+		}, EchoRequireRoles("admin")).
+		Echo("fail", true, func(ctx Context) Return {
+			return ctx.Error(NewErrorByKind("Failed", "failed", Map{"n": 1}))
+		}).
+		Echo("private", false, func(ctx Context) Return {
+			return ctx.OK(true)
+		}))
+
+	handler := server.JSONRPCHandler()
+	call := func(method string, body string) (int, interface{}) {
+		req := httptest.NewRequest(method, "/jsonrpc", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Name", "tom")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code == http.StatusNoContent {
+			assert(w.Body.Len()).Equals(0)
+			return w.Code, nil
+		}
+		ret := interface{}(nil)
+		decoder := json.NewDecoder(w.Body)
+		decoder.UseNumber()
+		assert(decoder.Decode(&ret)).IsNil()
+		assert(w.Header().Get("Content-Type")).
+			Equals("application/json; charset=utf-8")
+		ret, ok := convertJSONAny(ret)
+		assert(ok).IsTrue()
+		return w.Code, ret
+	}
+	resultOf := func(id interface{}, result interface{}) Map {
+		return Map{"jsonrpc": "2.0", "id": id, "result": result}
+	}
+	errorOf := func(id interface{}, code int64, message string, kind string) Map {
+		return Map{"jsonrpc": "2.0", "id": id, "error": Map{
+			"code":    code,
+			"message": message,
+			"data":    Map{"kind": kind, "details": Map{}},
+		}}
+	}
+
+	// the server is not opened
+	assert(call("POST", `{"jsonrpc":"2.0","method":"user.sayHello","id":1}`)).
+		Equals(
+			http.StatusServiceUnavailable,
+			errorOf(nil, -32000, "jsonrpc: server is not opened", ""),
+		)
+
+	assert(server.Open()).IsNil()
+	defer server.Close()
+
+	assert(call("GET", "")).Equals(
+		http.StatusMethodNotAllowed,
+		errorOf(nil, -32600, "jsonrpc: method GET is not allowed", ""),
+	)
+
+	// by position, by name, and by the echo path
+	assert(call(
+		"POST",
+		`{"jsonrpc":"2.0","method":"user.sayHello","params":["a"],"id":1}`,
+	)).Equals(http.StatusOK, resultOf(int64(1), "hello a"))
+	assert(call(
+		"POST",
+		`{"jsonrpc":"2.0","method":"user.sayHello","params":{"name":"b"},"id":"x"}`,
+	)).Equals(http.StatusOK, resultOf("x", "hello b"))
+	assert(call(
+		"POST",
+		`{"jsonrpc":"2.0","method":"$.user:sayHello","params":["c"],"id":null}`,
+	)).Equals(http.StatusOK, resultOf(nil, "hello c"))
+
+	// the notification is not responded
+	assert(call(
+		"POST",
+		`{"jsonrpc":"2.0","method":"user.sayHello","params":["d"]}`,
+	)).Equals(http.StatusNoContent, nil)
+
+	// the errors
+	assert(call("POST", `{"jsonrpc":`)).Equals(
+		http.StatusOK,
+		errorOf(nil, -32700, "jsonrpc: parse error", ""),
+	)
+	assert(call("POST", `1`)).Equals(
+		http.StatusOK,
+		errorOf(nil, -32600, "jsonrpc: request must be an object", ""),
+	)
+	assert(call("POST", `{"jsonrpc":"2.0","method":"user.sayHello","id":{}}`)).
+		Equals(http.StatusOK, errorOf(
+			nil,
+			-32600,
+			"jsonrpc: id must be a string, a number or null",
+			"",
+		))
+	assert(call("POST", `{"jsonrpc":"1.0","method":"user.sayHello","id":1}`)).
+		Equals(http.StatusOK, errorOf(
+			int64(1),
+			-32600,
+			"jsonrpc: jsonrpc must be \"2.0\"",
+			"",
+		))
+	assert(call("POST", `{"jsonrpc":"2.0","method":"","id":1}`)).
+		Equals(http.StatusOK, errorOf(
+			int64(1),
+			-32600,
+			"jsonrpc: method must be a non-empty string",
+			"",
+		))
+	for _, method := range []string{"user.none", "user.private", "user."} {
+		code, ret := call(
+			"POST",
+			`{"jsonrpc":"2.0","method":"`+method+`","id":1}`,
+		)
+		assert(code).Equals(http.StatusOK)
+		assert(ret.(Map)["error"]).Equals(Map{
+			"code":    int64(-32601),
+			"message": "jsonrpc: method " + method + " is not found",
+			"data": Map{
+				"kind":    ErrorKindNotFound,
+				"details": Map{"method": method},
+			},
+		})
+	}
+	_, ret := call("POST", `{"jsonrpc":"2.0","method":"user.sayHello","id":1}`)
+	assert(ret.(Map)["error"].(Map)["code"]).Equals(int64(-32602))
+	_, ret = call("POST", `{"jsonrpc":"2.0","method":"user.whoAmI","id":1}`)
+	assert(ret.(Map)["error"].(Map)["code"]).Equals(int64(-32000))
+	assert(ret.(Map)["error"].(Map)["data"].(Map)["kind"]).
+		Equals(ErrorKindUnauthorized)
+	_, ret = call("POST", `{"jsonrpc":"2.0","method":"user.fail","id":1}`)
+	assert(ret.(Map)["error"]).Equals(Map{
+		"code":    int64(-32000),
+		"message": "failed",
+		"data":    Map{"kind": "Failed", "details": Map{"n": int64(1)}},
+	})
+
+	// the batch
+	assert(call("POST", `[
+		{"jsonrpc":"2.0","method":"user.sayHello","params":["a"],"id":1},
+		{"jsonrpc":"2.0","method":"user.sayHello","params":["b"]},
+		1,
+		{"jsonrpc":"2.0","method":"user.sayHello","params":["c"],"id":2}
+	]`)).Equals(http.StatusOK, Array{
+		resultOf(int64(1), "hello a"),
+		errorOf(nil, -32600, "jsonrpc: request must be an object", ""),
+		resultOf(int64(2), "hello c"),
+	})
+	assert(call("POST", `[]`)).Equals(
+		http.StatusOK,
+		errorOf(nil, -32600, "jsonrpc: batch is empty", ""),
+	)
+	assert(call("POST", `[
+		{"jsonrpc":"2.0","method":"user.sayHello","params":["a"]}
+	]`)).Equals(http.StatusNoContent, nil)
+
+	// the authentication
+	server.SetAuthenticator(AuthenticatorFunc(
+		func(req *http.Request) (*Principal, Error) {
+			if name := req.Header.Get("X-Name"); name == "tom" {
+				return &Principal{Name: name, Roles: []string{"admin"}}, nil
+			}
+			return nil, NewErrorByKind(ErrorKindUnauthenticated, "no name", nil)
+		},
+	))
+	assert(call("POST", `{"jsonrpc":"2.0","method":"user.whoAmI","id":1}`)).
+		Equals(http.StatusOK, resultOf(int64(1), "tom"))
+	req := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert(w.Code).Equals(http.StatusUnauthorized)
+
+	// the cross-site requests of the browsers
+	newRequest := func(contentType string, origin string) *http.Request {
+		req := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(
+			`{"jsonrpc":"2.0","method":"user.whoAmI","id":1}`,
+		))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("X-Name", "tom")
+		return req
+	}
+	for _, item := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{newRequest("text/plain", ""), http.StatusUnsupportedMediaType},
+		{newRequest("application/json", "http://evil.com"), http.StatusForbidden},
+		{newRequest("application/json", "http://example.com"), http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, item.req)
+		assert(w.Code).Equals(item.code)
+	}
+
+	// the JSON-RPC connections are freed
+	count := 0
+	server.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	assert(count).Equals(0)
+}
+
+func TestWebSocketServer_serveJSONRPCText(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}).
+		Echo("setName", true, func(ctx Context, name string) Return {
+			ctx.SetPrincipal(&Principal{Name: name})
+			return ctx.OK(true)
+		}).
+		Echo("getName", true, func(ctx Context) Return {
+			return ctx.OK(ctx.Principal().Name)
+		}).
+		Echo("sleep", true, func(ctx Context, ms int64) Return {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return ctx.OK(ms)
+		}))
+	assert(server.Open()).IsNil()
+	defer server.Close()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(httpServer.URL, "http"),
+		nil,
+	)
+	assert(err).IsNil()
+	defer conn.Close()
+
+	// the open information is the binary message
+	mt, _, err := conn.ReadMessage()
+	assert(mt, err).Equals(websocket.BinaryMessage, nil)
+
+	call := func(request string) string {
+		assert(conn.WriteMessage(websocket.TextMessage, []byte(request))).IsNil()
+		assert(conn.SetReadDeadline(time.Now().Add(3 * time.Second))).IsNil()
+		mt, message, err := conn.ReadMessage()
+		assert(mt, err).Equals(websocket.TextMessage, nil)
+		return string(message)
+	}
+
+	assert(call(`{"jsonrpc":"2.0","method":"user.sayHello","params":["a"],"id":1}`)).
+		Equals(`{"id":1,"jsonrpc":"2.0","result":"hello a"}`)
+
+	// the principal is the principal of the websocket connection
+	assert(call(`[
+		{"jsonrpc":"2.0","method":"user.setName","params":["tom"]},
+		{"jsonrpc":"2.0","method":"user.getName","id":2}
+	]`)).Equals(`[{"id":2,"jsonrpc":"2.0","result":"tom"}]`)
+
+	// the text messages are served in order
+	for _, request := range []string{
+		`{"jsonrpc":"2.0","method":"user.sleep","params":[30],"id":3}`,
+		`{"jsonrpc":"2.0","method":"user.sleep","params":[0],"id":4}`,
+	} {
+		assert(conn.WriteMessage(websocket.TextMessage, []byte(request))).
+			IsNil()
+	}
+	for _, response := range []string{
+		`{"id":3,"jsonrpc":"2.0","result":30}`,
+		`{"id":4,"jsonrpc":"2.0","result":0}`,
+	} {
+		mt, message, err := conn.ReadMessage()
+		assert(mt, err).Equals(websocket.TextMessage, nil)
+		assert(string(message)).Equals(response)
+	}
+
+	// the text message is canceled if it is not finished in the read timeout
+	atomic.StoreUint64(&server.readTimeoutNS, uint64(100*time.Millisecond))
+	assert(call(`{"jsonrpc":"2.0","method":"user.sleep","params":[300],"id":5}`)).
+		Equals(`{"error":{"code":-32000,"data":{"details":{},"kind":""},` +
+			`"message":"gateway: request is canceled"},"id":5,"jsonrpc":"2.0"}`)
+}
@@ -0,0 +1,254 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var jwtHashes = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// JWTVerifier verify the HMAC signed JWT (HS256, HS384 or HS512), it can be
+// used as the Authenticator of WebSocketServer. the token is read from the
+// "Authorization: Bearer" header, or the "token" query parameter. the "sub"
+// claim is the principal name, and the "roles" claim (an array or a space
+// separated string) is the principal roles
+type JWTVerifier struct {
+	secret    []byte
+	issuer    string
+	audience  string
+	clockSkew time.Duration
+	queryName string
+	fnTimeNow func() time.Time
+	sync.Mutex
+}
+
+// NewJWTVerifier create a JWTVerifier by the HMAC secret. the secret must not
+// be empty, otherwise all the tokens are rejected, because everyone can sign
+// the token by an empty secret
+func NewJWTVerifier(secret []byte) *JWTVerifier {
+	return &JWTVerifier{
+		secret:    append([]byte(nil), secret...),
+		clockSkew: 0,
+		queryName: "token",
+		fnTimeNow: time.Now,
+	}
+}
+
+// SetIssuer require the "iss" claim to be issuer, "" does not check it
+func (p *JWTVerifier) SetIssuer(issuer string) *JWTVerifier {
+	p.Lock()
+	p.issuer = issuer
+	p.Unlock()
+	return p
+}
+
+// SetAudience require the "aud" claim to contain audience, "" does not check
+// it
+func (p *JWTVerifier) SetAudience(audience string) *JWTVerifier {
+	p.Lock()
+	p.audience = audience
+	p.Unlock()
+	return p
+}
+
+// SetClockSkew set the tolerance of the "exp" and "nbf" claims
+func (p *JWTVerifier) SetClockSkew(clockSkew time.Duration) *JWTVerifier {
+	p.Lock()
+	p.clockSkew = clockSkew
+	p.Unlock()
+	return p
+}
+
+// SetQueryName set the query parameter which the token is read from, ""
+// only reads the token from the header
+func (p *JWTVerifier) SetQueryName(queryName string) *JWTVerifier {
+	p.Lock()
+	p.queryName = queryName
+	p.Unlock()
+	return p
+}
+
+func newJWTError(message string) Error {
+	return NewErrorByKind(ErrorKindUnauthenticated, "jwt: "+message, nil)
+}
+
+func decodeJWTPart(part string, v interface{}) bool {
+	bytes, err := base64.RawURLEncoding.DecodeString(part)
+	return err == nil && json.Unmarshal(bytes, v) == nil
+}
+
+// Verify verify the signature and the claims of the token, it returns the
+// claims if the token is valid
+func (p *JWTVerifier) Verify(token string) (map[string]interface{}, Error) {
+	p.Lock()
+	secret, issuer, audience := p.secret, p.issuer, p.audience
+	clockSkew, now := p.clockSkew, p.fnTimeNow()
+	p.Unlock()
+
+	if len(secret) == 0 {
+		return nil, newJWTError("secret is empty")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, newJWTError("token format error")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if !decodeJWTPart(parts[0], &header) {
+		return nil, newJWTError("token header format error")
+	}
+
+	fnHash, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, newJWTError(
+			fmt.Sprintf("token algorithm %s is not supported", header.Alg),
+		)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, newJWTError("token signature format error")
+	}
+	mac := hmac.New(fnHash, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, newJWTError("token signature is invalid")
+	}
+
+	claims := map[string]interface{}(nil)
+	if !decodeJWTPart(parts[1], &claims) || claims == nil {
+		return nil, newJWTError("token claims format error")
+	}
+
+	nowSecond := float64(now.UnixNano()) / float64(time.Second)
+	skewSecond := float64(clockSkew) / float64(time.Second)
+	if v, ok := claims["exp"]; ok {
+		if exp, ok := v.(float64); !ok {
+			return nil, newJWTError("token exp claim format error")
+		} else if nowSecond > exp+skewSecond {
+			return nil, newJWTError("token is expired")
+		}
+	}
+	if v, ok := claims["nbf"]; ok {
+		if nbf, ok := v.(float64); !ok {
+			return nil, newJWTError("token nbf claim format error")
+		} else if nowSecond < nbf-skewSecond {
+			return nil, newJWTError("token is not valid yet")
+		}
+	}
+
+	if issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != issuer {
+			return nil, newJWTError("token issuer is invalid")
+		}
+	}
+
+	if audience != "" && !isJWTAudienceMatched(claims["aud"], audience) {
+		return nil, newJWTError("token audience is invalid")
+	}
+
+	return claims, nil
+}
+
+func isJWTAudienceMatched(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getToken read the token from the header or the query of the request
+func (p *JWTVerifier) getToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	p.Lock()
+	queryName := p.queryName
+	p.Unlock()
+	if queryName != "" && req.URL != nil {
+		return req.URL.Query().Get(queryName)
+	}
+	return ""
+}
+
+// Authenticate verify the token of the request, and create the principal by
+// the claims
+func (p *JWTVerifier) Authenticate(req *http.Request) (*Principal, Error) {
+	if req == nil {
+		return nil, newJWTError("request is nil")
+	}
+
+	token := p.getToken(req)
+	if token == "" {
+		return nil, newJWTError("token is missing")
+	}
+
+	claims, err := p.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPrincipalByClaims(claims), nil
+}
+
+func newPrincipalByClaims(claims map[string]interface{}) *Principal {
+	ret := &Principal{
+		Roles:      make([]string, 0),
+		Attributes: make(map[string]string),
+		Claims:     claims,
+	}
+	ret.Name, _ = claims["sub"].(string)
+
+	switch roles := claims["roles"].(type) {
+	case string:
+		ret.Roles = append(ret.Roles, strings.Fields(roles)...)
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				ret.Roles = append(ret.Roles, s)
+			}
+		}
+	}
+
+	for key, value := range claims {
+		if s, ok := value.(string); ok {
+			ret.Attributes[key] = s
+		}
+	}
+
+	return ret
+}
+
+// Claims get the JWT claims of the caller connection, it returns nil if the
+// connection is not authenticated by JWT
+func (p *rpcContext) Claims() map[string]interface{} {
+	if principal := p.Principal(); principal != nil {
+		return principal.Claims
+	}
+	return nil
+}
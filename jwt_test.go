@@ -0,0 +1,222 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestJWT(alg string, secret string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	fnHash, ok := jwtHashes[alg]
+	if !ok {
+		fnHash = sha256.New
+	}
+	mac := hmac.New(fnHash, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	assert := newAssert(t)
+
+	now := time.Unix(1600000000, 0)
+	verifier := NewJWTVerifier([]byte("secret"))
+	verifier.fnTimeNow = func() time.Time { return now }
+
+	for _, alg := range []string{"HS256", "HS384", "HS512"} {
+		claims, err := verifier.Verify(newTestJWT(alg, "secret", map[string]interface{}{
+			"sub": "tom",
+		}))
+		assert(err).IsNil()
+		assert(claims).Equals(map[string]interface{}{"sub": "tom"})
+	}
+
+	verifyError := func(token string) string {
+		_, err := verifier.Verify(token)
+		if err == nil {
+			return ""
+		}
+		assert(err.GetKind()).Equals(ErrorKindUnauthenticated)
+		return err.GetMessage()
+	}
+
+	assert(verifyError("a.b")).Equals("jwt: token format error")
+	assert(verifyError("!.b.c")).Equals("jwt: token header format error")
+	assert(verifyError(newTestJWT("none", "secret", nil))).
+		Equals("jwt: token algorithm none is not supported")
+	assert(verifyError(newTestJWT("HS256", "secret", nil) + "!")).
+		Equals("jwt: token signature format error")
+	assert(verifyError(newTestJWT("HS256", "wrong", nil))).
+		Equals("jwt: token signature is invalid")
+	assert(verifyError(newTestJWT("HS256", "secret", nil))).
+		Equals("jwt: token claims format error")
+
+	// exp and nbf
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"exp": "tomorrow",
+	}))).Equals("jwt: token exp claim format error")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"exp": 1599999990,
+	}))).Equals("jwt: token is expired")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"nbf": "tomorrow",
+	}))).Equals("jwt: token nbf claim format error")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"nbf": 1600000010,
+	}))).Equals("jwt: token is not valid yet")
+	verifier.SetClockSkew(20 * time.Second)
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"exp": 1599999990,
+		"nbf": 1600000010,
+	}))).Equals("")
+
+	// iss and aud
+	verifier.SetIssuer("login").SetAudience("rpc")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"iss": "other",
+		"aud": "rpc",
+	}))).Equals("jwt: token issuer is invalid")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"iss": "login",
+		"aud": "other",
+	}))).Equals("jwt: token audience is invalid")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"iss": "login",
+		"aud": []string{"other", "rpc"},
+	}))).Equals("")
+	assert(verifyError(newTestJWT("HS256", "secret", map[string]interface{}{
+		"iss": "login",
+		"aud": "rpc",
+	}))).Equals("")
+}
+
+func TestJWTVerifier_Verify_emptySecret(t *testing.T) {
+	assert := newAssert(t)
+
+	// the token signed by an empty secret is rejected
+	for _, secret := range [][]byte{nil, {}} {
+		verifier := NewJWTVerifier(secret)
+		token := newTestJWT("HS256", "", map[string]interface{}{"sub": "tom"})
+		assert(verifier.Verify(token)).
+			Equals(nil, newJWTError("secret is empty"))
+
+		req := httptest.NewRequest("GET", "/ws", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		assert(verifier.Authenticate(req)).
+			Equals(nil, newJWTError("secret is empty"))
+	}
+}
+
+func TestIsJWTAudienceMatched(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(isJWTAudienceMatched(nil, "rpc")).IsFalse()
+	assert(isJWTAudienceMatched("rpc", "rpc")).IsTrue()
+	assert(isJWTAudienceMatched([]interface{}{int64(3), "rpc"}, "rpc")).IsTrue()
+	assert(isJWTAudienceMatched([]interface{}{"other"}, "rpc")).IsFalse()
+}
+
+func TestJWTVerifier_Authenticate(t *testing.T) {
+	assert := newAssert(t)
+
+	verifier := NewJWTVerifier([]byte("secret"))
+	token := newTestJWT("HS256", "secret", map[string]interface{}{
+		"sub":   "tom",
+		"roles": []string{"user", "admin"},
+		"email": "tom@example.com",
+	})
+
+	assert(verifier.Authenticate(nil)).
+		Equals(nil, newJWTError("request is nil"))
+	assert(verifier.Authenticate(httptest.NewRequest("GET", "/ws", nil))).
+		Equals(nil, newJWTError("token is missing"))
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	principal, err := verifier.Authenticate(req)
+	assert(err).IsNil()
+	assert(principal.Name).Equals("tom")
+	assert(principal.Roles).Equals([]string{"user", "admin"})
+	assert(principal.Attributes).Equals(map[string]string{
+		"sub":   "tom",
+		"email": "tom@example.com",
+	})
+	assert(principal.Claims["email"]).Equals("tom@example.com")
+
+	principal, err = verifier.Authenticate(
+		httptest.NewRequest("GET", "/ws?token="+token, nil),
+	)
+	assert(err).IsNil()
+	assert(principal.Name).Equals("tom")
+
+	verifier.SetQueryName("")
+	assert(verifier.Authenticate(
+		httptest.NewRequest("GET", "/ws?token="+token, nil),
+	)).Equals(nil, newJWTError("token is missing"))
+
+	req = httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+newTestJWT("HS256", "x", nil))
+	assert(verifier.Authenticate(req)).
+		Equals(nil, newJWTError("token signature is invalid"))
+
+	// used as the authenticator of server
+	server := NewWebSocketServer(nil)
+	server.SetAuthenticator(verifier)
+	recorder := httptest.NewRecorder()
+	assert(server.authenticate(recorder, httptest.NewRequest("GET", "/ws", nil))).
+		Equals(nil, false)
+	assert(recorder.Code).Equals(http.StatusUnauthorized)
+}
+
+func TestNewPrincipalByClaims(t *testing.T) {
+	assert := newAssert(t)
+
+	principal := newPrincipalByClaims(map[string]interface{}{
+		"sub":   "tom",
+		"roles": "user admin",
+		"age":   float64(18),
+	})
+	assert(principal.Name).Equals("tom")
+	assert(principal.Roles).Equals([]string{"user", "admin"})
+	assert(principal.Attributes).Equals(map[string]string{
+		"sub":   "tom",
+		"roles": "user admin",
+	})
+
+	principal = newPrincipalByClaims(map[string]interface{}{
+		"roles": []interface{}{"user", float64(3)},
+	})
+	assert(principal.Name).Equals("")
+	assert(principal.Roles).Equals([]string{"user"})
+}
+
+func TestRpcContext_Claims(t *testing.T) {
+	assert := newAssert(t)
+
+	assert((&rpcContext{thread: nil}).Claims()).IsNil()
+
+	conn := &testServerConn{principal: &Principal{
+		Claims: map[string]interface{}{"sub": "tom"},
+	}}
+	processor := newTestProcessor(nil)
+	processor.getConn = func(connID uint32) rpcServerConn {
+		return conn
+	}
+	assert(processor.AddService("user", NewService().
+		Echo("sub", true, func(ctx Context) Return {
+			return ctx.OK(ctx.Claims()["sub"])
+		}), "")).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	assert(processor.call("$.user:sub")).Equals("tom", nil)
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ClientCertMapper map the verified client certificate to the principal of
+// the connection
+type ClientCertMapper func(cert *x509.Certificate) *Principal
+
+// SetClientCertAuth make the TLS server verify the client certificates by
+// the CAs in the PEM files. if required is false, the clients without
+// certificate are accepted too. the verified certificate is mapped to the
+// principal of the connection, unless the Authenticator gives one. it must
+// be called before the server is started
+func (p *WebSocketServer) SetClientCertAuth(
+	required bool,
+	caFiles ...string,
+) Error {
+	if len(caFiles) == 0 {
+		return NewError("tls: client CA file is empty")
+	}
+
+	pool := x509.NewCertPool()
+	for _, file := range caFiles {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return NewErrorBySystemError(err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return NewError(fmt.Sprintf("tls: client CA file %s is illegal", file))
+		}
+	}
+
+	p.Lock()
+	p.clientCAs = pool
+	p.clientAuth = tls.VerifyClientCertIfGiven
+	if required {
+		p.clientAuth = tls.RequireAndVerifyClientCert
+	}
+	p.Unlock()
+	return nil
+}
+
+// SetClientCertMapper set the function which map the client certificate to
+// the principal, nil uses the default mapping, see newPrincipalByCert
+func (p *WebSocketServer) SetClientCertMapper(mapper ClientCertMapper) {
+	p.Lock()
+	p.clientCertMapper = mapper
+	p.Unlock()
+}
+
+// getServeTLSConfig get the tls.Config which the server is started with
+func (p *WebSocketServer) getServeTLSConfig() *tls.Config {
+	p.Lock()
+	defer p.Unlock()
+	if p.tlsConfig == nil || p.clientCAs == nil {
+		return p.tlsConfig
+	}
+	ret := p.tlsConfig.Clone()
+	ret.ClientCAs = p.clientCAs
+	ret.ClientAuth = p.clientAuth
+	return ret
+}
+
+// getClientCertPrincipal map the verified client certificate of the request
+// to the principal, it returns nil if there is no verified certificate
+func (p *WebSocketServer) getClientCertPrincipal(req *http.Request) *Principal {
+	cert := getVerifiedClientCert(req.TLS)
+	if cert == nil {
+		return nil
+	}
+
+	p.Lock()
+	mapper := p.clientCertMapper
+	p.Unlock()
+	if mapper == nil {
+		mapper = newPrincipalByCert
+	}
+	return mapper(cert)
+}
+
+func getVerifiedClientCert(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil ||
+		len(state.VerifiedChains) == 0 ||
+		len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// newPrincipalByCert is the default ClientCertMapper. the principal name is
+// the subject common name, the roles are the subject organizational units,
+// and the attributes have the subject, the SHA-256 fingerprint and the SANs
+func newPrincipalByCert(cert *x509.Certificate) *Principal {
+	fingerprint := sha256.Sum256(cert.Raw)
+	ips := make([]string, 0, len(cert.IPAddresses))
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	uris := make([]string, 0, len(cert.URIs))
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	return &Principal{
+		Name:  cert.Subject.CommonName,
+		Roles: append([]string(nil), cert.Subject.OrganizationalUnit...),
+		Attributes: map[string]string{
+			"subject":     cert.Subject.String(),
+			"fingerprint": hex.EncodeToString(fingerprint[:]),
+			"dnsNames":    strings.Join(cert.DNSNames, ","),
+			"emails":      strings.Join(cert.EmailAddresses, ","),
+			"ips":         strings.Join(ips, ","),
+			"uris":        strings.Join(uris, ","),
+		},
+	}
+}
+
+// ClientCert get the verified TLS client certificate of the caller
+// connection, it returns nil if there is no verified certificate
+func (p *rpcContext) ClientCert() *x509.Certificate {
+	if info := p.ConnInfo(); info != nil {
+		return getVerifiedClientCert(info.TLS)
+	}
+	return nil
+}
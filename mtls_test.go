@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWebSocketServer_SetClientCertAuth(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-mtls")
+	defer os.RemoveAll(dir)
+	caFile, keyFile := writeTestCert(dir, "ca", "client")
+
+	server := NewWebSocketServer(nil)
+	assert(server.SetClientCertAuth(true).GetMessage()).
+		Equals("tls: client CA file is empty")
+	assert(server.SetClientCertAuth(true, path.Join(dir, "none.crt"))).
+		IsNotNil()
+	assert(server.SetClientCertAuth(true, keyFile).GetMessage()).Equals(
+		"tls: client CA file " + keyFile + " is illegal",
+	)
+
+	// without TLS, the client CAs are not used
+	assert(server.SetClientCertAuth(true, caFile)).IsNil()
+	assert(server.getServeTLSConfig()).IsNil()
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	server.SetTLSConfig(tlsConfig)
+	config := server.getServeTLSConfig()
+	assert(config == tlsConfig).IsFalse()
+	assert(config.ClientAuth).Equals(tls.RequireAndVerifyClientCert)
+	assert(config.ClientCAs).IsNotNil()
+	assert(tlsConfig.ClientCAs).IsNil()
+
+	assert(server.SetClientCertAuth(false, caFile)).IsNil()
+	assert(server.getServeTLSConfig().ClientAuth).
+		Equals(tls.VerifyClientCertIfGiven)
+}
+
+func TestNewPrincipalByCert(t *testing.T) {
+	assert := newAssert(t)
+
+	uri, _ := url.Parse("spiffe://example.com/worker")
+	cert := &x509.Certificate{
+		Raw: []byte("raw"),
+		Subject: pkix.Name{
+			CommonName:         "worker",
+			OrganizationalUnit: []string{"admin", "ops"},
+		},
+		DNSNames:       []string{"a.example.com", "b.example.com"},
+		EmailAddresses: []string{"worker@example.com"},
+		URIs:           []*url.URL{uri},
+	}
+
+	principal := newPrincipalByCert(cert)
+	assert(principal.Name).Equals("worker")
+	assert(principal.Roles).Equals([]string{"admin", "ops"})
+	assert(principal.HasRole("ops")).IsTrue()
+	assert(principal.Attributes).Equals(map[string]string{
+		"subject":     "CN=worker,OU=admin+OU=ops",
+		"fingerprint": "d7439bee24773bcbfa2d0a97947ee36227b10d1022b1a55847e928965bb6bfde",
+		"dnsNames":    "a.example.com,b.example.com",
+		"emails":      "worker@example.com",
+		"ips":         "",
+		"uris":        "spiffe://example.com/worker",
+	})
+}
+
+func TestWebSocketServer_getClientCertPrincipal(t *testing.T) {
+	assert := newAssert(t)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "worker"}}
+	verified := &http.Request{TLS: &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	}}
+
+	server := NewWebSocketServer(nil)
+	assert(server.getClientCertPrincipal(&http.Request{})).IsNil()
+	assert(server.getClientCertPrincipal(&http.Request{
+		TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+	})).IsNil()
+	assert(server.getClientCertPrincipal(verified).Name).Equals("worker")
+
+	server.SetClientCertMapper(func(cert *x509.Certificate) *Principal {
+		return &Principal{Name: "mapped-" + cert.Subject.CommonName}
+	})
+	assert(server.getClientCertPrincipal(verified).Name).
+		Equals("mapped-worker")
+	server.SetClientCertMapper(nil)
+	assert(server.getClientCertPrincipal(verified).Name).Equals("worker")
+}
+
+func TestRpcContext_ClientCert(t *testing.T) {
+	assert := newAssert(t)
+
+	assert((&rpcContext{thread: nil}).ClientCert()).IsNil()
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "worker"}}
+	assert(getVerifiedClientCert(nil)).IsNil()
+	assert(getVerifiedClientCert(&tls.ConnectionState{})).IsNil()
+	assert(getVerifiedClientCert(&tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{}},
+	})).IsNil()
+	assert(getVerifiedClientCert(&tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{cert}},
+	}) == cert).IsTrue()
+}
+
+func TestWebSocketServer_MutualTLS(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-mtls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(dir, "server", "localhost")
+	clientCertFile, clientKeyFile := writeTestCert(dir, "client", "worker")
+	otherCertFile, otherKeyFile := writeTestCert(dir, "other", "other")
+
+	server := NewWebSocketServer(nil)
+	assert(server.SetTLSCertFiles(certFile, keyFile)).IsNil()
+	assert(server.SetClientCertAuth(true, clientCertFile)).IsNil()
+	server.StartBackground("127.0.0.1", 18444, "/ws")
+	defer server.Close()
+
+	dial := func(cert string, key string) error {
+		config, _ := NewClientTLSConfig("localhost", certFile)
+		if cert != "" {
+			pair, _ := tls.LoadX509KeyPair(cert, key)
+			config.Certificates = []tls.Certificate{pair}
+		}
+		client := &WebSocketClient{tlsConfig: config}
+		conn, _, err := client.getDialer().Dial("wss://127.0.0.1:18444/ws", nil)
+		if err == nil {
+			// wait for the connection to be registered
+			_, _, err = conn.ReadMessage()
+			_ = conn.Close()
+		}
+		return err
+	}
+
+	// the client certificate is required
+	assert(dial("", "")).IsNotNil()
+
+	// the client certificate is not trusted
+	assert(dial(otherCertFile, otherKeyFile)).IsNotNil()
+
+	// the client certificate is mapped to the principal
+	principalCH := make(chan *Principal, 1)
+	server.SetClientCertMapper(func(cert *x509.Certificate) *Principal {
+		principal := newPrincipalByCert(cert)
+		principalCH <- principal
+		return principal
+	})
+	assert(dial(clientCertFile, clientKeyFile)).IsNil()
+	principal := <-principalCH
+	assert(principal.Name).Equals("worker")
+	assert(len(principal.Attributes["fingerprint"])).Equals(64)
+}
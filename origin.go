@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SetAllowedOrigins set the origins which can upgrade the websocket. an
+// origin can be exact like "https://example.com", or have a wildcard
+// subdomain like "https://*.example.com", and "*" allows all the origins.
+// if no origin is set, only the same origin is allowed. the requests without
+// Origin header (the non-browser clients) are always allowed
+func (p *WebSocketServer) SetAllowedOrigins(origins ...string) {
+	p.Lock()
+	p.allowedOrigins = append([]string(nil), origins...)
+	p.Unlock()
+}
+
+// SetCheckOrigin set the hook which decide whether the origin of the upgrade
+// request is allowed, it overrides the allowed origins. nil removes the hook
+func (p *WebSocketServer) SetCheckOrigin(fn func(req *http.Request) bool) {
+	p.Lock()
+	p.fnCheckOrigin = fn
+	p.Unlock()
+}
+
+// checkOrigin is the CheckOrigin of the websocket upgrader, it also checks
+// the browser requests of the JSON endpoints
+func (p *WebSocketServer) checkOrigin(req *http.Request) bool {
+	p.Lock()
+	allowedOrigins, fnCheckOrigin := p.allowedOrigins, p.fnCheckOrigin
+	p.Unlock()
+
+	origin := req.Header.Get("Origin")
+	ret := false
+	if fnCheckOrigin != nil {
+		ret = fnCheckOrigin(req)
+	} else if origin == "" {
+		ret = true
+	} else if len(allowedOrigins) == 0 {
+		ret = isSameOrigin(origin, req.Host)
+	} else {
+		ret = isOriginAllowed(origin, allowedOrigins)
+	}
+
+	if !ret {
+		p.logger.Warnf(
+			"WebSocketServer: origin %s of %s is rejected",
+			origin,
+			getRemoteIP(req),
+		)
+	}
+	return ret
+}
+
+func isSameOrigin(origin string, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
+
+func isOriginAllowed(origin string, allowedOrigins []string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range allowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// wildcard subdomain, like "https://*.example.com"
+		if idx := strings.Index(allowed, "://*."); idx >= 0 {
+			scheme, domain := allowed[:idx+3], allowed[idx+4:]
+			if strings.HasPrefix(origin, scheme) &&
+				strings.HasSuffix(origin, domain) &&
+				len(origin) > len(scheme)+len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebSocketServer_checkOrigin(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	logWarnCH := make(chan string, 100)
+	server.GetLogger().Subscribe().Warn = func(msg string) {
+		logWarnCH <- msg
+	}
+	newRequest := func(origin string) *http.Request {
+		req := httptest.NewRequest("GET", "http://rpc.example.com/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return req
+	}
+
+	// same origin by default
+	assert(server.checkOrigin(newRequest(""))).IsTrue()
+	assert(server.checkOrigin(newRequest("http://rpc.example.com"))).IsTrue()
+	assert(server.checkOrigin(newRequest("http://RPC.example.com"))).IsTrue()
+	assert(server.checkOrigin(newRequest("http://evil.com"))).IsFalse()
+	assert(<-logWarnCH).Contains(
+		"WebSocketServer: origin http://evil.com of 192.0.2.1 is rejected",
+	)
+
+	// allowed origins
+	server.SetAllowedOrigins("https://app.example.com", "https://*.test.com")
+	assert(server.checkOrigin(newRequest(""))).IsTrue()
+	assert(server.checkOrigin(newRequest("http://rpc.example.com"))).IsFalse()
+	assert(server.checkOrigin(newRequest("https://app.example.com"))).IsTrue()
+	assert(server.checkOrigin(newRequest("https://a.test.com"))).IsTrue()
+	assert(server.checkOrigin(newRequest("https://a.b.test.com"))).IsTrue()
+	assert(server.checkOrigin(newRequest("https://.test.com"))).IsFalse()
+	assert(server.checkOrigin(newRequest("http://a.test.com"))).IsFalse()
+	assert(server.checkOrigin(newRequest("https://eviltest.com"))).IsFalse()
+	server.SetAllowedOrigins("*")
+	assert(server.checkOrigin(newRequest("http://evil.com"))).IsTrue()
+
+	// custom hook
+	server.SetCheckOrigin(func(req *http.Request) bool {
+		return req.Header.Get("Origin") == "http://hook.com"
+	})
+	assert(server.checkOrigin(newRequest("http://hook.com"))).IsTrue()
+	assert(server.checkOrigin(newRequest("http://evil.com"))).IsFalse()
+	assert(server.checkOrigin(newRequest(""))).IsFalse()
+	server.SetCheckOrigin(nil)
+	server.SetAllowedOrigins()
+	assert(server.checkOrigin(newRequest("http://evil.com"))).IsFalse()
+}
+
+func TestIsSameOrigin(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(isSameOrigin("http://a.com:8080", "a.com:8080")).IsTrue()
+	assert(isSameOrigin("http://a.com:8080", "a.com")).IsFalse()
+	assert(isSameOrigin("://", "a.com")).IsFalse()
+}
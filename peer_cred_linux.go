@@ -0,0 +1,31 @@
+package rpc
+
+import (
+	"net"
+	"syscall"
+)
+
+// getPeerCred get the credentials of the peer process by SO_PEERCRED
+func getPeerCred(conn *net.UnixConn) (*PeerCred, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	ucred := (*syscall.Ucred)(nil)
+	ucredErr := error(nil)
+	if err := rawConn.Control(func(fd uintptr) {
+		ucred, ucredErr = syscall.GetsockoptUcred(
+			int(fd),
+			syscall.SOL_SOCKET,
+			syscall.SO_PEERCRED,
+		)
+	}); err != nil {
+		return nil, err
+	}
+	if ucredErr != nil {
+		return nil, ucredErr
+	}
+
+	return &PeerCred{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package rpc
+
+import (
+	"errors"
+	"net"
+)
+
+// getPeerCred is only supported on linux
+func getPeerCred(_ *net.UnixConn) (*PeerCred, error) {
+	return nil, errors.New("unix: peer credentials are not supported")
+}
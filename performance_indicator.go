@@ -9,6 +9,7 @@ import (
 // rpcPerformanceIndicator ...
 type rpcPerformanceIndicator struct {
 	failed       int64
+	rejected     int64
 	successArray [10]int64
 	lastTotal    int64
 	lastNS       int64
@@ -19,6 +20,7 @@ type rpcPerformanceIndicator struct {
 func newPerformanceIndicator() *rpcPerformanceIndicator {
 	return &rpcPerformanceIndicator{
 		failed:       0,
+		rejected:     0,
 		successArray: [10]int64{},
 		lastTotal:    0,
 		lastNS:       timeNowNS(),
@@ -83,3 +85,14 @@ func (p *rpcPerformanceIndicator) Count(
 		p.originMap.Store(origin, true)
 	}
 }
+
+// CountRejected count the call which is rejected before the handler runs,
+// it is not counted by Count
+func (p *rpcPerformanceIndicator) CountRejected() {
+	atomic.AddInt64(&p.rejected, 1)
+}
+
+// GetRejected get the count of the rejected calls
+func (p *rpcPerformanceIndicator) GetRejected() int64 {
+	return atomic.LoadInt64(&p.rejected)
+}
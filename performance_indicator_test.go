@@ -50,3 +50,12 @@ func TestPerformanceIndicator_basic(t *testing.T) {
 	assert(performanceIndicator.lastTotal).Equals(int64(60000))
 	assert(performanceIndicator.lastNS).Equals(nowNS)
 }
+
+func TestRpcPerformanceIndicator_CountRejected(t *testing.T) {
+	assert := newAssert(t)
+
+	indicator := newPerformanceIndicator()
+	indicator.CountRejected()
+	indicator.CountRejected()
+	assert(indicator.rejected).Equals(int64(2))
+}
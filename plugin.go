@@ -0,0 +1,526 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pluginServiceName is the service which the plugin process describes
+	// its echos by, see ServeStdio. the name is reserved in the plugin
+	// process, the underscore keeps it apart from the usual service names
+	pluginServiceName = "_plugin"
+	pluginExitTimeout = 3 * time.Second
+
+	// the plugin process is restarted after the backoff if it exits in
+	// pluginStableDuration, the backoff doubles until the max
+	pluginStableDuration    = 10 * time.Second
+	pluginRestartMinBackoff = time.Second
+	pluginRestartMaxBackoff = 30 * time.Second
+)
+
+// pipeAddr is the net.Addr of the pipe
+type pipeAddr struct{}
+
+func (p pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (p pipeAddr) String() string {
+	return "pipe"
+}
+
+// pipeConn is the net.Conn over a pair of pipes, like the stdin and stdout of
+// a process. the deadlines are ignored, the pipe is closed if the peer exits
+type pipeConn struct {
+	reader io.ReadCloser
+	writer io.WriteCloser
+}
+
+func newPipeConn(reader io.ReadCloser, writer io.WriteCloser) *pipeConn {
+	return &pipeConn{reader: reader, writer: writer}
+}
+
+func (p *pipeConn) Read(b []byte) (int, error) {
+	return p.reader.Read(b)
+}
+
+func (p *pipeConn) Write(b []byte) (int, error) {
+	return p.writer.Write(b)
+}
+
+func (p *pipeConn) Close() error {
+	err := p.writer.Close()
+	if readErr := p.reader.Close(); err == nil {
+		err = readErr
+	}
+	return err
+}
+
+func (p *pipeConn) LocalAddr() net.Addr {
+	return pipeAddr{}
+}
+
+func (p *pipeConn) RemoteAddr() net.Addr {
+	return pipeAddr{}
+}
+
+func (p *pipeConn) SetDeadline(_ time.Time) error {
+	return nil
+}
+
+func (p *pipeConn) SetReadDeadline(_ time.Time) error {
+	return nil
+}
+
+func (p *pipeConn) SetWriteDeadline(_ time.Time) error {
+	return nil
+}
+
+// ServePipe serve one connection over reader and writer with the stream
+// format of ServeTCP, it blocks until the pipe is closed. the
+// WebSocketServer must be opened by Open (or Start)
+func (p *WebSocketServer) ServePipe(
+	reader io.ReadCloser,
+	writer io.WriteCloser,
+) Error {
+	if !p.isOpened() {
+		return NewError("WebSocketServer: serve pipe error, it is not opened")
+	}
+	p.serveTCPConn(newPipeConn(reader, writer))
+	return nil
+}
+
+// ServeStdio serve the host process over the stdin and stdout, it is called
+// in the main of the plugin process which is started by NewPlugin. it opens
+// the WebSocketServer, blocks until the host closes the pipe, and closes the
+// WebSocketServer. the echos are described to the host by the introspection
+// service mounted at "$._plugin", so the service name "_plugin" is reserved
+// in the plugin process. os.Stdout is redirected to os.Stderr, so that the
+// prints do not break the streams
+func (p *WebSocketServer) ServeStdio() Error {
+	if err := p.processor.AddService(
+		pluginServiceName,
+		NewIntrospectionService(),
+		getStackString(1),
+	); err != nil {
+		return err
+	}
+	if err := p.Open(); err != nil {
+		return err
+	}
+	defer p.Close()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdout = os.Stderr
+	defer func() {
+		os.Stdout = stdout
+	}()
+	return p.ServePipe(stdin, stdout)
+}
+
+// pluginStreamConn is the rpcStreamConn over the stdin and stdout of the
+// plugin process, closing it stops the process. it may be closed by both
+// the client and the read loop, the process is waited once
+type pluginStreamConn struct {
+	*tcpStreamConn
+	cmd       *exec.Cmd
+	logger    *Logger
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (p *pluginStreamConn) Close() error {
+	p.closeOnce.Do(func() {
+		// the process exits if its stdin is closed, or it is killed
+		p.closeErr = p.tcpStreamConn.Close()
+		waitCH := make(chan error, 1)
+		go func() {
+			waitCH <- p.cmd.Wait()
+		}()
+		select {
+		case <-waitCH:
+		case <-time.After(pluginExitTimeout):
+			_ = p.cmd.Process.Kill()
+			<-waitCH
+		}
+
+		if state := p.cmd.ProcessState; state != nil && state.Success() {
+			p.logger.Infof("Plugin: process %d exited", state.Pid())
+		} else if state != nil {
+			p.logger.Warnf(
+				"Plugin: process %d exited: %s",
+				state.Pid(),
+				state.String(),
+			)
+		}
+	})
+	return p.closeErr
+}
+
+// Plugin is implement of INetClient via the stdin and stdout of the plugin
+// process, which serves by ServeStdio. the process is started when the
+// plugin is created, restarted if it exits, and stopped by Close. if the
+// process keeps exiting soon after it starts, the restarts are delayed by
+// the doubling backoff
+type Plugin struct {
+	*rpcClient
+	path        string
+	args        []string
+	logger      *Logger
+	lastStartNS int64
+	backoff     time.Duration
+	closeCH     chan bool
+	closeOnce   sync.Once
+}
+
+// NewPlugin create a Plugin, and start the plugin process by path and args,
+// the stderr of the process is the stderr of the host
+func NewPlugin(path string, args ...string) *Plugin {
+	plugin := &Plugin{
+		path:        path,
+		args:        args,
+		logger:      NewLogger(),
+		lastStartNS: 0,
+		backoff:     0,
+		closeCH:     make(chan bool),
+	}
+	plugin.rpcClient = newRPCClient(plugin.dial)
+	return plugin
+}
+
+// GetLogger get the logger of the Plugin, the starts, exits and restarts of
+// the plugin process are logged
+func (p *Plugin) GetLogger() *Logger {
+	return p.logger
+}
+
+// Close stop the plugin process, and close the Plugin
+func (p *Plugin) Close() Error {
+	p.closeOnce.Do(func() {
+		close(p.closeCH)
+	})
+	return p.rpcClient.Close()
+}
+
+// getPluginRestartBackoff get the wait before restarting the plugin process
+// which lived for lived, last is the previous wait
+func getPluginRestartBackoff(
+	last time.Duration,
+	lived time.Duration,
+) time.Duration {
+	if lived >= pluginStableDuration {
+		return 0
+	} else if last < pluginRestartMinBackoff {
+		return pluginRestartMinBackoff
+	} else if last*2 > pluginRestartMaxBackoff {
+		return pluginRestartMaxBackoff
+	}
+	return last * 2
+}
+
+// dial start the plugin process, it is called by the connect loop only
+func (p *Plugin) dial(
+	query url.Values,
+	readSizeLimit int64,
+) (rpcStreamConn, error) {
+	if p.lastStartNS > 0 {
+		lived := time.Duration(timeNowNS() - p.lastStartNS)
+		p.backoff = getPluginRestartBackoff(p.backoff, lived)
+		if p.backoff > 0 {
+			p.logger.Warnf("Plugin: restart %s in %s", p.path, p.backoff)
+			select {
+			case <-p.closeCH:
+				return nil, errors.New("plugin is closed")
+			case <-time.After(p.backoff):
+			}
+		} else {
+			p.logger.Infof("Plugin: restart %s", p.path)
+		}
+	}
+	p.lastStartNS = timeNowNS()
+
+	cmd, stdin, stdout, err := startPluginProcess(p.path, p.args)
+	if err != nil {
+		p.logger.Errorf("Plugin: start %s error: %s", p.path, err.Error())
+		return nil, err
+	}
+	p.logger.Infof("Plugin: process %d started", cmd.Process.Pid)
+
+	streamConn := &pluginStreamConn{
+		tcpStreamConn: newTCPStreamConn(
+			newPipeConn(stdout, stdin),
+			readSizeLimit,
+		),
+		cmd:    cmd,
+		logger: p.logger,
+	}
+	if err := streamConn.WriteStream([]byte(query.Encode())); err != nil {
+		_ = streamConn.Close()
+		return nil, err
+	}
+	return streamConn, nil
+}
+
+// startPluginProcess start the process with the pipes of stdin and stdout,
+// the stderr of the process is the stderr of the host
+func startPluginProcess(
+	path string,
+	args []string,
+) (*exec.Cmd, io.WriteCloser, io.ReadCloser, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		_ = stdin.Close()
+		return nil, nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		_ = stdin.Close()
+		_ = stdout.Close()
+		return nil, nil, nil, err
+	}
+	return cmd, stdin, stdout, nil
+}
+
+// Service describe the echos of the plugin process under the service path
+// like "$.math", and create the service which forwards the calls to them.
+// the child services are mirrored, and the echos keep their arguments, the
+// rules of the arguments, versions, default versions, aliases and
+// documents, so the callers can not tell the difference. the aliases to the
+// echos of the other services are not mirrored. mount it on the host like
+// this:
+//
+//	service, err := plugin.Service("$.math")
+//	server.AddService("math", service)
+//
+// the calls are made by the host, the authorization belongs to the host
+// service, and the echos which require roles in the plugin are not mounted
+func (p *Plugin) Service(servicePath string) (Service, Error) {
+	ret, err := p.SendMessage(
+		fmt.Sprintf("%s.%s:echos", rootName, pluginServiceName),
+	)
+	if err != nil {
+		return nil, err
+	}
+	echos, ok := ret.(Array)
+	if !ok {
+		return nil, NewError("plugin: echos format error")
+	}
+
+	root := NewService()
+	services := map[string]Service{servicePath: root}
+	mounted := make(map[string]bool)
+	for _, item := range echos {
+		info, ok := item.(Map)
+		if !ok {
+			return nil, NewError("plugin: echos format error")
+		}
+		remotePath, _ := info["path"].(string)
+		pos := strings.LastIndexByte(remotePath, ':')
+		if pos < 0 || mounted[remotePath] ||
+			!strings.HasPrefix(remotePath[:pos], servicePath) {
+			continue
+		}
+		relative := remotePath[len(servicePath):pos]
+		if (relative != "" && relative[0] != '.') ||
+			isPluginServicePath(remotePath[:pos]) {
+			continue
+		}
+		mounted[remotePath] = true
+
+		handler, options, err := p.newForwardHandler(remotePath, info)
+		if err != nil {
+			return nil, err
+		}
+		name := remotePath[pos+1:]
+		if at := strings.IndexByte(name, '@'); at >= 0 {
+			name = name[:at]
+		}
+		export, _ := info["export"].(bool)
+		service := getPluginService(services, remotePath[:pos])
+		service.Echo(name, export, handler, options...)
+
+		// the aliases in the same service are mirrored
+		aliases, _ := info["aliases"].(Array)
+		for _, item := range aliases {
+			aliasPath, _ := item.(string)
+			aliasPos := strings.LastIndexByte(aliasPath, ':')
+			if aliasPos == pos && aliasPath[:pos] == remotePath[:pos] {
+				service.Alias(aliasPath[pos+1:], remotePath[pos+1:])
+			}
+		}
+	}
+	return root, nil
+}
+
+// isPluginServicePath check the service path is the plugin service or its
+// child services
+func isPluginServicePath(servicePath string) bool {
+	pluginPath := rootName + "." + pluginServiceName
+	return servicePath == pluginPath ||
+		strings.HasPrefix(servicePath, pluginPath+".")
+}
+
+// getPluginService get the mirrored service of the service path, the parent
+// services are created if they do not exist
+func getPluginService(
+	services map[string]Service,
+	servicePath string,
+) Service {
+	if service, ok := services[servicePath]; ok {
+		return service
+	}
+	pos := strings.LastIndexByte(servicePath, '.')
+	parent := getPluginService(services, servicePath[:pos])
+	service := NewService()
+	parent.AddService(servicePath[pos+1:], service)
+	services[servicePath] = service
+	return service
+}
+
+// newForwardHandler create the echo handler which forwards the call to the
+// remote echo, and the options which describe the echo like the remote one
+func (p *Plugin) newForwardHandler(
+	remotePath string,
+	info Map,
+) (interface{}, []EchoOption, Error) {
+	args, _ := info["args"].(Array)
+	argTypes := []reflect.Type{contextType}
+	options := make([]EchoOption, 0)
+	for i, item := range args {
+		arg, _ := item.(Map)
+		typeName, _ := arg["type"].(string)
+		argType, ok := getArgTypeByString(typeName)
+		if !ok {
+			return nil, nil, NewError(fmt.Sprintf(
+				"plugin: argument type %s of echo %s is not supported",
+				typeName,
+				remotePath,
+			))
+		}
+		argTypes = append(argTypes, argType)
+		if name, _ := arg["name"].(string); name != "" {
+			doc, _ := arg["doc"].(string)
+			options = append(options, DescribeArg(uint(i+1), name, doc))
+		}
+
+		// the rules are checked by the host too, the invalid calls are not
+		// forwarded
+		rules, _ := arg["rules"].(Array)
+		argRules := make([]ArgRule, 0, len(rules))
+		for _, item := range rules {
+			ruleString, _ := item.(string)
+			rule, ok := parseArgRule(ruleString)
+			if !ok {
+				return nil, nil, NewError(fmt.Sprintf(
+					"plugin: argument rule %s of echo %s is not supported",
+					ruleString,
+					remotePath,
+				))
+			}
+			argRules = append(argRules, rule)
+		}
+		if len(argRules) > 0 {
+			options = append(options, ValidateArg(uint(i+1), argRules...))
+		}
+	}
+	if description, _ := info["description"].(string); description != "" {
+		options = append(options, DescribeEcho(description))
+	}
+	if returnDoc, _ := info["returnDoc"].(string); returnDoc != "" {
+		options = append(options, DescribeReturn(returnDoc))
+	}
+	if version, _ := info["version"].(uint64); version > 0 {
+		options = append(options, EchoVersion(uint(version)))
+	}
+	if isDefault, _ := info["isDefault"].(bool); isDefault {
+		options = append(options, DefaultEchoVersion())
+	}
+
+	handler := reflect.MakeFunc(
+		reflect.FuncOf(argTypes, []reflect.Type{returnType}, false),
+		func(in []reflect.Value) []reflect.Value {
+			ctx := in[0].Interface().(Context)
+			args := make([]interface{}, 0, len(in)-1)
+			for _, arg := range in[1:] {
+				args = append(args, arg.Interface())
+			}
+			ret, err := p.SendMessage(remotePath, args...)
+			if err != nil {
+				return []reflect.Value{reflect.ValueOf(ctx.Error(err))}
+			}
+			return []reflect.Value{reflect.ValueOf(ctx.OK(ret))}
+		},
+	)
+	return handler.Interface(), options, nil
+}
+
+// getArgTypeByString get the argument type by its name like "rpc.Int64"
+func getArgTypeByString(typeName string) (reflect.Type, bool) {
+	for _, argType := range []reflect.Type{
+		boolType, int64Type, uint64Type, float64Type,
+		stringType, bytesType, arrayType, mapType,
+	} {
+		if convertTypeToString(argType) == typeName {
+			return argType, true
+		}
+	}
+	return nil, false
+}
+
+// parseArgRule parse the rule by its description like "range[0, 150]", see
+// the String of ArgRule. the keys of requiredKeys are separated by ", "
+func parseArgRule(ruleString string) (ArgRule, bool) {
+	parseInner := func(prefix string, suffix string) (string, bool) {
+		if strings.HasPrefix(ruleString, prefix) &&
+			strings.HasSuffix(ruleString, suffix) &&
+			len(ruleString) >= len(prefix)+len(suffix) {
+			return ruleString[len(prefix) : len(ruleString)-len(suffix)], true
+		}
+		return "", false
+	}
+
+	if inner, ok := parseInner("range[", "]"); ok {
+		bounds := strings.Split(inner, ", ")
+		if len(bounds) != 2 {
+			return nil, false
+		}
+		min, minErr := strconv.ParseFloat(bounds[0], 64)
+		max, maxErr := strconv.ParseFloat(bounds[1], 64)
+		return RuleRange(min, max), minErr == nil && maxErr == nil
+	} else if inner, ok := parseInner("length[", "]"); ok {
+		bounds := strings.Split(inner, ", ")
+		if len(bounds) != 2 {
+			return nil, false
+		}
+		min, minErr := strconv.Atoi(bounds[0])
+		max, maxErr := strconv.Atoi(bounds[1])
+		return RuleLength(min, max), minErr == nil && maxErr == nil
+	} else if inner, ok := parseInner("regex(", ")"); ok {
+		return RuleRegex(inner), true
+	} else if inner, ok := parseInner("requiredKeys(", ")"); ok {
+		if inner == "" {
+			return RuleRequiredKeys(), true
+		}
+		return RuleRequiredKeys(strings.Split(inner, ", ")...), true
+	} else if inner, ok := parseInner("maxItems(", ")"); ok {
+		max, err := strconv.Atoi(inner)
+		return RuleMaxItems(max), err == nil
+	}
+	return nil, false
+}
@@ -0,0 +1,370 @@
+package rpc
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestPluginProcess is the plugin process of the tests, it is started by
+// NewPlugin with the test binary and the argument "plugin"
+func TestPluginProcess(t *testing.T) {
+	if args := flag.Args(); len(args) != 1 || args[0] != "plugin" {
+		return
+	}
+
+	server := NewWebSocketServer(nil)
+	// the services which the aliases point to are added first
+	server.AddService("other", NewService().
+		Echo("ping", true, func(ctx Context) Return {
+			return ctx.OK("pong")
+		}))
+	// the plugin can have its own service named plugin
+	server.AddService("plugin", NewService().
+		Echo("version", true, func(ctx Context) Return {
+			return ctx.OK("1.0.0")
+		}))
+	server.AddService("math", NewService().
+		Echo("add", true, func(ctx Context, a int64, b int64) Return {
+			return ctx.OK(a + b)
+		}, DescribeArg(1, "a", "the first"), DescribeArg(2, "b", ""),
+			ValidateArg(1, RuleRange(-100, 100))).
+		Echo("pid", false, func(ctx Context) Return {
+			return ctx.OK(int64(os.Getpid()))
+		}).
+		Echo("fail", true, func(ctx Context) Return {
+			return ctx.Error(NewErrorByKind("Failed", "failed", Map{"n": 1}))
+		}).
+		Echo("crash", true, func(ctx Context) Return {
+			os.Exit(1)
+			return ctx.OK(true)
+		}).
+		Echo("secret", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoRequireRoles("admin")).
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(int64(2))
+		}, EchoVersion(2), DefaultEchoVersion(), DescribeEcho("get v2")).
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(int64(3))
+		}, EchoVersion(3)).
+		Alias("plus", "add").
+		Alias("ping", "$.other:ping").
+		AddService("stat", NewService().
+			Echo("avg", true, func(ctx Context, values Array) Return {
+				return ctx.OK(float64(len(values)))
+			})))
+	if err := server.ServeStdio(); err != nil {
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func newTestPlugin() *Plugin {
+	return NewPlugin(os.Args[0], "-test.run=^TestPluginProcess$", "--", "plugin")
+}
+
+func TestPipeConn(t *testing.T) {
+	assert := newAssert(t)
+
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	server := newPipeConn(serverReader, serverWriter)
+	client := newPipeConn(clientReader, clientWriter)
+	assert(server.LocalAddr().Network(), server.RemoteAddr().String()).
+		Equals("pipe", "pipe")
+	assert(server.SetDeadline(time.Now())).IsNil()
+	assert(server.SetReadDeadline(time.Now())).IsNil()
+	assert(server.SetWriteDeadline(time.Now())).IsNil()
+
+	go func() {
+		_, _ = client.Write([]byte("hello"))
+	}()
+	buf := make([]byte, 5)
+	assert(io.ReadFull(server, buf)).Equals(5, nil)
+	assert(buf).Equals([]byte("hello"))
+
+	assert(server.Close()).IsNil()
+	_, err := client.Write([]byte("hello"))
+	assert(err).Equals(io.ErrClosedPipe)
+	assert(client.Close()).IsNil()
+}
+
+func TestWebSocketServer_ServePipe(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}))
+
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	assert(server.ServePipe(serverReader, serverWriter).GetMessage()).
+		Equals("WebSocketServer: serve pipe error, it is not opened")
+
+	assert(server.Open()).IsNil()
+	defer server.Close()
+	doneCH := make(chan Error, 1)
+	go func() {
+		doneCH <- server.ServePipe(serverReader, serverWriter)
+	}()
+
+	conn := newTCPStreamConn(newPipeConn(clientReader, clientWriter), 1024)
+	assert(conn.WriteStream([]byte(url.Values{}.Encode() + "a=b"))).IsNil()
+	_, err := conn.ReadStream(time.Second)
+	assert(err).IsNil()
+
+	// ServePipe returns when the pipe is closed
+	assert(conn.Close()).IsNil()
+	assert(<-doneCH).IsNil()
+}
+
+func TestGetArgTypeByString(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(getArgTypeByString("rpc.Int64")).Equals(int64Type, true)
+	assert(getArgTypeByString("rpc.Map")).Equals(mapType, true)
+	argType, ok := getArgTypeByString("rpc.Context")
+	assert(argType == nil, ok).Equals(true, false)
+}
+
+func TestParseArgRule(t *testing.T) {
+	assert := newAssert(t)
+
+	for _, rule := range []ArgRule{
+		RuleRange(-1.5, 100),
+		RuleLength(0, 10),
+		RuleRegex("^[a-z]+(, [0-9])?$"),
+		RuleRequiredKeys(),
+		RuleRequiredKeys("id", "name"),
+		RuleMaxItems(3),
+	} {
+		parsed, ok := parseArgRule(rule.String())
+		assert(ok).IsTrue()
+		assert(parsed.String()).Equals(rule.String())
+	}
+
+	for _, ruleString := range []string{
+		"",
+		"range[1]",
+		"range[a, 1]",
+		"length[1, 2, 3]",
+		"length[1, b]",
+		"maxItems(x)",
+		"oneOf(1, 2)",
+	} {
+		_, ok := parseArgRule(ruleString)
+		assert(ok).IsFalse()
+	}
+}
+
+func TestIsPluginServicePath(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(isPluginServicePath("$._plugin")).IsTrue()
+	assert(isPluginServicePath("$._plugin.child")).IsTrue()
+	assert(isPluginServicePath("$._plugins")).IsFalse()
+	assert(isPluginServicePath("$.plugin")).IsFalse()
+	assert(isPluginServicePath("$")).IsFalse()
+}
+
+func TestGetPluginRestartBackoff(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(getPluginRestartBackoff(0, pluginStableDuration)).
+		Equals(time.Duration(0))
+	assert(getPluginRestartBackoff(8*time.Second, time.Hour)).
+		Equals(time.Duration(0))
+	assert(getPluginRestartBackoff(0, 0)).Equals(time.Second)
+	assert(getPluginRestartBackoff(time.Second, time.Second)).
+		Equals(2 * time.Second)
+	assert(getPluginRestartBackoff(16*time.Second, 0)).
+		Equals(30 * time.Second)
+	assert(getPluginRestartBackoff(30*time.Second, 0)).
+		Equals(30 * time.Second)
+}
+
+// subscribePluginLogs collect the logs of the plugin
+func subscribePluginLogs(plugin *Plugin) func() []string {
+	mutex := &sync.Mutex{}
+	logs := make([]string, 0)
+	onLog := func(msg string) {
+		mutex.Lock()
+		logs = append(logs, strings.TrimSpace(msg[strings.Index(msg, " ")+1:]))
+		mutex.Unlock()
+	}
+	subscription := plugin.GetLogger().Subscribe()
+	subscription.Info = onLog
+	subscription.Warn = onLog
+	subscription.Error = onLog
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), logs...)
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	assert := newAssert(t)
+
+	plugin := newTestPlugin()
+	defer plugin.Close()
+	getLogs := subscribePluginLogs(plugin)
+
+	assert(plugin.SendMessage("$.math:add", int64(1), int64(2))).
+		Equals(int64(3), nil)
+
+	// mount the echos of the plugin on the host
+	service, err := plugin.Service("$.math")
+	assert(err).IsNil()
+	server := NewWebSocketServer(nil)
+	server.AddService("calc", service)
+	assert(server.Open()).IsNil()
+	defer server.Close()
+
+	client := NewInProcessClient(server, url.Values{})
+	defer client.Close()
+	assert(client.SendMessage("$.calc:add", int64(1), int64(2))).
+		Equals(int64(3), nil)
+	assert(client.SendMessage("$.calc.stat:avg", Array{1, 2})).
+		Equals(float64(2), nil)
+	assert(client.SendMessage("$.calc:get@2")).Equals(int64(2), nil)
+	assert(client.SendMessage("$.calc:get@3")).Equals(int64(3), nil)
+	assert(client.SendMessage("$.calc:get")).Equals(int64(2), nil)
+	assert(client.SendMessage("$.calc:plus", int64(1), int64(2))).
+		Equals(int64(3), nil)
+	_, err = client.SendMessage("$.calc:ping")
+	assert(err).IsNotNil()
+	_, err = client.SendMessage("$.calc:fail")
+	assert(err.GetMessage(), err.GetKind(), err.GetDetails()).
+		Equals("failed", "Failed", Map{"n": int64(1)})
+	_, err = client.SendMessage("$.calc:add", "1", int64(2))
+	assert(strings.Contains(err.GetMessage(), "$.calc:add")).IsTrue()
+	_, err = client.SendMessage("$.calc:secret")
+	assert(err).IsNotNil()
+	// the rules of the arguments are checked by the host
+	_, err = client.SendMessage("$.calc:add", int64(1000), int64(2))
+	assert(err.GetKind(), err.GetDetails()["path"]).
+		Equals(ErrorKindInvalidArgs, "$.calc:add")
+
+	// the echos keep the descriptions
+	echos := server.processor.getEchosInfo(nil)
+	paths := make([]string, 0)
+	for _, echo := range echos {
+		paths = append(paths, echo.(Map)["path"].(string))
+	}
+	assert(paths).Equals([]string{
+		"$.calc.stat:avg",
+		"$.calc:add",
+		"$.calc:crash",
+		"$.calc:fail",
+		"$.calc:get@2",
+		"$.calc:get@3",
+		"$.calc:pid",
+	})
+	add, _ := server.processor.getEchoNode("$.calc:add")
+	assert(add.getInfo()["args"]).Equals(Array{
+		Map{
+			"name":  "a",
+			"type":  "rpc.Int64",
+			"doc":   "the first",
+			"rules": Array{"range[-100, 100]"},
+		},
+		Map{"name": "b", "type": "rpc.Int64", "doc": "", "rules": Array{}},
+	})
+	pid, _ := server.processor.getEchoNode("$.calc:pid")
+	assert(pid.echoMeta.export).IsFalse()
+	get, _ := server.processor.getEchoNode("$.calc:get@2")
+	assert(get.echoMeta.description).Equals("get v2")
+
+	// the plugin process is restarted if it exits
+	pid1, err := client.SendMessage("$.calc:pid")
+	assert(err).IsNil()
+	atomic.StoreInt64(&plugin.msgTimeoutNS, int64(500*time.Millisecond))
+	_, err = plugin.SendMessage("$.math:crash")
+	assert(err.GetMessage()).Equals("timeout")
+	pid2 := interface{}(nil)
+	for i := 0; i < 20 && pid2 == nil; i++ {
+		pid2, _ = client.SendMessage("$.calc:pid")
+	}
+	assert(pid2).IsNotNil()
+	assert(pid1 != pid2).IsTrue()
+	atomic.StoreInt64(&plugin.msgTimeoutNS, int64(20*time.Second))
+	assert(client.SendMessage("$.calc:add", int64(3), int64(4))).
+		Equals(int64(7), nil)
+
+	// the exit and the restart are logged, the restart is delayed because the
+	// process exits soon after it starts
+	logs := strings.Join(getLogs(), "\n")
+	assert(strings.Contains(
+		logs,
+		fmt.Sprintf("Warn: Plugin: process %d exited: exit status 1", pid1),
+	)).IsTrue()
+	assert(strings.Contains(
+		logs,
+		fmt.Sprintf("Warn: Plugin: restart %s in 1s", os.Args[0]),
+	)).IsTrue()
+	assert(strings.Contains(
+		logs,
+		fmt.Sprintf("Info: Plugin: process %d started", pid2),
+	)).IsTrue()
+
+	// the plugin process is stopped by Close
+	assert(plugin.Close()).IsNil()
+	assert(plugin.Close()).IsNotNil()
+}
+
+func TestPlugin_Service(t *testing.T) {
+	assert := newAssert(t)
+
+	plugin := newTestPlugin()
+	defer plugin.Close()
+
+	// mount the whole tree without the plugin service
+	service, err := plugin.Service("$")
+	assert(err).IsNil()
+	server := NewWebSocketServer(nil)
+	server.AddService("remote", service)
+	_, ok := server.processor.getEchoNode("$.remote.other:ping")
+	assert(ok).IsTrue()
+	_, ok = server.processor.getEchoNode("$.remote.math.stat:avg")
+	assert(ok).IsTrue()
+	_, ok = server.processor.getEchoNode("$.remote._plugin:echos")
+	assert(ok).IsFalse()
+	_, ok = server.processor.getEchoNode("$.remote.plugin:version")
+	assert(ok).IsTrue()
+
+	// the reserved service name of the plugin process is occupied
+	occupied := NewWebSocketServer(nil)
+	occupied.AddService(pluginServiceName, NewService())
+	assert(occupied.ServeStdio()).IsNotNil()
+
+	// the service path does not match the prefix of the other services
+	service, err = plugin.Service("$.mat")
+	assert(err).IsNil()
+	server = NewWebSocketServer(nil)
+	server.AddService("remote", service)
+	assert(len(server.processor.getEchosInfo(nil))).Equals(0)
+
+	// the plugin process can not be started
+	plugin = NewPlugin("/not/exist")
+	getLogs := subscribePluginLogs(plugin)
+	atomic.StoreInt64(&plugin.msgTimeoutNS, int64(200*time.Millisecond))
+	_, err = plugin.Service("$")
+	assert(err.GetMessage()).Equals("timeout")
+	assert(plugin.Close()).IsNil()
+	assert(len(getLogs()) > 0).IsTrue()
+	assert(strings.HasPrefix(
+		getLogs()[0],
+		"Error: Plugin: start /not/exist error: ",
+	)).IsTrue()
+}
@@ -26,21 +26,39 @@ var (
 )
 
 type rpcEchoNode struct {
-	serviceNode *rpcServiceNode
-	path        string
-	echoMeta    *rpcEchoMeta
-	cacheFN     FuncCacheType
-	reflectFn   reflect.Value
-	callString  string
-	debugString string
-	argTypes    []reflect.Type
-	indicator   *rpcPerformanceIndicator
+	retryAfterNS    int64
+	deprecatedCalls int64
+	status          int32
+	serviceNode     *rpcServiceNode
+	path            string
+	echoMeta        *rpcEchoMeta
+	handler         interface{}
+	cacheFN         FuncCacheType
+	reflectFn       reflect.Value
+	callString      string
+	debugString     string
+	argTypes        []reflect.Type
+	argNames        []string
+	argDocs         []string
+	argRules        [][]ArgRule
+	indicator       *rpcPerformanceIndicator
+	bulkhead        *rpcBulkhead
+	rateLimiter     *rpcRateLimiter
+	requiredRoles   [][]string
+	isFallback      bool
+}
+
+type rpcAliasNode struct {
+	path       string
+	targetPath string
+	debug      string
 }
 
 type rpcServiceNode struct {
 	path    string
 	addMeta *rpcNodeMeta
 	depth   uint
+	policy  *rpcServicePolicy
 }
 
 // rpcProcessor ...
@@ -49,7 +67,11 @@ type rpcProcessor struct {
 	logger       *Logger
 	fnCache      FuncCache
 	callback     fnProcessorCallback
+	getConn      fnGetServerConn
 	echosMap     map[string]*rpcEchoNode
+	versionsMap  map[string]*rpcEchoNode
+	aliasesMap   map[string]*rpcAliasNode
+	fallbacksMap map[string]*rpcEchoNode
 	nodesMap     map[string]*rpcServiceNode
 	threadPools  []*rpcThreadPool
 	maxNodeDepth uint64
@@ -83,6 +105,9 @@ func newRPCProcessor(
 		fnCache:      fnCache,
 		callback:     callback,
 		echosMap:     make(map[string]*rpcEchoNode),
+		versionsMap:  make(map[string]*rpcEchoNode),
+		aliasesMap:   make(map[string]*rpcAliasNode),
+		fallbacksMap: make(map[string]*rpcEchoNode),
 		nodesMap:     make(map[string]*rpcServiceNode),
 		threadPools:  make([]*rpcThreadPool, numOfThreadPool, numOfThreadPool),
 		maxNodeDepth: uint64(maxNodeDepth),
@@ -149,7 +174,7 @@ func (p *rpcProcessor) PutStream(stream *rpcStream) bool {
 func (p *rpcProcessor) BuildCache(pkgName string, path string) error {
 	retMap := make(map[string]bool)
 	for _, echo := range p.echosMap {
-		if fnTypeString, ok := getFuncKind(echo.echoMeta.handler); ok {
+		if fnTypeString, ok := getFuncKind(echo.handler); ok {
 			retMap[fnTypeString] = true
 		}
 	}
@@ -176,11 +201,58 @@ func (p *rpcProcessor) AddService(
 		)
 	}
 
-	return p.mountNode(rootName, &rpcNodeMeta{
+	// the mounted part of the service is removed if it fails
+	servicePath := rootName + "." + name
+	_, isOccupied := p.nodesMap[servicePath]
+	err := p.mountNode(rootName, &rpcNodeMeta{
 		name:        name,
 		serviceMeta: serviceMeta,
 		debug:       debug,
 	})
+	if err == nil {
+		err = p.checkAliases(servicePath)
+	}
+	if err != nil && !isOccupied {
+		p.unmountService(servicePath)
+	}
+	return err
+}
+
+// unmountService remove the service and everything beneath it
+func (p *rpcProcessor) unmountService(servicePath string) {
+	for path := range p.nodesMap {
+		if isPathBeneath(path, servicePath) {
+			delete(p.nodesMap, path)
+		}
+	}
+	for path := range p.echosMap {
+		if isPathBeneath(path, servicePath) {
+			delete(p.echosMap, path)
+		}
+	}
+	for path := range p.versionsMap {
+		if isPathBeneath(path, servicePath) {
+			delete(p.versionsMap, path)
+		}
+	}
+	for path := range p.aliasesMap {
+		if isPathBeneath(path, servicePath) {
+			delete(p.aliasesMap, path)
+		}
+	}
+	for path := range p.fallbacksMap {
+		if isPathBeneath(path, servicePath) {
+			delete(p.fallbacksMap, path)
+		}
+	}
+}
+
+// isPathBeneath check the service path or the echo path is the service or
+// beneath it
+func isPathBeneath(path string, servicePath string) bool {
+	return path == servicePath ||
+		strings.HasPrefix(path, servicePath+".") ||
+		strings.HasPrefix(path, servicePath+":")
 }
 
 func (p *rpcProcessor) mountNode(
@@ -243,10 +315,21 @@ func (p *rpcProcessor) mountNode(
 		)
 	}
 
+	policy, err := newServicePolicy(
+		parentNode.policy,
+		servicePath,
+		&nodeMeta.serviceMeta.policy,
+		nodeMeta.debug,
+	)
+	if err != nil {
+		return err
+	}
+
 	node := &rpcServiceNode{
 		path:    servicePath,
 		addMeta: nodeMeta,
 		depth:   parentNode.depth + 1,
+		policy:  policy,
 	}
 
 	// mount the node
@@ -261,6 +344,24 @@ func (p *rpcProcessor) mountNode(
 		}
 	}
 
+	// mount the aliases
+	for _, aliasMeta := range nodeMeta.serviceMeta.aliases {
+		err := p.mountAlias(node, aliasMeta)
+		if err != nil {
+			delete(p.nodesMap, servicePath)
+			return err
+		}
+	}
+
+	// mount the fallback
+	if fallbackMeta := nodeMeta.serviceMeta.fallback; fallbackMeta != nil {
+		err := p.mountFallback(node, fallbackMeta)
+		if err != nil {
+			delete(p.nodesMap, servicePath)
+			return err
+		}
+	}
+
 	// mount children
 	for _, v := range nodeMeta.serviceMeta.children {
 		err := p.mountNode(node.path, v)
@@ -296,8 +397,14 @@ func (p *rpcProcessor) mountEcho(
 	}
 
 	// check the echo path is not occupied
-	echoPath := serviceNode.path + ":" + echoMeta.name
+	echoPath := getEchoPath(serviceNode.path, echoMeta.name, echoMeta.version)
+	conflictDebug := ""
 	if item, ok := p.echosMap[echoPath]; ok {
+		conflictDebug = item.echoMeta.debug
+	} else if item, ok := p.aliasesMap[echoPath]; ok {
+		conflictDebug = item.debug
+	}
+	if conflictDebug != "" {
 		return NewErrorByDebug(
 			fmt.Sprintf(
 				"Echo name %s is duplicated",
@@ -306,7 +413,7 @@ func (p *rpcProcessor) mountEcho(
 			fmt.Sprintf(
 				"Current:\n%s\nConflict:\n%s",
 				addPrefixPerLine(echoMeta.debug, "\t"),
-				addPrefixPerLine(item.echoMeta.debug, "\t"),
+				addPrefixPerLine(conflictDebug, "\t"),
 			),
 		)
 	}
@@ -319,8 +426,17 @@ func (p *rpcProcessor) mountEcho(
 		)
 	}
 
+	// build standard handler from adapted handler
+	handler := echoMeta.handler
+	if adapted, ok := handler.(*rpcAdaptedHandler); ok {
+		var err Error
+		if handler, err = buildAdaptedHandler(adapted, echoMeta.debug); err != nil {
+			return err
+		}
+	}
+
 	// Check echo handler is Func
-	fn := reflect.ValueOf(echoMeta.handler)
+	fn := reflect.ValueOf(handler)
 	if fn.Kind() != reflect.Func {
 		return NewErrorByDebug(
 			fmt.Sprintf(
@@ -376,22 +492,83 @@ func (p *rpcProcessor) mountEcho(
 	}
 
 	argTypes := make([]reflect.Type, fn.Type().NumIn(), fn.Type().NumIn())
-	argStrings := make([]string, fn.Type().NumIn(), fn.Type().NumIn())
 	for i := 0; i < len(argTypes); i++ {
 		argTypes[i] = fn.Type().In(i)
+	}
+
+	// check the arguments documents
+	argNames, argDocs, err := buildArgDocs(
+		echoMeta.argDocs,
+		argTypes,
+		echoMeta.debug,
+	)
+	if err != nil {
+		return err
+	}
+
+	argStrings := make([]string, len(argTypes), len(argTypes))
+	for i := 0; i < len(argTypes); i++ {
 		argStrings[i] = convertTypeToString(argTypes[i])
+		if argNames[i] != "" {
+			argStrings[i] = argNames[i] + " " + argStrings[i]
+		}
 	}
 	argString := strings.Join(argStrings, ", ")
 
+	// check the arguments rules
+	argRules, err := buildArgRules(echoMeta.argRules, argTypes, echoMeta.debug)
+	if err != nil {
+		return err
+	}
+
+	// check the concurrency limit
+	bulkhead := (*rpcBulkhead)(nil)
+	if echoMeta.maxConcurrency < 0 {
+		return NewErrorByDebug(
+			fmt.Sprintf("Echo %s max concurrency is illegal", echoPath),
+			echoMeta.debug,
+		)
+	} else if echoMeta.maxConcurrency > 0 {
+		bulkhead = newBulkhead("echo "+echoPath, echoMeta.maxConcurrency)
+	}
+
+	// check the rate limit
+	rateLimiter := (*rpcRateLimiter)(nil)
+	if echoMeta.rateLimit != 0 || echoMeta.rateBurst != 0 {
+		if echoMeta.rateLimit <= 0 || echoMeta.rateBurst < 1 {
+			return NewErrorByDebug(
+				fmt.Sprintf("Echo %s rate limit is illegal", echoPath),
+				echoMeta.debug,
+			)
+		}
+		rateLimiter = newRateLimiter(echoMeta.rateLimit, echoMeta.rateBurst)
+	}
+
+	// check the required roles
+	if !checkRequiredRoles(echoMeta.requiredRoles) {
+		return NewErrorByDebug(
+			fmt.Sprintf("Echo %s required roles is illegal", echoPath),
+			echoMeta.debug,
+		)
+	}
+	requiredRoles := echoMeta.requiredRoles
+	if serviceNode.policy != nil {
+		requiredRoles = append(
+			append([][]string(nil), serviceNode.policy.requiredRoles...),
+			echoMeta.requiredRoles...,
+		)
+	}
+
 	cacheFN := FuncCacheType(nil)
-	if fnTypeString, ok := getFuncKind(echoMeta.handler); ok && p.fnCache != nil {
+	if fnTypeString, ok := getFuncKind(handler); ok && p.fnCache != nil {
 		cacheFN = p.fnCache.Get(fnTypeString)
 	}
 
-	p.echosMap[echoPath] = &rpcEchoNode{
+	echoNode := &rpcEchoNode{
 		serviceNode: serviceNode,
 		path:        echoPath,
 		echoMeta:    echoMeta,
+		handler:     handler,
 		cacheFN:     cacheFN,
 		reflectFn:   fn,
 		callString: fmt.Sprintf(
@@ -400,15 +577,30 @@ func (p *rpcProcessor) mountEcho(
 			argString,
 			convertTypeToString(returnType),
 		),
-		debugString: fmt.Sprintf("%s %s", echoPath, fileLine),
-		argTypes:    argTypes,
-		indicator:   newPerformanceIndicator(),
+		debugString:   fmt.Sprintf("%s %s", echoPath, fileLine),
+		argTypes:      argTypes,
+		argNames:      argNames,
+		argDocs:       argDocs,
+		argRules:      argRules,
+		indicator:     newPerformanceIndicator(),
+		bulkhead:      bulkhead,
+		rateLimiter:   rateLimiter,
+		requiredRoles: requiredRoles,
+	}
+
+	// update the default version
+	if echoMeta.version > 0 {
+		if err := p.updateDefaultVersion(echoNode); err != nil {
+			return err
+		}
 	}
 
+	p.echosMap[echoPath] = echoNode
+
 	if p.logger != nil {
 		p.logger.Infof(
 			"rpc: mounted %s %s",
-			p.echosMap[echoPath].callString,
+			echoNode.callString,
 			fileLine,
 		)
 	}
@@ -10,6 +10,57 @@ import (
 	"time"
 )
 
+type testProcessor struct {
+	*rpcProcessor
+	retCH chan *rpcStream
+}
+
+func newTestProcessor(logger *Logger) *testProcessor {
+	retCH := make(chan *rpcStream)
+	ret := &testProcessor{
+		rpcProcessor: newRPCProcessor(
+			logger,
+			16,
+			16,
+			func(stream *rpcStream, success bool) {
+				retCH <- stream
+			},
+			nil,
+		),
+		retCH: retCH,
+	}
+	return ret
+}
+
+// call the echo with from "@", and parse the return stream
+func (p *testProcessor) call(path string, args ...interface{}) (Any, Error) {
+	stream := newStream()
+	stream.WriteString(path)
+	stream.WriteUint64(3)
+	stream.WriteString("@")
+	for _, arg := range args {
+		stream.Write(arg)
+	}
+	p.PutStream(stream)
+	return parseTestReturnStream(<-p.retCH)
+}
+
+func parseTestReturnStream(stream *rpcStream) (Any, Error) {
+	success, _ := stream.ReadBool()
+	if success {
+		ret, _ := stream.Read()
+		return ret, nil
+	}
+	message, _ := stream.ReadString()
+	debug, _ := stream.ReadString()
+	if !stream.CanRead() {
+		return nil, NewErrorByDebug(message, debug)
+	}
+	kind, _ := stream.ReadString()
+	details, _ := stream.ReadMap()
+	return nil, NewErrorByKind(kind, message, details)
+}
+
 func TestNewRPCProcessor(t *testing.T) {
 	assert := newAssert(t)
 
@@ -262,10 +313,10 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 
 	// check the name
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"###",
-		true,
-		nil,
-		"DebugMessage",
+		name:    "###",
+		export:  true,
+		handler: nil,
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo name ### is illegal",
 		"DebugMessage",
@@ -273,16 +324,16 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 
 	// check the echo path is not occupied
 	_ = processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testOccupied",
-		true,
-		func(ctx Context) Return { return ctx.OK(true) },
-		"DebugMessage",
+		name:    "testOccupied",
+		export:  true,
+		handler: func(ctx Context) Return { return ctx.OK(true) },
+		debug:   "DebugMessage",
 	})
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testOccupied",
-		true,
-		func(ctx Context) Return { return ctx.OK(true) },
-		"DebugMessage",
+		name:    "testOccupied",
+		export:  true,
+		handler: func(ctx Context) Return { return ctx.OK(true) },
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo name testOccupied is duplicated",
 		"Current:\n\tDebugMessage\nConflict:\n\tDebugMessage",
@@ -290,10 +341,10 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 
 	// check the echo handler is nil
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testEchoHandlerIsNil",
-		true,
-		nil,
-		"DebugMessage",
+		name:    "testEchoHandlerIsNil",
+		export:  true,
+		handler: nil,
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo handler is nil",
 		"DebugMessage",
@@ -301,10 +352,10 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 
 	// Check echo handler is Func
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testEchoHandlerIsFunction",
-		true,
-		make(chan bool),
-		"DebugMessage",
+		name:    "testEchoHandlerIsFunction",
+		export:  true,
+		handler: make(chan bool),
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo handler must be func(ctx rpc.Context, ...) rpc.Return",
 		"DebugMessage",
@@ -312,20 +363,20 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 
 	// Check echo handler arguments types
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testEchoHandlerArguments",
-		true,
-		func(ctx bool) Return { return nilReturn },
-		"DebugMessage",
+		name:    "testEchoHandlerArguments",
+		export:  true,
+		handler: func(ctx bool) Return { return nilReturn },
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo handler 1st argument type must be rpc.Context",
 		"DebugMessage",
 	))
 
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testEchoHandlerArguments",
-		true,
-		func(ctx Context, ch chan bool) Return { return nilReturn },
-		"DebugMessage",
+		name:    "testEchoHandlerArguments",
+		export:  true,
+		handler: func(ctx Context, ch chan bool) Return { return nilReturn },
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo handler 2nd argument type <chan bool> not supported",
 		"DebugMessage",
@@ -333,20 +384,20 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 
 	// Check return type
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testEchoHandlerReturn",
-		true,
-		func(ctx Context) (Return, bool) { return nilReturn, true },
-		"DebugMessage",
+		name:    "testEchoHandlerReturn",
+		export:  true,
+		handler: func(ctx Context) (Return, bool) { return nilReturn, true },
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo handler return type must be rpc.Return",
 		"DebugMessage",
 	))
 
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testEchoHandlerReturn",
-		true,
-		func(ctx Context) bool { return true },
-		"DebugMessage",
+		name:    "testEchoHandlerReturn",
+		export:  true,
+		handler: func(ctx Context) bool { return true },
+		debug:   "DebugMessage",
 	})).Equals(NewErrorByDebug(
 		"Echo handler return type must be rpc.Return",
 		"DebugMessage",
@@ -360,10 +411,10 @@ func TestRPCProcessor_mountEcho(t *testing.T) {
 		infoCH <- msg
 	}
 	assert(processor.mountEcho(rootNode, &rpcEchoMeta{
-		"testOK",
-		true,
-		func(ctx Context, _ bool, _ Map) Return { return nilReturn },
-		getStackString(0),
+		name:    "testOK",
+		export:  true,
+		handler: func(ctx Context, _ bool, _ Map) Return { return nilReturn },
+		debug:   getStackString(0),
 	})).IsNil()
 
 	assert(processor.echosMap["$:testOK"].serviceNode).
@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// ErrorKindRateLimited the call is rejected by rate limiter
+	ErrorKindRateLimited = "RateLimited"
+)
+
+// rpcRateLimiter is a token bucket rate limiter
+type rpcRateLimiter struct {
+	rate   float64 // the tokens added per second
+	burst  float64 // the max tokens in the bucket
+	tokens float64
+	lastNS int64
+	sync.Mutex
+}
+
+// EchoRateLimit limit the calls per second of the echo from all the callers,
+// burst is the max calls at the same time
+func EchoRateLimit(rate float64, burst int) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.rateLimit = rate
+		echoMeta.rateBurst = burst
+	}
+}
+
+func newRateLimiter(rate float64, burst int) *rpcRateLimiter {
+	return &rpcRateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		lastNS: timeNowNS(),
+	}
+}
+
+// allow take a token from the bucket, if there is no token, it returns
+// false and the duration to wait for the next token
+func (p *rpcRateLimiter) allow(nowNS int64) (bool, time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+
+	if nowNS > p.lastNS {
+		p.tokens += float64(nowNS-p.lastNS) * p.rate / float64(time.Second)
+		if p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+		p.lastNS = nowNS
+	}
+
+	if p.tokens >= 1 {
+		p.tokens--
+		return true, 0
+	}
+
+	if p.rate <= 0 {
+		return false, time.Duration(-1)
+	}
+
+	return false, time.Duration((1 - p.tokens) * float64(time.Second) / p.rate)
+}
+
+// isSameConfig report whether the limiter is created by rate and burst
+func (p *rpcRateLimiter) isSameConfig(rate float64, burst int) bool {
+	return p.rate == rate && p.burst == float64(burst)
+}
+
+// isIdle report whether the bucket is full, a full bucket has no state to keep
+func (p *rpcRateLimiter) isIdle(nowNS int64) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.tokens+float64(nowNS-p.lastNS)*p.rate/float64(time.Second) >=
+		p.burst
+}
+
+func newRateLimitedError(scope string, path string, retryAfter time.Duration) Error {
+	retryAfterMS := uint64(0)
+	if retryAfter > 0 {
+		retryAfterMS = uint64((retryAfter + time.Millisecond - 1) / time.Millisecond)
+	}
+	return NewErrorByKind(
+		ErrorKindRateLimited,
+		fmt.Sprintf(
+			"rpc echo %s is rate limited by %s, retry after %dms",
+			path,
+			scope,
+			retryAfterMS,
+		),
+		Map{
+			"path":         path,
+			"scope":        scope,
+			"retryAfterMS": retryAfterMS,
+		},
+	)
+}
@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRpcRateLimiter_allow(t *testing.T) {
+	assert := newAssert(t)
+
+	limiter := newRateLimiter(10, 2)
+	nowNS := limiter.lastNS
+	assert(limiter.allow(nowNS)).Equals(true, time.Duration(0))
+	assert(limiter.allow(nowNS)).Equals(true, time.Duration(0))
+	assert(limiter.allow(nowNS)).Equals(false, 100*time.Millisecond)
+	assert(limiter.isIdle(nowNS)).IsFalse()
+
+	nowNS += int64(50 * time.Millisecond)
+	assert(limiter.allow(nowNS)).Equals(false, 50*time.Millisecond)
+
+	nowNS += int64(50 * time.Millisecond)
+	assert(limiter.allow(nowNS)).Equals(true, time.Duration(0))
+
+	// the tokens can not be more than burst
+	nowNS += int64(10 * time.Second)
+	assert(limiter.isIdle(nowNS)).IsTrue()
+	assert(limiter.allow(nowNS)).Equals(true, time.Duration(0))
+	assert(limiter.allow(nowNS)).Equals(true, time.Duration(0))
+	assert(limiter.allow(nowNS)).Equals(false, 100*time.Millisecond)
+
+	// the time goes back
+	assert(limiter.allow(nowNS-int64(time.Second))).
+		Equals(false, 100*time.Millisecond)
+
+	zeroLimiter := newRateLimiter(0, 1)
+	assert(zeroLimiter.allow(zeroLimiter.lastNS)).Equals(true, time.Duration(0))
+	assert(zeroLimiter.allow(zeroLimiter.lastNS)).
+		Equals(false, time.Duration(-1))
+}
+
+func TestNewRateLimitedError(t *testing.T) {
+	assert := newAssert(t)
+
+	err := newRateLimitedError("service $.user", "$.user:get", 1500*time.Microsecond)
+	assert(err.GetKind()).Equals(ErrorKindRateLimited)
+	assert(err.GetMessage()).Equals(
+		"rpc echo $.user:get is rate limited by service $.user, retry after 2ms",
+	)
+	assert(err.GetDetails()).Equals(Map{
+		"path":         "$.user:get",
+		"scope":        "service $.user",
+		"retryAfterMS": uint64(2),
+	})
+
+	assert(newRateLimitedError("x", "y", -1).GetDetails()["retryAfterMS"]).
+		Equals(uint64(0))
+}
+
+func TestEchoRateLimit(t *testing.T) {
+	assert := newAssert(t)
+
+	processor := newTestProcessor(nil)
+	assert(processor.AddService("user", NewService().Echo(
+		"get",
+		true,
+		func(ctx Context) Return { return ctx.OK(true) },
+		EchoRateLimit(0, 1),
+	), "").GetMessage()).Equals("Echo $.user:get rate limit is illegal")
+	assert(processor.AddService("user", NewService().Echo(
+		"get",
+		true,
+		func(ctx Context) Return { return ctx.OK(true) },
+		EchoRateLimit(1, 0),
+	), "").GetMessage()).Equals("Echo $.user:get rate limit is illegal")
+
+	assert(processor.AddService("user", NewService().
+		Echo("get", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}, EchoRateLimit(0.001, 2)).
+		Echo("set", true, func(ctx Context) Return {
+			return ctx.OK(true)
+		}), "")).IsNil()
+	assert(processor.echosMap["$.user:get"].rateLimiter).IsNotNil()
+	assert(processor.echosMap["$.user:set"].rateLimiter).IsNil()
+
+	processor.Start()
+	defer processor.Stop()
+
+	assert(processor.call("$.user:get")).Equals(true, nil)
+	assert(processor.call("$.user:get")).Equals(true, nil)
+	_, err := processor.call("$.user:get")
+	assert(err.GetKind()).Equals(ErrorKindRateLimited)
+	assert(err.GetDetails()["scope"]).Equals("echo $.user:get")
+	assert(err.GetDetails()["retryAfterMS"].(uint64) > 0).IsTrue()
+	assert(processor.echosMap["$.user:get"].indicator.rejected).
+		Equals(int64(1))
+	assert(processor.call("$.user:set")).Equals(true, nil)
+}
+
+func TestRpcRateLimiter_isSameConfig(t *testing.T) {
+	assert := newAssert(t)
+
+	limiter := newRateLimiter(10, 2)
+	assert(limiter.isSameConfig(10, 2)).IsTrue()
+	assert(limiter.isSameConfig(10, 3)).IsFalse()
+	assert(limiter.isSameConfig(5, 2)).IsFalse()
+}
@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ErrorKindUnauthorized the caller does not have the required roles
+	ErrorKindUnauthorized = "Unauthorized"
+)
+
+// EchoRequireRoles require the caller principal to have one of the roles to
+// call the echo. it can be used multiple times, and all of them must be satisfied.
+// the roles of the services which contain the echo are required too
+func EchoRequireRoles(roles ...string) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.requiredRoles = append(echoMeta.requiredRoles, roles)
+	}
+}
+
+// RequireRoles require the caller principal to have one of the roles to call
+// the echos beneath the service (including the child services). it can be
+// called multiple times, and all of them must be satisfied
+func (p *rpcService) RequireRoles(roles ...string) Service {
+	p.DoWithLock(func() {
+		p.policy.requiredRoles = append(p.policy.requiredRoles, roles)
+	})
+	return p
+}
+
+// checkRequiredRoles check every group of the roles is not empty
+func checkRequiredRoles(requiredRoles [][]string) bool {
+	for _, roles := range requiredRoles {
+		if len(roles) == 0 {
+			return false
+		}
+		for _, role := range roles {
+			if role == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isAuthorized report whether the principal has the required roles of the
+// echo
+func (p *rpcEchoNode) isAuthorized(principal *Principal) bool {
+	for _, roles := range p.requiredRoles {
+		ok := false
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAuthorization check the principal before the echo handler is invoked
+func (p *rpcEchoNode) checkAuthorization(principal *Principal) Error {
+	if p.isAuthorized(principal) {
+		return nil
+	}
+
+	requiredRoles := make(Array, 0, len(p.requiredRoles))
+	requiredStrings := make([]string, 0, len(p.requiredRoles))
+	for _, roles := range p.requiredRoles {
+		roleArray := make(Array, 0, len(roles))
+		for _, role := range roles {
+			roleArray = append(roleArray, role)
+		}
+		requiredRoles = append(requiredRoles, roleArray)
+		requiredStrings = append(requiredStrings, strings.Join(roles, "|"))
+	}
+
+	return NewErrorByKind(
+		ErrorKindUnauthorized,
+		fmt.Sprintf(
+			"rpc echo %s is unauthorized, it requires roles: %s",
+			p.path,
+			strings.Join(requiredStrings, ", "),
+		),
+		Map{"path": p.path, "requiredRoles": requiredRoles},
+	)
+}
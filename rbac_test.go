@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"testing"
+)
+
+func TestRequireRoles(t *testing.T) {
+	assert := newAssert(t)
+
+	handler := func(ctx Context) Return { return ctx.OK(true) }
+	service := NewService().
+		RequireRoles("user", "admin").
+		RequireRoles("active").
+		Echo("get", true, handler, EchoRequireRoles("reader")).(*rpcService)
+	assert(service.policy.requiredRoles).
+		Equals([][]string{{"user", "admin"}, {"active"}})
+	assert(service.echos[0].requiredRoles).Equals([][]string{{"reader"}})
+
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService(
+		"user",
+		NewService().Echo("get", true, handler, EchoRequireRoles()),
+		"",
+	).GetMessage()).Equals("Echo $.user:get required roles is illegal")
+	assert(processor.AddService(
+		"user",
+		NewService().RequireRoles(""),
+		"",
+	).GetMessage()).Equals("Service $.user required roles is illegal")
+
+	assert(processor.AddService(
+		"user",
+		NewService().
+			RequireRoles("user").
+			Fallback(func(ctx Context, path string, args Array) Return {
+				return ctx.OK(path)
+			}).
+			AddService("profile", service),
+		"",
+	)).IsNil()
+	assert(processor.echosMap["$.user.profile:get"].requiredRoles).Equals(
+		[][]string{{"user"}, {"user", "admin"}, {"active"}, {"reader"}},
+	)
+	assert(processor.fallbacksMap["$.user"].requiredRoles).
+		Equals([][]string{{"user"}})
+}
+
+func TestRpcEchoNode_checkAuthorization(t *testing.T) {
+	assert := newAssert(t)
+
+	echoNode := &rpcEchoNode{
+		path:          "$.user:get",
+		requiredRoles: [][]string{{"user", "admin"}, {"active"}},
+	}
+	assert(echoNode.isAuthorized(nil)).IsFalse()
+	assert(echoNode.isAuthorized(&Principal{Roles: []string{"user"}})).
+		IsFalse()
+	assert(echoNode.isAuthorized(
+		&Principal{Roles: []string{"admin", "active"}},
+	)).IsTrue()
+	assert(echoNode.checkAuthorization(
+		&Principal{Roles: []string{"user", "active"}},
+	)).IsNil()
+
+	err := echoNode.checkAuthorization(&Principal{Roles: []string{"user"}})
+	assert(err.GetKind()).Equals(ErrorKindUnauthorized)
+	assert(err.GetMessage()).Equals(
+		"rpc echo $.user:get is unauthorized, it requires roles: " +
+			"user|admin, active",
+	)
+	assert(err.GetDetails()).Equals(Map{
+		"path":          "$.user:get",
+		"requiredRoles": Array{Array{"user", "admin"}, Array{"active"}},
+	})
+
+	assert((&rpcEchoNode{}).isAuthorized(nil)).IsTrue()
+}
+
+func TestRequireRoles_eval(t *testing.T) {
+	assert := newAssert(t)
+
+	conn := &testServerConn{}
+	called := false
+	processor := newTestProcessor(nil)
+	processor.getConn = func(connID uint32) rpcServerConn {
+		return conn
+	}
+	assert(processor.AddService("user", NewService().
+		Echo("reset", true, func(ctx Context) Return {
+			called = true
+			return ctx.OK(true)
+		}, EchoRequireRoles("admin")), "")).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	_, err := processor.call("$.user:reset")
+	assert(err.GetKind()).Equals(ErrorKindUnauthorized)
+	assert(called).IsFalse()
+	indicator := processor.echosMap["$.user:reset"].indicator
+	assert(indicator.GetRejected(), indicator.failed).Equals(int64(1), int64(0))
+
+	conn.principal = &Principal{Name: "tom", Roles: []string{"admin"}}
+	assert(processor.call("$.user:reset")).Equals(true, nil)
+	assert(called).IsTrue()
+}
@@ -1,10 +1,26 @@
 package rpc
 
+import (
+	"reflect"
+	"unicode"
+)
+
 type rpcEchoMeta struct {
-	name    string      // the name of echo
-	export  bool        // weather echo is export to gateway
-	handler interface{} // echo handler
-	debug   string      // where the echo add in source file
+	name        string        // the name of echo
+	export      bool          // weather echo is export to gateway
+	handler     interface{}   // echo handler
+	debug       string        // where the echo add in source file
+	argRules    []rpcArgRules // the declared rules of the arguments
+	description string        // the description of echo
+	argDocs     []rpcArgDoc   // the names and documents of the arguments
+	returnDoc   string        // the document of the return value
+	version     uint          // the version of echo, 0 is no version
+	isDefault   bool          // weather the version is the default version
+
+	maxConcurrency int        // the max concurrent calls, 0 is no limit
+	rateLimit      float64    // the calls per second, 0 is no limit
+	rateBurst      int        // the max burst calls of rate limit
+	requiredRoles  [][]string // the caller must have one role of each
 }
 
 type rpcNodeMeta struct {
@@ -14,9 +30,12 @@ type rpcNodeMeta struct {
 }
 
 type rpcService struct {
-	children []*rpcNodeMeta // all the children node meta pointer
-	echos    []*rpcEchoMeta // all the echos meta pointer
-	debug    string         // where the service define in source file
+	children []*rpcNodeMeta   // all the children node meta pointer
+	echos    []*rpcEchoMeta   // all the echos meta pointer
+	aliases  []*rpcAliasMeta  // all the aliases meta pointer
+	fallback *rpcFallbackMeta // the fallback meta pointer
+	policy   rpcPolicyMeta    // the policies of the service
+	debug    string           // where the service define in source file
 	rpcAutoLock
 }
 
@@ -25,28 +44,140 @@ func NewService() Service {
 	return &rpcService{
 		children: make([]*rpcNodeMeta, 0, 0),
 		echos:    make([]*rpcEchoMeta, 0, 0),
+		aliases:  make([]*rpcAliasMeta, 0, 0),
 		debug:    getStackString(1),
 	}
 }
 
+// NewServiceFromStruct define a new service, the exported methods of obj
+// which are valid echo handlers (standard or adaptable, see Adapt) are added
+// as echos. The echo name is the method name with lower first letter, and
+// obj can implement EchoMethodMapper to rename, hide or not export methods.
+// the methods which the mapper makes visible must be valid echo handlers,
+// or the service fails to mount
+func NewServiceFromStruct(obj interface{}) Service {
+	debug := getStackString(1)
+	ret := &rpcService{
+		children: make([]*rpcNodeMeta, 0, 0),
+		echos:    make([]*rpcEchoMeta, 0, 0),
+		aliases:  make([]*rpcAliasMeta, 0, 0),
+		debug:    debug,
+	}
+
+	if obj == nil {
+		return ret
+	}
+
+	mapper, hasMapper := obj.(EchoMethodMapper)
+	objValue := reflect.ValueOf(obj)
+	objType := objValue.Type()
+	for i := 0; i < objType.NumMethod(); i++ {
+		methodName := objType.Method(i).Name
+		if hasMapper && methodName == "MapEchoMethod" {
+			continue
+		}
+
+		name, export, visible := getDefaultEchoName(methodName), true, true
+		if hasMapper {
+			name, export, visible = mapper.MapEchoMethod(methodName)
+		}
+		if !visible {
+			continue
+		}
+
+		handler := objValue.Method(i).Interface()
+		if !isEchoHandler(handler) {
+			adapted := &rpcAdaptedHandler{fn: handler}
+			// the invalid methods are skipped, unless the mapper makes them
+			// visible, then mountEcho reports the error
+			_, err := buildAdaptedHandler(adapted, debug)
+			if err != nil && !hasMapper {
+				continue
+			}
+			handler = adapted
+		}
+
+		ret.echos = append(ret.echos, &rpcEchoMeta{
+			name:    name,
+			export:  export,
+			handler: handler,
+			debug:   debug,
+		})
+	}
+
+	return ret
+}
+
+func getDefaultEchoName(methodName string) string {
+	runes := []rune(methodName)
+	if len(runes) > 0 {
+		runes[0] = unicode.ToLower(runes[0])
+	}
+	return string(runes)
+}
+
+func isEchoHandler(handler interface{}) bool {
+	fn := reflect.ValueOf(handler)
+	return fn.Kind() == reflect.Func &&
+		getArgumentsErrorPosition(fn) < 0 &&
+		fn.Type().NumOut() == 1 &&
+		fn.Type().Out(0) == returnType
+}
+
 // Echo add echo handler
 func (p *rpcService) Echo(
 	name string,
 	export bool,
 	handler interface{},
+	options ...EchoOption,
 ) Service {
 	p.DoWithLock(func() {
-		// add echo meta
-		p.echos = append(p.echos, &rpcEchoMeta{
+		echoMeta := &rpcEchoMeta{
 			name:    name,
 			export:  export,
 			handler: handler,
 			debug:   getStackString(3),
+		}
+		for _, option := range options {
+			if option != nil {
+				option(echoMeta)
+			}
+		}
+		// add echo meta
+		p.echos = append(p.echos, echoMeta)
+	})
+	return p
+}
+
+// Alias add an alias which redirect the echo path to the target. The name
+// is the echo name in this service, it can have version like "get@1". The
+// target is the echo name in this service, or the echo path like
+// "$.user:get@2". the target is checked when the service is added, so the
+// target in the other top-level services must be added before this one
+func (p *rpcService) Alias(name string, target string) Service {
+	p.DoWithLock(func() {
+		// add alias meta
+		p.aliases = append(p.aliases, &rpcAliasMeta{
+			name:   name,
+			target: target,
+			debug:  getStackString(3),
 		})
 	})
 	return p
 }
 
+// Fallback set the handler which handle the calls to the echo paths that
+// are not mounted under this service (including the child services)
+func (p *rpcService) Fallback(handler FallbackHandler) Service {
+	p.DoWithLock(func() {
+		p.fallback = &rpcFallbackMeta{
+			handler: handler,
+			debug:   getStackString(3),
+		}
+	})
+	return p
+}
+
 // AddService add child service
 func (p *rpcService) AddService(name string, service Service) Service {
 	serviceMeta, ok := service.(*rpcService)
@@ -0,0 +1,251 @@
+package rpc
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// ErrorKindAccessDenied the call is rejected by the ACL of service
+	ErrorKindAccessDenied = "AccessDenied"
+	// ErrorKindTimeout the echo handler runs longer than the service timeout
+	ErrorKindTimeout = "Timeout"
+)
+
+// Interceptor is called before every echo beneath the service is invoked,
+// path is the called echo path. if it returns an error, the echo handler
+// is not invoked and the error is returned to the caller
+type Interceptor func(ctx Context, path string) Error
+
+// ACLChecker report whether the caller is allowed to call the echo path
+type ACLChecker func(ctx Context, path string) bool
+
+type rpcPolicyMeta struct {
+	interceptors   []Interceptor // the interceptors of the service
+	acls           []ACLChecker  // the ACL checkers of the service
+	timeout        time.Duration // the timeout of the echos, 0 is no timeout
+	timeoutDebug   string        // where the timeout set in source file
+	rateLimit      float64       // the calls per second, 0 is no limit
+	rateBurst      int           // the max burst calls of rate limit
+	rateLimitDebug string        // where the rate limit set in source file
+
+	maxConcurrency   int        // the max concurrent calls, 0 is no limit
+	concurrencyDebug string     // where the concurrency set in source file
+	requiredRoles    [][]string // the caller must have one role of each
+}
+
+// rpcServicePolicy is the policy of the service node, which is merged with
+// the policies of its ancestors
+type rpcServicePolicy struct {
+	interceptors  []Interceptor
+	acls          []ACLChecker
+	rateLimiters  []*rpcRateLimiter
+	rateScopes    []string
+	bulkheads     []*rpcBulkhead
+	requiredRoles [][]string
+	timeout       time.Duration
+}
+
+// Use add an interceptor which is called before every echo beneath the
+// service (including the child services), the interceptors of the ancestor
+// services are called first
+func (p *rpcService) Use(interceptor Interceptor) Service {
+	p.DoWithLock(func() {
+		p.policy.interceptors = append(p.policy.interceptors, interceptor)
+	})
+	return p
+}
+
+// ACL add a checker which decide whether the caller can call the echos
+// beneath the service (including the child services)
+func (p *rpcService) ACL(check ACLChecker) Service {
+	p.DoWithLock(func() {
+		p.policy.acls = append(p.policy.acls, check)
+	})
+	return p
+}
+
+// Timeout set the max duration of the echos beneath the service (including
+// the child services). if the handler runs longer, the caller gets a Timeout
+// error when the deadline passes, and the late result is dropped. the handler
+// is not interrupted, it keeps its thread until it returns. the shortest
+// timeout of the ancestors wins
+func (p *rpcService) Timeout(timeout time.Duration) Service {
+	p.DoWithLock(func() {
+		p.policy.timeout = timeout
+		p.policy.timeoutDebug = getStackString(3)
+	})
+	return p
+}
+
+// RateLimit limit the calls per second of all the echos beneath the service
+// (including the child services). burst is the max calls at the same time
+func (p *rpcService) RateLimit(rate float64, burst int) Service {
+	p.DoWithLock(func() {
+		p.policy.rateLimit = rate
+		p.policy.rateBurst = burst
+		p.policy.rateLimitDebug = getStackString(3)
+	})
+	return p
+}
+
+func newServicePolicy(
+	parent *rpcServicePolicy,
+	servicePath string,
+	policyMeta *rpcPolicyMeta,
+	debug string,
+) (*rpcServicePolicy, Error) {
+	for _, interceptor := range policyMeta.interceptors {
+		if interceptor == nil {
+			return nil, NewErrorByDebug(
+				fmt.Sprintf("Service %s interceptor is nil", servicePath),
+				debug,
+			)
+		}
+	}
+
+	for _, check := range policyMeta.acls {
+		if check == nil {
+			return nil, NewErrorByDebug(
+				fmt.Sprintf("Service %s ACL checker is nil", servicePath),
+				debug,
+			)
+		}
+	}
+
+	if policyMeta.timeout < 0 {
+		return nil, NewErrorByDebug(
+			fmt.Sprintf("Service %s timeout must be positive", servicePath),
+			policyMeta.timeoutDebug,
+		)
+	}
+
+	if policyMeta.rateLimitDebug != "" &&
+		(policyMeta.rateLimit <= 0 || policyMeta.rateBurst < 1) {
+		return nil, NewErrorByDebug(
+			fmt.Sprintf("Service %s rate limit is illegal", servicePath),
+			policyMeta.rateLimitDebug,
+		)
+	}
+
+	if policyMeta.concurrencyDebug != "" &&
+		policyMeta.maxConcurrency < 1 {
+		return nil, NewErrorByDebug(
+			fmt.Sprintf("Service %s max concurrency is illegal", servicePath),
+			policyMeta.concurrencyDebug,
+		)
+	}
+
+	if !checkRequiredRoles(policyMeta.requiredRoles) {
+		return nil, NewErrorByDebug(
+			fmt.Sprintf("Service %s required roles is illegal", servicePath),
+			debug,
+		)
+	}
+
+	if parent == nil {
+		parent = &rpcServicePolicy{}
+	}
+
+	ret := &rpcServicePolicy{
+		interceptors: append(
+			append([]Interceptor(nil), parent.interceptors...),
+			policyMeta.interceptors...,
+		),
+		acls: append(
+			append([]ACLChecker(nil), parent.acls...),
+			policyMeta.acls...,
+		),
+		rateLimiters: append([]*rpcRateLimiter(nil), parent.rateLimiters...),
+		rateScopes:   append([]string(nil), parent.rateScopes...),
+		bulkheads:    append([]*rpcBulkhead(nil), parent.bulkheads...),
+		requiredRoles: append(
+			append([][]string(nil), parent.requiredRoles...),
+			policyMeta.requiredRoles...,
+		),
+		timeout: parent.timeout,
+	}
+
+	if policyMeta.timeout > 0 &&
+		(ret.timeout == 0 || policyMeta.timeout < ret.timeout) {
+		ret.timeout = policyMeta.timeout
+	}
+
+	if policyMeta.rateLimitDebug != "" {
+		ret.rateLimiters = append(
+			ret.rateLimiters,
+			newRateLimiter(policyMeta.rateLimit, policyMeta.rateBurst),
+		)
+		ret.rateScopes = append(ret.rateScopes, "service "+servicePath)
+	}
+
+	if policyMeta.concurrencyDebug != "" {
+		ret.bulkheads = append(ret.bulkheads, newBulkhead(
+			"service "+servicePath,
+			policyMeta.maxConcurrency,
+		))
+	}
+
+	return ret, nil
+}
+
+// check the ACLs and the rate limits before the echo handler is invoked, it
+// returns the error if the call is rejected
+func (p *rpcServicePolicy) check(ctx Context, path string) Error {
+	if p == nil {
+		return nil
+	}
+
+	for _, check := range p.acls {
+		if !check(ctx, path) {
+			return NewErrorByKind(
+				ErrorKindAccessDenied,
+				fmt.Sprintf("rpc echo %s access denied", path),
+				Map{"path": path},
+			)
+		}
+	}
+
+	if len(p.rateLimiters) > 0 {
+		nowNS := timeNowNS()
+		for i, limiter := range p.rateLimiters {
+			if ok, retryAfter := limiter.allow(nowNS); !ok {
+				return newRateLimitedError(p.rateScopes[i], path, retryAfter)
+			}
+		}
+	}
+
+	return nil
+}
+
+// intercept run the interceptors of the service before the echo is invoked
+func (p *rpcServicePolicy) intercept(ctx Context, path string) Error {
+	if p == nil {
+		return nil
+	}
+
+	for _, interceptor := range p.interceptors {
+		if err := interceptor(ctx, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getTimeoutError get the error which the caller gets when the echo handler
+// is not finished in time
+func (p *rpcServicePolicy) getTimeoutError(path string) Error {
+	return NewErrorByKind(
+		ErrorKindTimeout,
+		fmt.Sprintf(
+			"rpc echo %s timeout, limited %dms",
+			path,
+			p.timeout/time.Millisecond,
+		),
+		Map{
+			"path":      path,
+			"timeoutMS": uint64(p.timeout / time.Millisecond),
+		},
+	)
+}
@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRpcService_Policy(t *testing.T) {
+	assert := newAssert(t)
+
+	interceptor := func(ctx Context, path string) Error { return nil }
+	check := func(ctx Context, path string) bool { return true }
+	service := NewService().
+		Use(interceptor).
+		ACL(check).
+		Timeout(time.Second).
+		RateLimit(10, 5).(*rpcService)
+
+	assert(len(service.policy.interceptors)).Equals(1)
+	assert(len(service.policy.acls)).Equals(1)
+	assert(service.policy.timeout).Equals(time.Second)
+	assert(service.policy.timeoutDebug).Contains("service_policy_test.go")
+	assert(service.policy.rateLimit, service.policy.rateBurst).Equals(10.0, 5)
+	assert(service.policy.rateLimitDebug).Contains("service_policy_test.go")
+}
+
+func TestNewServicePolicy(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(newServicePolicy(nil, "$.user", &rpcPolicyMeta{
+		interceptors: []Interceptor{nil},
+	}, "DebugMessage")).Equals(nil, NewErrorByDebug(
+		"Service $.user interceptor is nil",
+		"DebugMessage",
+	))
+	assert(newServicePolicy(nil, "$.user", &rpcPolicyMeta{
+		acls: []ACLChecker{nil},
+	}, "DebugMessage")).Equals(nil, NewErrorByDebug(
+		"Service $.user ACL checker is nil",
+		"DebugMessage",
+	))
+	assert(newServicePolicy(nil, "$.user", &rpcPolicyMeta{
+		timeout:      -1,
+		timeoutDebug: "TimeoutDebug",
+	}, "")).Equals(nil, NewErrorByDebug(
+		"Service $.user timeout must be positive",
+		"TimeoutDebug",
+	))
+	assert(newServicePolicy(nil, "$.user", &rpcPolicyMeta{
+		rateLimit:      0,
+		rateBurst:      1,
+		rateLimitDebug: "RateLimitDebug",
+	}, "")).Equals(nil, NewErrorByDebug(
+		"Service $.user rate limit is illegal",
+		"RateLimitDebug",
+	))
+
+	parent, err := newServicePolicy(nil, "$.user", &rpcPolicyMeta{
+		interceptors:   []Interceptor{func(ctx Context, path string) Error { return nil }},
+		timeout:        time.Second,
+		rateLimit:      10,
+		rateBurst:      1,
+		rateLimitDebug: "RateLimitDebug",
+	}, "")
+	assert(err).IsNil()
+	assert(len(parent.interceptors), len(parent.rateLimiters)).Equals(1, 1)
+	assert(parent.timeout).Equals(time.Second)
+
+	child, err := newServicePolicy(parent, "$.user.profile", &rpcPolicyMeta{
+		acls:           []ACLChecker{func(ctx Context, path string) bool { return true }},
+		timeout:        2 * time.Second,
+		rateLimit:      10,
+		rateBurst:      1,
+		rateLimitDebug: "RateLimitDebug",
+	}, "")
+	assert(err).IsNil()
+	assert(len(child.interceptors), len(child.acls)).Equals(1, 1)
+	assert(child.timeout).Equals(time.Second)
+	assert(child.rateLimiters[0] == parent.rateLimiters[0]).IsTrue()
+	assert(child.rateScopes).Equals(
+		[]string{"service $.user", "service $.user.profile"},
+	)
+
+	grandChild, err := newServicePolicy(child, "$.user.profile.x", &rpcPolicyMeta{
+		timeout: time.Millisecond,
+	}, "")
+	assert(err).IsNil()
+	assert(grandChild.timeout).Equals(time.Millisecond)
+}
+
+func TestRpcServicePolicy_getTimeoutError(t *testing.T) {
+	assert := newAssert(t)
+
+	policy := &rpcServicePolicy{timeout: 10 * time.Millisecond}
+	err := policy.getTimeoutError("$.user:get")
+	assert(err.GetKind()).Equals(ErrorKindTimeout)
+	assert(err.GetMessage()).
+		Equals("rpc echo $.user:get timeout, limited 10ms")
+	assert(err.GetDetails()).Equals(Map{
+		"path":      "$.user:get",
+		"timeoutMS": uint64(10),
+	})
+}
+
+func TestRpcServicePolicy_eval(t *testing.T) {
+	assert := newAssert(t)
+
+	calls := make([]string, 0)
+	releaseCH := make(chan bool)
+	processor := newTestProcessor(nil)
+	assert(processor.AddService(
+		"user",
+		NewService().
+			Use(func(ctx Context, path string) Error {
+				calls = append(calls, "user "+path)
+				return nil
+			}).
+			ACL(func(ctx Context, path string) bool {
+				return path != "$.user:secret"
+			}).
+			Echo("sayHello", true, func(ctx Context, name string) Return {
+				return ctx.OK("hello " + name)
+			}).
+			Echo("secret", true, func(ctx Context) Return {
+				return ctx.OK("secret")
+			}).
+			Fallback(func(ctx Context, path string, args Array) Return {
+				return ctx.OK(path)
+			}).
+			AddService("profile", NewService().
+				Use(func(ctx Context, path string) Error {
+					calls = append(calls, "profile "+path)
+					if path == "$.user.profile:blocked" {
+						return NewErrorByKind("Blocked", "blocked", nil)
+					}
+					return nil
+				}).
+				Timeout(10*time.Millisecond).
+				RateLimit(0.001, 2).
+				Echo("slow", true, func(ctx Context) Return {
+					<-releaseCH
+					return ctx.OK(true)
+				}).
+				Echo("blocked", true, func(ctx Context) Return {
+					return ctx.OK(true)
+				}),
+			),
+		"",
+	)).IsNil()
+	processor.Start()
+	defer processor.Stop()
+
+	assert(processor.call("$.user:sayHello", "world")).
+		Equals("hello world", nil)
+	assert(processor.call("$.user:lost")).Equals("$.user:lost", nil)
+
+	_, err := processor.call("$.user:secret")
+	assert(err.GetKind()).Equals(ErrorKindAccessDenied)
+	assert(err.GetMessage()).Equals("rpc echo $.user:secret access denied")
+	// the rejected call is not counted as failed
+	secretIndicator := processor.echosMap["$.user:secret"].indicator
+	assert(secretIndicator.GetRejected()).Equals(int64(1))
+	assert(atomic.LoadInt64(&secretIndicator.failed)).Equals(int64(0))
+
+	_, err = processor.call("$.user.profile:blocked")
+	assert(err.GetKind(), err.GetMessage()).Equals("Blocked", "blocked")
+
+	// the caller gets the Timeout error while the handler is running
+	_, err = processor.call("$.user.profile:slow")
+	assert(err.GetKind(), err.GetDetails()).Equals(ErrorKindTimeout, Map{
+		"path":      "$.user.profile:slow",
+		"timeoutMS": uint64(10),
+	})
+	// the late result is dropped, and it is counted as failed
+	close(releaseCH)
+	indicator := processor.echosMap["$.user.profile:slow"].indicator
+	for i := 0; i < 100 && atomic.LoadInt64(&indicator.failed) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert(atomic.LoadInt64(&indicator.failed)).Equals(int64(1))
+	select {
+	case <-processor.retCH:
+		assert(nil).Fail()
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	_, err = processor.call("$.user.profile:slow")
+	assert(err.GetKind()).Equals(ErrorKindRateLimited)
+	assert(err.GetDetails()["scope"]).Equals("service $.user.profile")
+	assert(indicator.GetRejected()).Equals(int64(1))
+	assert(atomic.LoadInt64(&indicator.failed)).Equals(int64(1))
+
+	// the error of the interceptor is a failed call
+	blockedIndicator := processor.echosMap["$.user.profile:blocked"].indicator
+	assert(blockedIndicator.GetRejected()).Equals(int64(0))
+	assert(atomic.LoadInt64(&blockedIndicator.failed)).Equals(int64(1))
+
+	assert(calls).Equals([]string{
+		"user $.user:sayHello",
+		"user $.user:lost",
+		"user $.user.profile:blocked",
+		"profile $.user.profile:blocked",
+		"user $.user.profile:slow",
+		"profile $.user.profile:slow",
+	})
+}
@@ -40,3 +40,111 @@ func TestRpcService_Echo(t *testing.T) {
 	assert(service.(*rpcService).echos[0].handler).Equals(2345)
 	assert(service.(*rpcService).echos[0].debug).Contains("TestRpcService_Echo")
 }
+
+func TestRpcService_Alias(t *testing.T) {
+	assert := newAssert(t)
+	service := NewService().Alias("old", "new")
+	assert(len(service.(*rpcService).aliases)).Equals(1)
+	assert(service.(*rpcService).aliases[0].name).Equals("old")
+	assert(service.(*rpcService).aliases[0].target).Equals("new")
+	assert(service.(*rpcService).aliases[0].debug).
+		Contains("TestRpcService_Alias")
+}
+
+func TestRpcService_Fallback(t *testing.T) {
+	assert := newAssert(t)
+	service := NewService().Fallback(
+		func(ctx Context, path string, args Array) Return {
+			return ctx.OK(true)
+		},
+	)
+	assert(service.(*rpcService).fallback.handler).IsNotNil()
+	assert(service.(*rpcService).fallback.debug).
+		Contains("TestRpcService_Fallback")
+}
+
+type testStructService struct{}
+
+func (p *testStructService) SayHello(ctx Context, name string) Return {
+	return ctx.OK("hello " + name)
+}
+
+func (p *testStructService) Add(a int64, b int64) int64 {
+	return a + b
+}
+
+func (p *testStructService) Invalid(ch chan bool) {}
+
+type testMappedStructService struct {
+	testStructService
+}
+
+func (p *testMappedStructService) MapEchoMethod(
+	method string,
+) (string, bool, bool) {
+	switch method {
+	case "SayHello":
+		return "hello", false, true
+	default:
+		return method, true, false
+	}
+}
+
+type testInvalidMappedStructService struct {
+	testStructService
+}
+
+func (p *testInvalidMappedStructService) MapEchoMethod(
+	method string,
+) (string, bool, bool) {
+	return getDefaultEchoName(method), true, method == "Invalid"
+}
+
+func TestNewServiceFromStruct(t *testing.T) {
+	assert := newAssert(t)
+
+	// obj is nil
+	service := NewServiceFromStruct(nil)
+	assert(len(service.(*rpcService).echos)).Equals(0)
+	assert(service.(*rpcService).debug).Contains("TestNewServiceFromStruct")
+
+	// default names
+	service = NewServiceFromStruct(&testStructService{})
+	echos := service.(*rpcService).echos
+	assert(len(echos)).Equals(2)
+	assert(echos[0].name).Equals("add")
+	assert(echos[0].export).IsTrue()
+	_, ok := echos[0].handler.(*rpcAdaptedHandler)
+	assert(ok).IsTrue()
+	assert(echos[0].debug).Contains("TestNewServiceFromStruct")
+	assert(echos[1].name).Equals("sayHello")
+	assert(echos[1].export).IsTrue()
+	_, ok = echos[1].handler.(func(Context, string) Return)
+	assert(ok).IsTrue()
+
+	// mapped names
+	service = NewServiceFromStruct(&testMappedStructService{})
+	echos = service.(*rpcService).echos
+	assert(len(echos)).Equals(1)
+	assert(echos[0].name).Equals("hello")
+	assert(echos[0].export).IsFalse()
+
+	// mount
+	processor := newRPCProcessor(nil, 16, 16, nil, nil)
+	assert(processor.AddService(
+		"user",
+		NewServiceFromStruct(&testStructService{}),
+		"",
+	)).IsNil()
+	assert(processor.echosMap["$.user:add"]).IsNotNil()
+	assert(processor.echosMap["$.user:sayHello"]).IsNotNil()
+
+	// the invalid method is visible by the mapper
+	service = NewServiceFromStruct(&testInvalidMappedStructService{})
+	echos = service.(*rpcService).echos
+	assert(len(echos)).Equals(1)
+	assert(echos[0].name).Equals("invalid")
+	err := processor.AddService("invalid", service, "")
+	assert(err).IsNotNil()
+	assert(err.GetDebug()).Contains("TestNewServiceFromStruct")
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"sync"
+)
+
+const (
+	defaultSessionSizeLimit = 64
+)
+
+// Session is the storage of the caller connection, it keeps the values
+// between the calls and survives the reconnects of the connection
+type Session = *rpcSession
+
+type rpcSession struct {
+	items     map[string]interface{}
+	sizeLimit int
+	sync.Mutex
+}
+
+func newSession(sizeLimit int) *rpcSession {
+	return &rpcSession{
+		items:     make(map[string]interface{}),
+		sizeLimit: sizeLimit,
+	}
+}
+
+// Get get the value of the key
+func (p *rpcSession) Get(key string) (interface{}, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.Lock()
+	defer p.Unlock()
+	ret, ok := p.items[key]
+	return ret, ok
+}
+
+// Set set the value of the key, it returns false if the session is full
+func (p *rpcSession) Set(key string, value interface{}) bool {
+	if p == nil {
+		return false
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.items == nil {
+		return false
+	}
+	if _, ok := p.items[key]; !ok && len(p.items) >= p.sizeLimit {
+		return false
+	}
+	p.items[key] = value
+	return true
+}
+
+// Delete delete the key
+func (p *rpcSession) Delete(key string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	delete(p.items, key)
+}
+
+// Len get the number of the keys
+func (p *rpcSession) Len() int {
+	if p == nil {
+		return 0
+	}
+	p.Lock()
+	defer p.Unlock()
+	return len(p.items)
+}
+
+// destroy remove all the keys, and the session can not be set any more
+func (p *rpcSession) destroy() {
+	p.Lock()
+	defer p.Unlock()
+	p.items = nil
+}
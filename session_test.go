@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"testing"
+)
+
+func TestRpcSession(t *testing.T) {
+	assert := newAssert(t)
+
+	session := newSession(2)
+	assert(session.Get("a")).Equals(nil, false)
+	assert(session.Set("a", int64(1))).IsTrue()
+	assert(session.Set("b", "2")).IsTrue()
+	assert(session.Set("c", true)).IsFalse()
+	assert(session.Set("a", int64(3))).IsTrue()
+	assert(session.Get("a")).Equals(int64(3), true)
+	assert(session.Get("c")).Equals(nil, false)
+	assert(session.Len()).Equals(2)
+
+	session.Delete("b")
+	assert(session.Len()).Equals(1)
+	assert(session.Set("c", true)).IsTrue()
+
+	session.destroy()
+	assert(session.Len()).Equals(0)
+	assert(session.Get("a")).Equals(nil, false)
+	assert(session.Set("a", int64(1))).IsFalse()
+	session.Delete("a")
+
+	nilSession := (*rpcSession)(nil)
+	assert(nilSession.Get("a")).Equals(nil, false)
+	assert(nilSession.Set("a", int64(1))).IsFalse()
+	assert(nilSession.Len()).Equals(0)
+	nilSession.Delete("a")
+}
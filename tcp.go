@@ -0,0 +1,329 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tcpHandshakeTimeout = 10 * time.Second
+	tcpAcceptMinDelay   = 5 * time.Millisecond
+	tcpAcceptMaxDelay   = time.Second
+)
+
+// tcpStreamConn is the rpcStreamConn via raw TCP (or TLS over TCP), every
+// stream is prefixed by its size in 4 bytes little endian
+type tcpStreamConn struct {
+	conn          net.Conn
+	reader        *bufio.Reader
+	readSizeLimit int64
+	sync.Mutex
+}
+
+func newTCPStreamConn(conn net.Conn, readSizeLimit int64) *tcpStreamConn {
+	return &tcpStreamConn{
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		readSizeLimit: readSizeLimit,
+	}
+}
+
+func (p *tcpStreamConn) ReadStream(timeout time.Duration) ([]byte, error) {
+	if err := p.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(p.reader, head); err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(head)
+	if size == 0 || int64(size) > p.readSizeLimit {
+		return nil, fmt.Errorf("tcp: stream size %d is illegal", size)
+	}
+
+	ret := make([]byte, size)
+	if _, err := io.ReadFull(p.reader, ret); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (p *tcpStreamConn) WriteStream(buf []byte) error {
+	head := make([]byte, 4)
+	binary.LittleEndian.PutUint32(head, uint32(len(buf)))
+	buffers := net.Buffers{head, buf}
+
+	p.Lock()
+	defer p.Unlock()
+	_, err := buffers.WriteTo(p.conn)
+	return err
+}
+
+func (p *tcpStreamConn) Close() error {
+	return p.conn.Close()
+}
+
+// ListenAndServeTCP listen on the TCP address and serve the raw TCP
+// connections, the connections are TLS if the TLS of the server is set. see
+// ServeTCP
+func (p *WebSocketServer) ListenAndServeTCP(host string, port uint16) Error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return NewErrorBySystemError(err)
+	}
+
+	scheme := "tcp"
+	if tlsConfig := p.getServeTLSConfig(); tlsConfig != nil {
+		scheme = "tls"
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	p.logger.Infof(
+		"WebSocketServer: start at %s",
+		getURLBySchemeHostPortAndPath(scheme, host, port, ""),
+	)
+	return p.ServeTCP(listener)
+}
+
+// ServeTCP serve the raw TCP (or Unix domain socket) connections accepted by
+// listener with the same processor, authentication and limits as websocket.
+// the first stream of a connection is the handshake, which is the url
+// encoded query like the websocket upgrade request. it blocks until the
+// listener is closed, and Close closes the listener. the WebSocketServer
+// must be opened by Open (or Start)
+func (p *WebSocketServer) ServeTCP(listener net.Listener) Error {
+	if !p.isOpened() {
+		_ = listener.Close()
+		return NewError("WebSocketServer: serve tcp error, it is not opened")
+	}
+
+	p.Lock()
+	p.listeners[listener] = true
+	p.Unlock()
+	defer func() {
+		p.Lock()
+		delete(p.listeners, listener)
+		p.Unlock()
+	}()
+
+	// the temporary errors (like too many open files) are retried with
+	// backoff like net/http, the other errors stop serving
+	tempDelay := time.Duration(0)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// the listener is closed by Close
+			if atomic.LoadInt32(&p.status) != wsServerOpened {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = tcpAcceptMinDelay
+				} else if tempDelay *= 2; tempDelay > tcpAcceptMaxDelay {
+					tempDelay = tcpAcceptMaxDelay
+				}
+				p.logger.Warnf(
+					"WebSocketServer: tcp accept error: %s, retrying in %s",
+					err.Error(),
+					tempDelay,
+				)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return NewErrorBySystemError(err)
+		}
+		tempDelay = 0
+		go p.serveTCPConn(conn)
+	}
+}
+
+func (p *WebSocketServer) closeListeners() {
+	p.Lock()
+	defer p.Unlock()
+	for listener := range p.listeners {
+		if err := listener.Close(); err != nil {
+			p.logger.Warnf("WebSocketServer: %s", err.Error())
+		}
+	}
+}
+
+// serveTCPConn read the handshake of the TCP connection, and serve it
+func (p *WebSocketServer) serveTCPConn(conn net.Conn) {
+	req, streamConn, err := p.handshakeTCPConn(conn)
+	if err != nil {
+		p.logger.Warnf(
+			"WebSocketServer: tcp handshake of %s error: %s",
+			conn.RemoteAddr().String(),
+			err.Error(),
+		)
+		_ = conn.Close()
+		return
+	}
+
+	principal, authErr := p.authenticateRequest(req)
+	if authErr != nil {
+		// tell the client why it is rejected before closing, like the 401
+		// response of the websocket upgrade
+		stream := newStream()
+		stream.SetClientCallbackID(0)
+		writeStreamError(
+			stream,
+			authErr.GetMessage(),
+			authErr.GetDebug(),
+			authErr.GetKind(),
+			authErr.GetDetails(),
+		)
+		_ = streamConn.WriteStream(stream.GetBufferUnsafe())
+		stream.Release()
+		_ = conn.Close()
+		return
+	}
+
+	p.serveStreamConn(streamConn, req, principal)
+}
+
+// handshakeTCPConn finish the TLS handshake if the connection is TLS, and
+// read the handshake stream as the query of the request
+func (p *WebSocketServer) handshakeTCPConn(
+	conn net.Conn,
+) (*http.Request, *tcpStreamConn, error) {
+	state := (*tls.ConnectionState)(nil)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.SetDeadline(
+			time.Now().Add(tcpHandshakeTimeout),
+		); err != nil {
+			return nil, nil, err
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, nil, err
+		}
+		if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+			return nil, nil, err
+		}
+		connState := tlsConn.ConnectionState()
+		state = &connState
+	}
+
+	streamConn := newTCPStreamConn(
+		conn,
+		int64(atomic.LoadUint64(&p.readSizeLimit)),
+	)
+	handshake, err := streamConn.ReadStream(tcpHandshakeTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := url.ParseQuery(string(handshake)); err != nil {
+		return nil, nil, errors.New("handshake format error")
+	}
+
+	localAddr := conn.LocalAddr().String()
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL: &url.URL{
+			Scheme:   "tcp",
+			Host:     localAddr,
+			RawQuery: string(handshake),
+		},
+		Header:     http.Header{},
+		Host:       localAddr,
+		RemoteAddr: conn.RemoteAddr().String(),
+		TLS:        state,
+	}
+
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		if cred, err := getPeerCred(unixConn); err == nil {
+			req = withPeerCred(req, cred)
+		}
+	}
+	return req, streamConn, nil
+}
+
+// TCPClient is implement of INetClient via raw TCP or Unix domain socket
+type TCPClient struct {
+	*rpcClient
+	urlString string
+	tlsConfig *tls.Config
+}
+
+// NewTCPClient create a TCPClient, and connect to url like
+// "tcp://127.0.0.1:8080?token=xxx" or "unix:///var/run/rpc.sock", the query
+// is sent by the handshake. if tlsConfig is not nil, the connection is TLS,
+// see NewClientTLSConfig
+func NewTCPClient(urlString string, tlsConfig *tls.Config) *TCPClient {
+	client := &TCPClient{
+		urlString: urlString,
+		tlsConfig: tlsConfig,
+	}
+	client.rpcClient = newRPCClient(client.dial)
+	return client
+}
+
+func (p *TCPClient) dial(
+	query url.Values,
+	readSizeLimit int64,
+) (rpcStreamConn, error) {
+	requestURL, err := url.Parse(p.urlString)
+	if err != nil {
+		return nil, err
+	}
+	address := requestURL.Host
+	switch requestURL.Scheme {
+	case "tcp":
+	case "unix":
+		address = requestURL.Path
+	default:
+		return nil, fmt.Errorf(
+			"tcp: url scheme %s is not supported",
+			requestURL.Scheme,
+		)
+	}
+	requestQuery := requestURL.Query()
+	for key, values := range query {
+		requestQuery[key] = values
+	}
+
+	conn, err := net.DialTimeout(
+		requestURL.Scheme,
+		address,
+		tcpHandshakeTimeout,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tlsConfig != nil {
+		config := p.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = requestURL.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		_ = tlsConn.SetDeadline(time.Now().Add(tcpHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+
+	streamConn := newTCPStreamConn(conn, readSizeLimit)
+	if err := streamConn.WriteStream([]byte(requestQuery.Encode())); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return streamConn, nil
+}
@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTcpStreamConn(t *testing.T) {
+	assert := newAssert(t)
+
+	readStream := func(data []byte, timeout time.Duration) ([]byte, error) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			_, _ = client.Write(data)
+			_ = client.Close()
+		}()
+		return newTCPStreamConn(server, 16).ReadStream(timeout)
+	}
+
+	assert(readStream([]byte{5, 0, 0, 0, 'h', 'e', 'l', 'l', 'o'}, time.Second)).
+		Equals([]byte("hello"), nil)
+	_, err := readStream([]byte{17, 0, 0, 0}, time.Second)
+	assert(err.Error()).Equals("tcp: stream size 17 is illegal")
+	_, err = readStream([]byte{0, 0, 0, 0}, time.Second)
+	assert(err.Error()).Equals("tcp: stream size 0 is illegal")
+
+	// the stream is broken
+	_, err = readStream([]byte{5, 0, 0, 0}, time.Second)
+	assert(err).Equals(io.ErrUnexpectedEOF)
+	_, err = readStream([]byte{5, 0}, time.Second)
+	assert(err).Equals(io.ErrUnexpectedEOF)
+
+	// the normal close is io.EOF
+	_, err = readStream(nil, time.Second)
+	assert(err).Equals(io.EOF)
+
+	// the timeout
+	client, server := net.Pipe()
+	serverConn := newTCPStreamConn(server, 16)
+	_, err = serverConn.ReadStream(10 * time.Millisecond)
+	assert(err).IsNotNil()
+
+	// write the stream
+	go func() {
+		_ = newTCPStreamConn(client, 16).WriteStream([]byte("world"))
+	}()
+	assert(serverConn.ReadStream(time.Second)).Equals([]byte("world"), nil)
+	assert(serverConn.Close()).IsNil()
+	assert(serverConn.WriteStream([]byte("hello"))).IsNotNil()
+}
+
+func TestTCPClient_dial(t *testing.T) {
+	assert := newAssert(t)
+
+	client := &TCPClient{urlString: "ws://127.0.0.1:18448"}
+	_, err := client.dial(nil, 1024)
+	assert(err.Error()).Equals("tcp: url scheme ws is not supported")
+
+	client = &TCPClient{urlString: "%"}
+	_, err = client.dial(nil, 1024)
+	assert(err).IsNotNil()
+
+	client = &TCPClient{urlString: "tcp://127.0.0.1:18448"}
+	_, err = client.dial(nil, 1024)
+	assert(err).IsNotNil()
+}
+
+func TestWebSocketServer_ServeTCP(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("whoAmI", true, func(ctx Context) Return {
+			return ctx.OK(ctx.Principal().Name)
+		}))
+	server.SetAuthenticator(AuthenticatorFunc(
+		func(req *http.Request) (*Principal, Error) {
+			if name := req.URL.Query().Get("name"); name != "" {
+				return &Principal{Name: name}, nil
+			}
+			return nil, NewErrorByKind(ErrorKindUnauthenticated, "no name", nil)
+		},
+	))
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:18448")
+	assert(server.ServeTCP(listener).GetMessage()).
+		Equals("WebSocketServer: serve tcp error, it is not opened")
+
+	assert(server.Open()).IsNil()
+	serveCH := make(chan Error, 1)
+	go func() {
+		serveCH <- server.ListenAndServeTCP("127.0.0.1", 18448)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client := NewTCPClient("tcp://127.0.0.1:18448?name=tom", nil)
+	for i := 0; i < 3; i++ {
+		assert(client.SendMessage("$.user:whoAmI")).Equals("tom", nil)
+	}
+	assert(client.Close()).IsNil()
+
+	// the handshake is rejected by the authenticator
+	client = NewTCPClient("tcp://127.0.0.1:18448", nil)
+	atomic.StoreInt64(&client.msgTimeoutNS, int64(500*time.Millisecond))
+	_, err := client.SendMessage("$.user:whoAmI")
+	assert(err.GetMessage()).Equals("timeout")
+	assert(client.Close()).IsNil()
+
+	// the rejected connection gets the error before it is closed
+	conn, _ := net.Dial("tcp", "127.0.0.1:18448")
+	rawConn := newTCPStreamConn(conn, 1024)
+	assert(rawConn.WriteStream([]byte("conn="))).IsNil()
+	message, e := rawConn.ReadStream(time.Second)
+	assert(e).IsNil()
+	stream := newStream()
+	stream.SetWritePos(0)
+	stream.PutBytes(message)
+	assert(stream.GetClientCallbackID()).Equals(uint32(0))
+	assert(parseTestReturnStream(stream)).
+		Equals(nil, NewErrorByKind(ErrorKindUnauthenticated, "no name", nil))
+	_, e = rawConn.ReadStream(time.Second)
+	assert(e).Equals(io.EOF)
+	assert(rawConn.Close()).IsNil()
+
+	// the port is in use
+	assert(server.ListenAndServeTCP("127.0.0.1", 18448)).IsNotNil()
+
+	assert(server.Close()).IsNil()
+	assert(<-serveCH).IsNil()
+}
+
+type testTemporaryError struct{}
+
+func (p testTemporaryError) Error() string   { return "too many open files" }
+func (p testTemporaryError) Timeout() bool   { return false }
+func (p testTemporaryError) Temporary() bool { return true }
+
+// testAcceptErrorListener returns the errors before accepting the connections
+type testAcceptErrorListener struct {
+	net.Listener
+	errors []error
+}
+
+func (p *testAcceptErrorListener) Accept() (net.Conn, error) {
+	if len(p.errors) > 0 {
+		err := p.errors[0]
+		p.errors = p.errors[1:]
+		return nil, err
+	}
+	return p.Listener.Accept()
+}
+
+func TestWebSocketServer_ServeTCP_acceptError(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}))
+	assert(server.Open()).IsNil()
+
+	// the temporary errors are retried
+	listener, _ := net.Listen("tcp", "127.0.0.1:18451")
+	serveCH := make(chan Error, 1)
+	go func() {
+		serveCH <- server.ServeTCP(&testAcceptErrorListener{
+			Listener: listener,
+			errors:   []error{testTemporaryError{}, testTemporaryError{}},
+		})
+	}()
+	client := NewTCPClient("tcp://127.0.0.1:18451", nil)
+	assert(client.SendMessage("$.user:sayHello", "world")).
+		Equals("hello world", nil)
+	assert(client.Close()).IsNil()
+
+	// the other errors stop serving
+	listener, _ = net.Listen("tcp", "127.0.0.1:18452")
+	defer listener.Close()
+	assert(server.ServeTCP(&testAcceptErrorListener{
+		Listener: listener,
+		errors:   []error{io.ErrClosedPipe},
+	})).Equals(NewErrorBySystemError(io.ErrClosedPipe))
+
+	assert(server.Close()).IsNil()
+	assert(<-serveCH).IsNil()
+}
+
+func TestWebSocketServer_ServeTCP_TLS(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-tcp")
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(dir, "server", "localhost")
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("isTLS", true, func(ctx Context) Return {
+			return ctx.OK(ctx.ConnInfo().TLS != nil)
+		}))
+	assert(server.SetTLSCertFiles(certFile, keyFile)).IsNil()
+	assert(server.Open()).IsNil()
+	go func() {
+		_ = server.ListenAndServeTCP("127.0.0.1", 18449)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	config, _ := NewClientTLSConfig("localhost", certFile)
+	client := NewTCPClient("tcp://127.0.0.1:18449", config)
+	assert(client.SendMessage("$.user:isTLS")).Equals(true, nil)
+	assert(client.Close()).IsNil()
+
+	// the plain TCP client can not handshake
+	client = NewTCPClient("tcp://127.0.0.1:18449", nil)
+	atomic.StoreInt64(&client.msgTimeoutNS, int64(500*time.Millisecond))
+	_, err := client.SendMessage("$.user:isTLS")
+	assert(err.GetMessage()).Equals("timeout")
+	assert(client.Close()).IsNil()
+
+	assert(server.Close()).IsNil()
+}
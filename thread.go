@@ -4,10 +4,26 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
 
+const (
+	rpcTimeoutRunning  = int32(0)
+	rpcTimeoutExpired  = int32(1)
+	rpcTimeoutFinished = int32(2)
+)
+
+// rpcThreadTimeout is the deadline of the running echo, the one who changes
+// the state from running owns the stream. if the deadline passes first, the
+// stream is responded with the Timeout error and the late result is dropped
+type rpcThreadTimeout struct {
+	state  int32
+	timer  *time.Timer
+	stream *rpcStream
+}
+
 type rpcThread struct {
 	threadPool     *rpcThreadPool
 	isRunning      bool
@@ -17,7 +33,10 @@ type rpcThread struct {
 	execDepth      uint64
 	execEchoNode   *rpcEchoNode
 	execArgs       []reflect.Value
+	execBulkheads  []*rpcBulkhead
 	execSuccessful bool
+	execRejected   bool
+	execTimeout    *rpcThreadTimeout
 	from           string
 	closeCH        chan bool
 	rpcAutoLock
@@ -33,7 +52,10 @@ func newThread(threadPool *rpcThreadPool) *rpcThread {
 		execDepth:      0,
 		execEchoNode:   nil,
 		execArgs:       make([]reflect.Value, 0, 16),
+		execBulkheads:  make([]*rpcBulkhead, 0, 8),
 		execSuccessful: false,
+		execRejected:   false,
+		execTimeout:    nil,
 		from:           "",
 		closeCH:        make(chan bool),
 	}
@@ -75,12 +97,74 @@ func (p *rpcThread) put(stream *rpcStream) {
 	p.ch <- stream
 }
 
+// countRejected count the call which is rejected before the handler runs,
+// it is not counted as a failed call
+func (p *rpcThread) countRejected() {
+	p.execRejected = true
+	p.execEchoNode.indicator.CountRejected()
+}
+
+// startTimeout respond the Timeout error to the caller when the deadline of
+// the policy passes, it is called before the handler runs
+func (p *rpcThread) startTimeout(policy *rpcServicePolicy, path string) {
+	processor := p.threadPool.processor
+	debug := p.execEchoNode.debugString
+	timeout := &rpcThreadTimeout{
+		state:  rpcTimeoutRunning,
+		stream: newStream(),
+	}
+	copy(timeout.stream.GetHeader(), p.inStream.GetHeader())
+	timeout.timer = time.AfterFunc(policy.timeout, func() {
+		if atomic.CompareAndSwapInt32(
+			&timeout.state,
+			rpcTimeoutRunning,
+			rpcTimeoutExpired,
+		) {
+			err := policy.getTimeoutError(path)
+			writeStreamError(
+				timeout.stream,
+				err.GetMessage(),
+				debug,
+				err.GetKind(),
+				err.GetDetails(),
+			)
+			if processor.callback != nil {
+				processor.callback(timeout.stream, false)
+			} else {
+				timeout.stream.Release()
+			}
+		}
+	})
+	p.execTimeout = timeout
+}
+
+// stopTimeout stop the deadline of the echo, it returns true if the deadline
+// has passed, and the caller has got the Timeout error
+func (p *rpcThread) stopTimeout() bool {
+	timeout := p.execTimeout
+	if timeout == nil {
+		return false
+	}
+	p.execTimeout = nil
+	if atomic.CompareAndSwapInt32(
+		&timeout.state,
+		rpcTimeoutRunning,
+		rpcTimeoutFinished,
+	) {
+		timeout.timer.Stop()
+		timeout.stream.Release()
+		return false
+	}
+	return true
+}
+
 func (p *rpcThread) eval(inStream *rpcStream) *rpcReturn {
 	processor := p.threadPool.processor
 	timeStart := timeNowNS()
 	// create context
 	p.inStream = inStream
 	p.execSuccessful = false
+	p.execRejected = false
 	ctx := &rpcContext{thread: unsafe.Pointer(p)}
 
 	defer func() {
@@ -94,11 +178,13 @@ func (p *rpcThread) eval(inStream *rpcStream) *rpcReturn {
 				getStackString(1),
 			)
 		}
-		if p.execEchoNode != nil {
+		p.releaseBulkheads()
+		isTimeout := p.stopTimeout()
+		if p.execEchoNode != nil && !p.execRejected {
 			p.execEchoNode.indicator.Count(
 				time.Duration(timeNowNS()-timeStart),
 				p.from,
-				p.execSuccessful,
+				p.execSuccessful && !isTimeout,
 			)
 		}
 		ctx.stop()
@@ -109,7 +195,10 @@ func (p *rpcThread) eval(inStream *rpcStream) *rpcReturn {
 		p.execDepth = 0
 		p.execEchoNode = nil
 		p.execArgs = p.execArgs[:0]
-		if processor.callback != nil {
+		if isTimeout {
+			// the caller has got the Timeout error
+			retStream.Release()
+		} else if processor.callback != nil {
 			processor.callback(retStream, p.execSuccessful)
 		}
 		p.threadPool.freeThread(p)
@@ -123,11 +212,13 @@ func (p *rpcThread) eval(inStream *rpcStream) *rpcReturn {
 	if !ok {
 		return ctx.writeError("rpc data format error", "")
 	}
-	if p.execEchoNode, ok = processor.echosMap[echoPath]; !ok {
-		return ctx.writeError(
-			fmt.Sprintf("rpc-server: echo path %s is not mounted", echoPath),
-			"",
-		)
+	if p.execEchoNode, ok = processor.getEchoNode(echoPath); !ok {
+		if p.execEchoNode, ok = processor.getFallbackNode(echoPath); !ok {
+			return ctx.writeError(
+				fmt.Sprintf("rpc-server: echo path %s is not mounted", echoPath),
+				"",
+			)
+		}
 	}
 
 	// read depth
@@ -147,11 +238,75 @@ func (p *rpcThread) eval(inStream *rpcStream) *rpcReturn {
 		return ctx.writeError("rpc data format error", "")
 	}
 
+	// check the echo status
+	if err := p.execEchoNode.checkStatus(processor.logger, p.from); err != nil {
+		return ctx.Error(err)
+	}
+
+	// check the roles of the caller
+	if len(p.execEchoNode.requiredRoles) > 0 {
+		err := p.execEchoNode.checkAuthorization(ctx.Principal())
+		if err != nil {
+			p.countRejected()
+			return ctx.Error(err)
+		}
+	}
+
+	// check the policies of the service
+	if policy := p.execEchoNode.serviceNode.policy; policy != nil {
+		path := p.execEchoNode.path
+		if p.execEchoNode.isFallback {
+			// echoPath is unsafe string, copy it for the policies
+			path = string([]byte(echoPath))
+		}
+		if err := policy.check(ctx, path); err != nil {
+			p.countRejected()
+			return ctx.Error(err)
+		}
+		if err := policy.intercept(ctx, path); err != nil {
+			return ctx.Error(err)
+		}
+		if policy.timeout > 0 {
+			p.startTimeout(policy, path)
+		}
+	}
+
+	// check the rate limit of the echo
+	if limiter := p.execEchoNode.rateLimiter; limiter != nil {
+		if ok, retryAfter := limiter.allow(timeNowNS()); !ok {
+			p.countRejected()
+			return ctx.Error(newRateLimitedError(
+				"echo "+p.execEchoNode.path,
+				p.execEchoNode.path,
+				retryAfter,
+			))
+		}
+	}
+
+	// take the slots of the concurrency limits
+	if err := p.acquireBulkheads(p.execEchoNode.path); err != nil {
+		return ctx.Error(err)
+	}
+
+	// call the fallback handler
+	if p.execEchoNode.isFallback {
+		return p.evalFallback(ctx, echoPath)
+	}
+
 	// build callArgs
 	argStartPos := inStream.GetReadPos()
 
+	// check the arguments rules
+	if p.execEchoNode.argRules != nil {
+		err := p.execEchoNode.checkArgs(inStream)
+		inStream.SetReadPos(argStartPos)
+		if err != nil {
+			return ctx.Error(err)
+		}
+	}
+
 	if fnCache := p.execEchoNode.cacheFN; fnCache != nil {
-		ok = fnCache(ctx, inStream, p.execEchoNode.echoMeta.handler)
+		ok = fnCache(ctx, inStream, p.execEchoNode.handler)
 	} else {
 		p.execArgs = append(p.execArgs, reflect.ValueOf(ctx))
 		for i := 1; i < len(p.execEchoNode.argTypes); i++ {
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	certReloadCheckInterval = time.Second
+)
+
+// rpcCertReloader load the certificate and key files, and reload them when
+// the files are changed. it is used as the GetCertificate of tls.Config
+type rpcCertReloader struct {
+	certFile  string
+	keyFile   string
+	cert      *tls.Certificate
+	modNS     int64
+	checkedNS int64
+	logger    *Logger
+	sync.Mutex
+}
+
+func newCertReloader(
+	certFile string,
+	keyFile string,
+	logger *Logger,
+) (*rpcCertReloader, Error) {
+	ret := &rpcCertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if err := ret.reload(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (p *rpcCertReloader) getModNS() int64 {
+	ret := int64(0)
+	for _, file := range []string{p.certFile, p.keyFile} {
+		if info, err := os.Stat(file); err == nil &&
+			info.ModTime().UnixNano() > ret {
+			ret = info.ModTime().UnixNano()
+		}
+	}
+	return ret
+}
+
+// reload load the certificate and key files
+func (p *rpcCertReloader) reload() Error {
+	modNS := p.getModNS()
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return NewErrorBySystemError(err)
+	}
+
+	p.Lock()
+	p.cert = &cert
+	p.modNS = modNS
+	p.checkedNS = timeNowNS()
+	p.Unlock()
+	return nil
+}
+
+// getCertificate get the certificate, the files are checked at most once
+// per second, and reloaded if they are changed
+func (p *rpcCertReloader) getCertificate(
+	_ *tls.ClientHelloInfo,
+) (*tls.Certificate, error) {
+	nowNS := timeNowNS()
+	p.Lock()
+	needCheck := nowNS-p.checkedNS >= int64(certReloadCheckInterval)
+	if needCheck {
+		p.checkedNS = nowNS
+	}
+	modNS := p.modNS
+	p.Unlock()
+
+	if needCheck && p.getModNS() != modNS {
+		if err := p.reload(); err != nil {
+			// keep using the old certificate
+			if p.logger != nil {
+				p.logger.Errorf(
+					"WebSocketServer: reload certificate error: %s",
+					err.GetMessage(),
+				)
+			}
+		} else if p.logger != nil {
+			p.logger.Infof(
+				"WebSocketServer: certificate %s is reloaded",
+				p.certFile,
+			)
+		}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	return p.cert, nil
+}
+
+// SetTLSCertFiles make the WebSocketServer serve wss:// by the certificate
+// and key files, the files are reloaded when they are changed. it must be
+// called before the server is started
+func (p *WebSocketServer) SetTLSCertFiles(certFile string, keyFile string) Error {
+	reloader, err := newCertReloader(certFile, keyFile, p.logger)
+	if err != nil {
+		return err
+	}
+	p.SetTLSConfig(&tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	})
+	return nil
+}
+
+// SetTLSConfig make the WebSocketServer serve wss:// by tlsConfig, nil
+// serves ws://. it must be called before the server is started
+func (p *WebSocketServer) SetTLSConfig(tlsConfig *tls.Config) {
+	p.Lock()
+	p.tlsConfig = tlsConfig
+	p.Unlock()
+}
+
+func (p *WebSocketServer) getTLSConfig() *tls.Config {
+	p.Lock()
+	defer p.Unlock()
+	return p.tlsConfig
+}
+
+// NewClientTLSConfig create the tls.Config of WebSocketClient, which trusts
+// the root CAs in the PEM files and verifies the server name. if no root CA
+// file is given, the system root CAs are used. if serverName is "", the host
+// of the url is verified
+func NewClientTLSConfig(
+	serverName string,
+	rootCAFiles ...string,
+) (*tls.Config, Error) {
+	ret := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if len(rootCAFiles) > 0 {
+		ret.RootCAs = x509.NewCertPool()
+		for _, file := range rootCAFiles {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, NewErrorBySystemError(err)
+			}
+			if !ret.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, NewError(
+					fmt.Sprintf("tls: root CA file %s is illegal", file),
+				)
+			}
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,167 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// writeTestCert create a self-signed certificate of the host, and write the
+// PEM files to dir
+func writeTestCert(dir string, name string, host string) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{host},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := path.Join(dir, name+".crt")
+	keyFile := path.Join(dir, name+".key")
+	_ = ioutil.WriteFile(
+		certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		0600,
+	)
+	_ = ioutil.WriteFile(
+		keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		0600,
+	)
+	return certFile, keyFile
+}
+
+func TestRpcCertReloader(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-tls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(dir, "server", "localhost")
+
+	_, err := newCertReloader(path.Join(dir, "none.crt"), keyFile, nil)
+	assert(err).IsNotNil()
+
+	reloader, err := newCertReloader(certFile, keyFile, NewLogger())
+	assert(err).IsNil()
+	cert1, _ := reloader.getCertificate(nil)
+	assert(cert1).IsNotNil()
+
+	// the files are not changed
+	reloader.checkedNS = 0
+	cert2, _ := reloader.getCertificate(nil)
+	assert(cert2 == cert1).IsTrue()
+
+	// the files are changed, but the check interval is not reached
+	writeTestCert(dir, "server", "localhost")
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	cert3, _ := reloader.getCertificate(nil)
+	assert(cert3 == cert1).IsTrue()
+
+	// the files are reloaded
+	reloader.checkedNS = 0
+	cert4, _ := reloader.getCertificate(nil)
+	assert(cert4 == cert1).IsFalse()
+
+	// the broken files keep the old certificate
+	_ = ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	future = future.Add(time.Minute)
+	_ = os.Chtimes(keyFile, future, future)
+	reloader.checkedNS = 0
+	cert5, _ := reloader.getCertificate(nil)
+	assert(cert5 == cert4).IsTrue()
+}
+
+func TestNewClientTLSConfig(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-tls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(dir, "server", "localhost")
+
+	config, err := NewClientTLSConfig("localhost")
+	assert(err).IsNil()
+	assert(config.ServerName).Equals("localhost")
+	assert(config.RootCAs).IsNil()
+
+	config, err = NewClientTLSConfig("", certFile)
+	assert(err).IsNil()
+	assert(config.RootCAs).IsNotNil()
+
+	_, err = NewClientTLSConfig("", path.Join(dir, "none.crt"))
+	assert(err).IsNotNil()
+	_, err = NewClientTLSConfig("", keyFile)
+	assert(err.GetMessage()).Equals(
+		"tls: root CA file " + keyFile + " is illegal",
+	)
+}
+
+func TestWebSocketServer_TLS(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-tls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(dir, "server", "localhost")
+
+	server := NewWebSocketServer(nil)
+	assert(server.getTLSConfig()).IsNil()
+	assert(server.SetTLSCertFiles(path.Join(dir, "none.crt"), keyFile)).
+		IsNotNil()
+	assert(server.SetTLSCertFiles(certFile, keyFile)).IsNil()
+	assert(server.getTLSConfig().GetCertificate).IsNotNil()
+
+	logInfoCH := make(chan string, 100)
+	server.GetLogger().Subscribe().Info = func(msg string) {
+		logInfoCH <- msg
+	}
+	server.StartBackground("127.0.0.1", 18443, "/ws")
+	defer server.Close()
+	assert(<-logInfoCH).Contains("start at wss://127.0.0.1:18443/ws")
+
+	// the client trusts the certificate
+	config, _ := NewClientTLSConfig("localhost", certFile)
+	client := &WebSocketClient{tlsConfig: config}
+	conn, _, err := client.getDialer().Dial("wss://127.0.0.1:18443/ws", nil)
+	assert(err).IsNil()
+	_ = conn.Close()
+
+	// the server name is not matched
+	config, _ = NewClientTLSConfig("other.com", certFile)
+	client = &WebSocketClient{tlsConfig: config}
+	_, _, err = client.getDialer().Dial("wss://127.0.0.1:18443/ws", nil)
+	assert(err).IsNotNil()
+
+	// the root CA is unknown
+	config, _ = NewClientTLSConfig("localhost")
+	config.RootCAs = x509.NewCertPool()
+	client = &WebSocketClient{tlsConfig: config}
+	_, _, err = client.getDialer().Dial("wss://127.0.0.1:18443/ws", nil)
+	assert(err).IsNotNil()
+
+	// the client without tls config
+	client = &WebSocketClient{}
+	assert(client.getDialer().TLSClientConfig).IsNil()
+	assert(client.getDialer() == (&WebSocketClient{}).getDialer()).IsTrue()
+}
@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamConnCloseTimeout = time.Second
+)
+
+// rpcStreamConn is the transport connection which moves the rpcStream
+// buffers between the peers. ReadStream returns io.EOF if the peer closes
+// the connection normally
+type rpcStreamConn interface {
+	ReadStream(timeout time.Duration) ([]byte, error)
+	WriteStream(buf []byte) error
+	Close() error
+}
+
+// rpcTextStreamConn is the rpcStreamConn which also moves the text messages
+// like the JSON-RPC 2.0 requests, the text messages are passed to the
+// handler instead of ReadStream
+type rpcTextStreamConn interface {
+	rpcStreamConn
+	SetTextHandler(handler func(text []byte))
+	WriteText(text []byte) error
+}
+
+// wsStreamConn is the rpcStreamConn via websocket, every stream is a binary
+// message, and the text messages are passed to the text handler
+type wsStreamConn struct {
+	conn        *websocket.Conn
+	textHandler func(text []byte)
+	sync.Mutex
+}
+
+func newWSStreamConn(conn *websocket.Conn, readLimit int64) *wsStreamConn {
+	conn.SetReadLimit(readLimit)
+	return &wsStreamConn{conn: conn}
+}
+
+func (p *wsStreamConn) ReadStream(timeout time.Duration) ([]byte, error) {
+	for {
+		// the text messages also keep the connection alive
+		if err := p.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+
+		mt, message, err := p.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+
+		if mt == websocket.TextMessage && p.textHandler != nil {
+			p.textHandler(message)
+			continue
+		}
+		if mt != websocket.BinaryMessage {
+			return nil, errors.New("unknown message type")
+		}
+		return message, nil
+	}
+}
+
+// SetTextHandler set the handler of the text messages, it must be called
+// before ReadStream
+func (p *wsStreamConn) SetTextHandler(handler func(text []byte)) {
+	p.textHandler = handler
+}
+
+func (p *wsStreamConn) WriteStream(buf []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.conn.WriteMessage(websocket.BinaryMessage, buf)
+}
+
+// WriteText write the text message, it is safe with WriteStream
+func (p *wsStreamConn) WriteText(text []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.conn.WriteMessage(websocket.TextMessage, text)
+}
+
+func (p *wsStreamConn) Close() error {
+	// the close message is best effort, the peer may be gone
+	_ = p.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(streamConnCloseTimeout),
+	)
+	return p.conn.Close()
+}
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWsStreamConn(t *testing.T) {
+	assert := newAssert(t)
+
+	upgrader := &websocket.Upgrader{}
+	serverCH := make(chan *wsStreamConn, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			conn, err := upgrader.Upgrade(w, req, nil)
+			if err == nil {
+				serverCH <- newWSStreamConn(conn, 16)
+			}
+		},
+	))
+	defer httpServer.Close()
+	wsURL := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	dial := func() (*websocket.Conn, *wsStreamConn) {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		assert(err).IsNil()
+		return conn, <-serverCH
+	}
+
+	// read and write the streams
+	client, server := dial()
+	clientConn := newWSStreamConn(client, 16)
+	assert(clientConn.WriteStream([]byte("hello"))).IsNil()
+	assert(server.ReadStream(time.Second)).Equals([]byte("hello"), nil)
+	assert(server.WriteStream([]byte("world"))).IsNil()
+	assert(clientConn.ReadStream(time.Second)).Equals([]byte("world"), nil)
+
+	// the normal close is io.EOF
+	assert(clientConn.Close()).IsNil()
+	_, err := server.ReadStream(time.Second)
+	assert(err).Equals(io.EOF)
+	_ = server.Close()
+
+	// the text message is not supported
+	client, server = dial()
+	assert(client.WriteMessage(websocket.TextMessage, []byte("text"))).IsNil()
+	_, err = server.ReadStream(time.Second)
+	assert(err.Error()).Equals("unknown message type")
+	_ = server.Close()
+	_ = client.Close()
+
+	// the text message is passed to the text handler
+	client, server = dial()
+	texts := make([][]byte, 0)
+	server.SetTextHandler(func(text []byte) {
+		texts = append(texts, text)
+		assert(server.WriteText([]byte("pong"))).IsNil()
+	})
+	assert(client.WriteMessage(websocket.TextMessage, []byte("ping"))).IsNil()
+	assert(client.WriteMessage(websocket.BinaryMessage, []byte("b"))).IsNil()
+	assert(server.ReadStream(time.Second)).Equals([]byte("b"), nil)
+	assert(texts).Equals([][]byte{[]byte("ping")})
+	mt, message, err := client.ReadMessage()
+	assert(mt, message, err).Equals(websocket.TextMessage, []byte("pong"), nil)
+	_ = server.Close()
+	_ = client.Close()
+
+	// the read limit and the timeout
+	client, server = dial()
+	_, err = server.ReadStream(10 * time.Millisecond)
+	assert(err).IsNotNil()
+	_ = server.Close()
+	_ = client.Close()
+
+	client, server = dial()
+	assert(client.WriteMessage(
+		websocket.BinaryMessage,
+		[]byte("more than sixteen bytes"),
+	)).IsNil()
+	_, err = server.ReadStream(time.Second)
+	assert(err).IsNotNil()
+	_ = server.Close()
+	_ = client.Close()
+}
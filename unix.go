@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type peerCredKey struct{}
+
+// PeerCred is the credentials of the peer process of the Unix domain socket
+// connection, which is taken by SO_PEERCRED (only supported on linux)
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+func withPeerCred(req *http.Request, cred *PeerCred) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), peerCredKey{}, cred))
+}
+
+func getRequestPeerCred(req *http.Request) *PeerCred {
+	cred, _ := req.Context().Value(peerCredKey{}).(*PeerCred)
+	return cred
+}
+
+// newPrincipalByPeerCred map the peer credentials to the principal, the
+// principal name is the uid
+func newPrincipalByPeerCred(cred *PeerCred) *Principal {
+	return &Principal{
+		Name:  strconv.FormatUint(uint64(cred.UID), 10),
+		Roles: make([]string, 0),
+		Attributes: map[string]string{
+			"uid": strconv.FormatUint(uint64(cred.UID), 10),
+			"gid": strconv.FormatUint(uint64(cred.GID), 10),
+			"pid": strconv.FormatInt(int64(cred.PID), 10),
+		},
+	}
+}
+
+// ListenAndServeUnix listen on the Unix domain socket file and serve the
+// connections like ServeTCP. the socket file is created with perm, so that
+// only the permitted users can connect. the stale socket file is removed,
+// and the socket file is removed when the server is closed. on linux, the
+// peer credentials are the connection identity, see ConnInfo.PeerCred
+func (p *WebSocketServer) ListenAndServeUnix(
+	path string,
+	perm os.FileMode,
+) Error {
+	if err := removeStaleUnixSocket(path); err != nil {
+		return err
+	}
+
+	listener, err := listenUnix(path, perm)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Infof("WebSocketServer: start at unix://%s", path)
+	return p.ServeTCP(listener)
+}
+
+// unixListener is the listener of the socket file which is moved to path,
+// the socket file is removed when it is closed
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (p *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: p.path, Net: "unix"}
+}
+
+func (p *unixListener) Close() error {
+	err := p.UnixListener.Close()
+	if removeErr := os.Remove(p.path); err == nil && !os.IsNotExist(removeErr) {
+		err = removeErr
+	}
+	return err
+}
+
+// listenUnix listen on the socket file with perm. the socket file is created
+// in a private directory beside path, and moved to path after the chmod, so
+// it never has the permissions of the umask
+func listenUnix(path string, perm os.FileMode) (net.Listener, Error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".rpc-unix-")
+	if err != nil {
+		return nil, NewErrorBySystemError(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	tmpPath := filepath.Join(dir, "rpc.sock")
+	listener, err := net.ListenUnix(
+		"unix",
+		&net.UnixAddr{Name: tmpPath, Net: "unix"},
+	)
+	if err != nil {
+		return nil, NewErrorBySystemError(err)
+	}
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		_ = listener.Close()
+		return nil, NewErrorBySystemError(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = listener.Close()
+		return nil, NewErrorBySystemError(err)
+	}
+	return &unixListener{UnixListener: listener, path: path}, nil
+}
+
+// removeStaleUnixSocket remove the socket file which is not listened
+func removeStaleUnixSocket(path string) Error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return NewErrorBySystemError(err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return NewError(fmt.Sprintf("unix: %s is not a socket file", path))
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return NewError(fmt.Sprintf("unix: %s is in use", path))
+	}
+	return NewErrorBySystemError(os.Remove(path))
+}
+
+// PeerCred get the peer credentials of the caller connection, it returns
+// nil if the connection is not a Unix domain socket
+func (p *rpcContext) PeerCred() *PeerCred {
+	if info := p.ConnInfo(); info != nil {
+		return info.PeerCred
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewPrincipalByPeerCred(t *testing.T) {
+	assert := newAssert(t)
+
+	principal := newPrincipalByPeerCred(&PeerCred{PID: 3, UID: 1000, GID: 100})
+	assert(principal.Name).Equals("1000")
+	assert(principal.Roles).Equals([]string{})
+	assert(principal.Attributes).Equals(map[string]string{
+		"uid": "1000",
+		"gid": "100",
+		"pid": "3",
+	})
+}
+
+func TestRemoveStaleUnixSocket(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-unix")
+	defer os.RemoveAll(dir)
+	sockFile := path.Join(dir, "rpc.sock")
+
+	// the file does not exist
+	assert(removeStaleUnixSocket(sockFile)).IsNil()
+
+	// the file is not a socket
+	_ = ioutil.WriteFile(sockFile, []byte("file"), 0600)
+	assert(removeStaleUnixSocket(sockFile).GetMessage()).
+		Equals("unix: " + sockFile + " is not a socket file")
+	_ = os.Remove(sockFile)
+
+	// the socket is in use
+	listener, _ := net.Listen("unix", sockFile)
+	assert(removeStaleUnixSocket(sockFile).GetMessage()).
+		Equals("unix: " + sockFile + " is in use")
+
+	// the socket is stale
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = listener.Close()
+	_, err := os.Lstat(sockFile)
+	assert(err).IsNil()
+	assert(removeStaleUnixSocket(sockFile)).IsNil()
+	_, err = os.Lstat(sockFile)
+	assert(os.IsNotExist(err)).IsTrue()
+}
+
+func TestListenUnix(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-unix")
+	defer os.RemoveAll(dir)
+	sockFile := path.Join(dir, "rpc.sock")
+
+	listener, err := listenUnix(sockFile, 0600)
+	assert(err).IsNil()
+	assert(listener.Addr().String()).Equals(sockFile)
+	info, _ := os.Lstat(sockFile)
+	assert(info.Mode()&os.ModeSocket != 0).IsTrue()
+	assert(info.Mode().Perm()).Equals(os.FileMode(0600))
+
+	// the private directory is removed
+	files, _ := ioutil.ReadDir(dir)
+	assert(len(files)).Equals(1)
+
+	// the socket file is removed when the listener is closed
+	assert(listener.Close()).IsNil()
+	_, osErr := os.Lstat(sockFile)
+	assert(os.IsNotExist(osErr)).IsTrue()
+
+	// the directory does not exist
+	_, err = listenUnix(path.Join(dir, "none", "rpc.sock"), 0600)
+	assert(err).IsNotNil()
+}
+
+func TestWebSocketServer_ListenAndServeUnix(t *testing.T) {
+	assert := newAssert(t)
+
+	dir, _ := ioutil.TempDir("", "rpc-unix")
+	defer os.RemoveAll(dir)
+	sockFile := path.Join(dir, "rpc.sock")
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("whoAmI", true, func(ctx Context) Return {
+			if cred := ctx.PeerCred(); cred != nil {
+				return ctx.OK(Array{
+					int64(cred.UID),
+					int64(cred.PID),
+					ctx.Principal().Name,
+				})
+			}
+			return ctx.OK(nil)
+		}))
+	assert(server.Open()).IsNil()
+	serveCH := make(chan Error, 1)
+	go func() {
+		serveCH <- server.ListenAndServeUnix(sockFile, 0600)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the socket file permission
+	info, err := os.Lstat(sockFile)
+	assert(err).IsNil()
+	assert(info.Mode().Perm()).Equals(os.FileMode(0600))
+
+	// the socket is in use
+	assert(server.ListenAndServeUnix(sockFile, 0600).GetMessage()).
+		Equals("unix: " + sockFile + " is in use")
+
+	client := NewTCPClient("unix://"+sockFile, nil)
+	ret, rpcErr := client.SendMessage("$.user:whoAmI")
+	assert(rpcErr).IsNil()
+	if runtime.GOOS == "linux" {
+		assert(ret).Equals(Array{
+			int64(os.Getuid()),
+			int64(os.Getpid()),
+			strconv.Itoa(os.Getuid()),
+		})
+	} else {
+		assert(ret).IsNil()
+	}
+	assert(client.Close()).IsNil()
+
+	// the socket file is removed when the server is closed
+	assert(server.Close()).IsNil()
+	assert(<-serveCH).IsNil()
+	_, err = os.Lstat(sockFile)
+	assert(os.IsNotExist(err)).IsTrue()
+}
@@ -413,6 +413,36 @@ func isContains(left interface{}, right interface{}) bool {
 	return false
 }
 
+// getEditDistance get the levenshtein distance between s1 and s2
+func getEditDistance(s1 string, s2 string) int {
+	r1, r2 := []rune(s1), []rune(s2)
+	prev := make([]int, len(r2)+1, len(r2)+1)
+	curr := make([]int, len(r2)+1, len(r2)+1)
+	for j := 0; j <= len(r2); j++ {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(r1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(r2)]
+}
+
 func getArgumentsErrorPosition(fn reflect.Value) int {
 	if fn.Type().NumIn() < 1 {
 		return 0
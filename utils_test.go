@@ -377,6 +377,17 @@ func TestIsUTF8Bytes(t *testing.T) {
 	assert(isUTF8Bytes([]byte{0xFF, 0x80, 0x80, 0x70})).IsFalse()
 }
 
+func TestGetEditDistance(t *testing.T) {
+	assert := newAssert(t)
+	assert(getEditDistance("", "")).Equals(0)
+	assert(getEditDistance("abc", "")).Equals(3)
+	assert(getEditDistance("", "abc")).Equals(3)
+	assert(getEditDistance("abc", "abc")).Equals(0)
+	assert(getEditDistance("kitten", "sitting")).Equals(3)
+	assert(getEditDistance("flaw", "lawn")).Equals(2)
+	assert(getEditDistance("你好", "你")).Equals(1)
+}
+
 func TestGetArgumentsErrorPosition(t *testing.T) {
 	assert := newAssert(t)
 
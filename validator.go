@@ -0,0 +1,336 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ArgRule is a declarative constraint of an echo argument, it is checked by
+// the processor before the echo handler is invoked
+type ArgRule interface {
+	// accept report whether the rule can be applied to the argument type
+	accept(argType reflect.Type) bool
+	// check return "" if the value obeys the rule, otherwise the reason
+	check(value interface{}) string
+	// error return the rule definition error
+	error() string
+	// String describe the rule
+	String() string
+}
+
+type rpcArgRules struct {
+	index uint
+	rules []ArgRule
+}
+
+// ValidateArg add rules to the echo argument at index. The index is the
+// position of the argument in the echo handler, the first argument after
+// ctx is 1
+func ValidateArg(index uint, rules ...ArgRule) EchoOption {
+	return func(echoMeta *rpcEchoMeta) {
+		echoMeta.argRules = append(echoMeta.argRules, rpcArgRules{
+			index: index,
+			rules: rules,
+		})
+	}
+}
+
+type rpcRangeRule struct {
+	min float64
+	max float64
+}
+
+// RuleRange the Int64, Uint64 or Float64 argument must be in [min, max]
+func RuleRange(min float64, max float64) ArgRule {
+	return &rpcRangeRule{min: min, max: max}
+}
+
+func (p *rpcRangeRule) accept(argType reflect.Type) bool {
+	switch argType.Kind() {
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *rpcRangeRule) check(value interface{}) string {
+	v := float64(0)
+	switch value.(type) {
+	case int64:
+		v = float64(value.(int64))
+	case uint64:
+		v = float64(value.(uint64))
+	case float64:
+		v = value.(float64)
+	}
+
+	if v < p.min || v > p.max {
+		return fmt.Sprintf("%v is out of %s", value, p.String())
+	}
+	return ""
+}
+
+func (p *rpcRangeRule) error() string {
+	if p.min > p.max {
+		return fmt.Sprintf("%s min is greater than max", p.String())
+	}
+	return ""
+}
+
+func (p *rpcRangeRule) String() string {
+	return fmt.Sprintf("range[%v, %v]", p.min, p.max)
+}
+
+type rpcLengthRule struct {
+	min int
+	max int
+}
+
+// RuleLength the String or Bytes argument length must be in [min, max],
+// the length of String is counted in unicode characters
+func RuleLength(min int, max int) ArgRule {
+	return &rpcLengthRule{min: min, max: max}
+}
+
+func (p *rpcLengthRule) accept(argType reflect.Type) bool {
+	return argType.Kind() == reflect.String || argType == bytesType
+}
+
+func (p *rpcLengthRule) check(value interface{}) string {
+	length := 0
+	switch value.(type) {
+	case string:
+		length = utf8.RuneCountInString(value.(string))
+	case Bytes:
+		length = len(value.(Bytes))
+	}
+
+	if length < p.min || length > p.max {
+		return fmt.Sprintf("length %d is out of %s", length, p.String())
+	}
+	return ""
+}
+
+func (p *rpcLengthRule) error() string {
+	if p.min < 0 || p.min > p.max {
+		return fmt.Sprintf("%s is illegal", p.String())
+	}
+	return ""
+}
+
+func (p *rpcLengthRule) String() string {
+	return fmt.Sprintf("length[%d, %d]", p.min, p.max)
+}
+
+type rpcRegexRule struct {
+	pattern string
+	regex   *regexp.Regexp
+	err     error
+}
+
+// RuleRegex the String argument must match the regular expression pattern
+func RuleRegex(pattern string) ArgRule {
+	regex, err := regexp.Compile(pattern)
+	return &rpcRegexRule{pattern: pattern, regex: regex, err: err}
+}
+
+func (p *rpcRegexRule) accept(argType reflect.Type) bool {
+	return argType.Kind() == reflect.String
+}
+
+func (p *rpcRegexRule) check(value interface{}) string {
+	if s, ok := value.(string); ok && p.regex.MatchString(s) {
+		return ""
+	}
+	return fmt.Sprintf("%q does not match %s", value, p.String())
+}
+
+func (p *rpcRegexRule) error() string {
+	if p.err != nil {
+		return fmt.Sprintf("%s is illegal: %s", p.String(), p.err.Error())
+	}
+	return ""
+}
+
+func (p *rpcRegexRule) String() string {
+	return fmt.Sprintf("regex(%s)", p.pattern)
+}
+
+type rpcRequiredKeysRule struct {
+	keys []string
+}
+
+// RuleRequiredKeys the Map argument must contain all the keys
+func RuleRequiredKeys(keys ...string) ArgRule {
+	return &rpcRequiredKeysRule{keys: keys}
+}
+
+func (p *rpcRequiredKeysRule) accept(argType reflect.Type) bool {
+	return argType == mapType
+}
+
+func (p *rpcRequiredKeysRule) check(value interface{}) string {
+	m, _ := value.(Map)
+	for _, key := range p.keys {
+		if _, ok := m[key]; !ok {
+			return fmt.Sprintf("key %q is required", key)
+		}
+	}
+	return ""
+}
+
+func (p *rpcRequiredKeysRule) error() string {
+	return ""
+}
+
+func (p *rpcRequiredKeysRule) String() string {
+	return fmt.Sprintf("requiredKeys(%s)", strings.Join(p.keys, ", "))
+}
+
+type rpcMaxItemsRule struct {
+	max int
+}
+
+// RuleMaxItems the Array or Map argument must have at most max items
+func RuleMaxItems(max int) ArgRule {
+	return &rpcMaxItemsRule{max: max}
+}
+
+func (p *rpcMaxItemsRule) accept(argType reflect.Type) bool {
+	return argType == arrayType || argType == mapType
+}
+
+func (p *rpcMaxItemsRule) check(value interface{}) string {
+	length := 0
+	switch value.(type) {
+	case Array:
+		length = len(value.(Array))
+	case Map:
+		length = len(value.(Map))
+	}
+
+	if length > p.max {
+		return fmt.Sprintf("%d items is more than %s", length, p.String())
+	}
+	return ""
+}
+
+func (p *rpcMaxItemsRule) error() string {
+	if p.max < 0 {
+		return fmt.Sprintf("%s is illegal", p.String())
+	}
+	return ""
+}
+
+func (p *rpcMaxItemsRule) String() string {
+	return fmt.Sprintf("maxItems(%d)", p.max)
+}
+
+// buildArgRules check the declared rules are suitable for the arguments, and
+// return the rules indexed by the argument position
+func buildArgRules(
+	argRules []rpcArgRules,
+	argTypes []reflect.Type,
+	debug string,
+) ([][]ArgRule, Error) {
+	if len(argRules) == 0 {
+		return nil, nil
+	}
+
+	ret := make([][]ArgRule, len(argTypes), len(argTypes))
+	for _, item := range argRules {
+		if item.index < 1 || item.index >= uint(len(argTypes)) {
+			return nil, NewErrorByDebug(
+				fmt.Sprintf(
+					"Echo rule argument index %d is out of range",
+					item.index,
+				),
+				debug,
+			)
+		}
+
+		argType := argTypes[item.index]
+		for _, rule := range item.rules {
+			if rule == nil {
+				return nil, NewErrorByDebug(
+					"Echo rule is nil",
+					debug,
+				)
+			}
+
+			if errString := rule.error(); errString != "" {
+				return nil, NewErrorByDebug(
+					fmt.Sprintf("Echo rule %s", errString),
+					debug,
+				)
+			}
+
+			if !rule.accept(argType) {
+				return nil, NewErrorByDebug(
+					fmt.Sprintf(
+						"Echo rule %s not supported by %s argument type <%s>",
+						rule.String(),
+						convertOrdinalToString(1+item.index),
+						convertTypeToString(argType),
+					),
+					debug,
+				)
+			}
+
+			ret[item.index] = append(ret[item.index], rule)
+		}
+	}
+
+	return ret, nil
+}
+
+func isValueMatchArgType(value interface{}, argType reflect.Type) bool {
+	if argType == bytesType || argType == arrayType || argType == mapType {
+		return value == nil || reflect.TypeOf(value) == argType
+	}
+
+	return value != nil && reflect.TypeOf(value).Kind() == argType.Kind()
+}
+
+// checkArgs read the arguments from stream and check them by the rules.
+// if the arguments do not match the echo types, it returns nil, and leaves
+// the error to the caller
+func (p *rpcEchoNode) checkArgs(stream *rpcStream) Error {
+	for i := 1; i < len(p.argTypes); i++ {
+		value, ok := stream.Read()
+		if !ok {
+			return nil
+		}
+
+		if !isValueMatchArgType(value, p.argTypes[i]) {
+			return nil
+		}
+
+		for _, rule := range p.argRules[i] {
+			if reason := rule.check(value); reason != "" {
+				argName := p.getArgName(i)
+				return NewErrorByKind(
+					ErrorKindInvalidArgs,
+					fmt.Sprintf(
+						"rpc echo %s %s argument is invalid: %s",
+						p.path,
+						argName,
+						reason,
+					),
+					Map{
+						"path":     p.path,
+						"argument": argName,
+						"index":    int64(i),
+						"rule":     rule.String(),
+						"reason":   reason,
+					},
+				)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateArg(t *testing.T) {
+	assert := newAssert(t)
+
+	echoMeta := &rpcEchoMeta{}
+	ValidateArg(1, RuleRange(0, 1))(echoMeta)
+	ValidateArg(2, RuleLength(0, 1), RuleMaxItems(3))(echoMeta)
+	assert(len(echoMeta.argRules)).Equals(2)
+	assert(echoMeta.argRules[0].index).Equals(uint(1))
+	assert(len(echoMeta.argRules[0].rules)).Equals(1)
+	assert(echoMeta.argRules[1].index).Equals(uint(2))
+	assert(len(echoMeta.argRules[1].rules)).Equals(2)
+}
+
+func TestArgRules(t *testing.T) {
+	assert := newAssert(t)
+
+	// range
+	rangeRule := RuleRange(-1, 10)
+	assert(rangeRule.String()).Equals("range[-1, 10]")
+	assert(rangeRule.error()).Equals("")
+	assert(RuleRange(2, 1).error()).
+		Equals("range[2, 1] min is greater than max")
+	assert(rangeRule.accept(int64Type)).IsTrue()
+	assert(rangeRule.accept(uint64Type)).IsTrue()
+	assert(rangeRule.accept(float64Type)).IsTrue()
+	assert(rangeRule.accept(stringType)).IsFalse()
+	assert(rangeRule.check(int64(-1))).Equals("")
+	assert(rangeRule.check(uint64(10))).Equals("")
+	assert(rangeRule.check(float64(10.5))).Equals("10.5 is out of range[-1, 10]")
+	assert(rangeRule.check(int64(-2))).Equals("-2 is out of range[-1, 10]")
+
+	// length
+	lengthRule := RuleLength(1, 3)
+	assert(lengthRule.String()).Equals("length[1, 3]")
+	assert(lengthRule.error()).Equals("")
+	assert(RuleLength(-1, 3).error()).Equals("length[-1, 3] is illegal")
+	assert(RuleLength(4, 3).error()).Equals("length[4, 3] is illegal")
+	assert(lengthRule.accept(stringType)).IsTrue()
+	assert(lengthRule.accept(bytesType)).IsTrue()
+	assert(lengthRule.accept(arrayType)).IsFalse()
+	assert(lengthRule.check("你好")).Equals("")
+	assert(lengthRule.check(Bytes{1, 2, 3})).Equals("")
+	assert(lengthRule.check("")).Equals("length 0 is out of length[1, 3]")
+	assert(lengthRule.check(Bytes{1, 2, 3, 4})).
+		Equals("length 4 is out of length[1, 3]")
+
+	// regex
+	regexRule := RuleRegex("^[a-z]+$")
+	assert(regexRule.String()).Equals("regex(^[a-z]+$)")
+	assert(regexRule.error()).Equals("")
+	assert(RuleRegex("[").error()).Contains("regex([) is illegal")
+	assert(regexRule.accept(stringType)).IsTrue()
+	assert(regexRule.accept(bytesType)).IsFalse()
+	assert(regexRule.check("abc")).Equals("")
+	assert(regexRule.check("ab1")).Equals("\"ab1\" does not match regex(^[a-z]+$)")
+
+	// required keys
+	keysRule := RuleRequiredKeys("name", "age")
+	assert(keysRule.String()).Equals("requiredKeys(name, age)")
+	assert(keysRule.error()).Equals("")
+	assert(keysRule.accept(mapType)).IsTrue()
+	assert(keysRule.accept(arrayType)).IsFalse()
+	assert(keysRule.check(Map{"name": "", "age": int64(1)})).Equals("")
+	assert(keysRule.check(Map{"name": ""})).Equals("key \"age\" is required")
+	assert(keysRule.check(nil)).Equals("key \"name\" is required")
+
+	// max items
+	maxItemsRule := RuleMaxItems(1)
+	assert(maxItemsRule.String()).Equals("maxItems(1)")
+	assert(maxItemsRule.error()).Equals("")
+	assert(RuleMaxItems(-1).error()).Equals("maxItems(-1) is illegal")
+	assert(maxItemsRule.accept(arrayType)).IsTrue()
+	assert(maxItemsRule.accept(mapType)).IsTrue()
+	assert(maxItemsRule.accept(bytesType)).IsFalse()
+	assert(maxItemsRule.check(Array{1})).Equals("")
+	assert(maxItemsRule.check(Map{"a": 1, "b": 2})).
+		Equals("2 items is more than maxItems(1)")
+}
+
+func TestBuildArgRules(t *testing.T) {
+	assert := newAssert(t)
+	argTypes := []reflect.Type{contextType, int64Type, stringType}
+
+	assert(buildArgRules(nil, argTypes, "DebugMessage")).Equals(nil, nil)
+
+	assert(buildArgRules(
+		[]rpcArgRules{{index: 3, rules: []ArgRule{RuleRange(0, 1)}}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo rule argument index 3 is out of range",
+		"DebugMessage",
+	))
+
+	assert(buildArgRules(
+		[]rpcArgRules{{index: 1, rules: []ArgRule{nil}}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo rule is nil",
+		"DebugMessage",
+	))
+
+	assert(buildArgRules(
+		[]rpcArgRules{{index: 1, rules: []ArgRule{RuleRange(1, 0)}}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo rule range[1, 0] min is greater than max",
+		"DebugMessage",
+	))
+
+	assert(buildArgRules(
+		[]rpcArgRules{{index: 2, rules: []ArgRule{RuleRange(0, 1)}}},
+		argTypes,
+		"DebugMessage",
+	)).Equals(nil, NewErrorByDebug(
+		"Echo rule range[0, 1] not supported by 3rd argument type <rpc.String>",
+		"DebugMessage",
+	))
+
+	rules, err := buildArgRules(
+		[]rpcArgRules{
+			{index: 2, rules: []ArgRule{RuleLength(0, 1)}},
+			{index: 2, rules: []ArgRule{RuleRegex("^a$")}},
+		},
+		argTypes,
+		"DebugMessage",
+	)
+	assert(err).IsNil()
+	assert(len(rules)).Equals(3)
+	assert(len(rules[0])).Equals(0)
+	assert(len(rules[1])).Equals(0)
+	assert(len(rules[2])).Equals(2)
+}
+
+func TestRpcEchoNode_checkArgs(t *testing.T) {
+	getStream := func(args ...interface{}) func(_ *rpcProcessor) *rpcStream {
+		return func(_ *rpcProcessor) *rpcStream {
+			stream := newStream()
+			stream.WriteString("$.user:sayHello")
+			stream.WriteUint64(3)
+			stream.WriteString("#")
+			for _, arg := range args {
+				stream.Write(arg)
+			}
+			return stream
+		}
+	}
+
+	runWithRules := func(
+		args []interface{},
+		onTest func(in *rpcStream, out *rpcStream, success bool),
+	) {
+		retStreamCH := make(chan *rpcStream)
+		retSuccessCH := make(chan bool)
+		processor := newRPCProcessor(
+			nil,
+			16,
+			16,
+			func(stream *rpcStream, success bool) {
+				retStreamCH <- stream
+				retSuccessCH <- success
+			},
+			&TestFuncCache{},
+		)
+		_ = processor.AddService(
+			"user",
+			NewService().Echo(
+				"sayHello",
+				true,
+				func(ctx Context, name string) Return {
+					return ctx.OK("hello " + name)
+				},
+				ValidateArg(1, RuleLength(1, 5)),
+			),
+			"",
+		)
+		inStream := getStream(args...)(processor)
+		processor.Start()
+		processor.PutStream(inStream)
+		onTest(inStream, <-retStreamCH, <-retSuccessCH)
+		processor.Stop()
+	}
+
+	assert := newAssert(t)
+
+	// ok
+	runWithRules([]interface{}{"world"}, func(in *rpcStream, out *rpcStream, success bool) {
+		assert(success).IsTrue()
+		assert(out.ReadBool()).Equals(true, true)
+		assert(out.Read()).Equals("hello world", true)
+	})
+
+	// invalid
+	runWithRules([]interface{}{"big world"}, func(in *rpcStream, out *rpcStream, success bool) {
+		assert(success).IsFalse()
+		assert(out.ReadBool()).Equals(false, true)
+		assert(out.Read()).Equals(
+			"rpc echo $.user:sayHello 2nd argument is invalid: "+
+				"length 9 is out of length[1, 5]",
+			true,
+		)
+		dbgMessage, ok := out.ReadString()
+		assert(ok).IsTrue()
+		assert(dbgMessage).Contains("$.user:sayHello")
+		assert(out.ReadString()).Equals(ErrorKindInvalidArgs, true)
+		assert(out.ReadMap()).Equals(Map{
+			"path":     "$.user:sayHello",
+			"argument": "2nd",
+			"index":    int64(1),
+			"rule":     "length[1, 5]",
+			"reason":   "length 9 is out of length[1, 5]",
+		}, true)
+		assert(out.CanRead()).IsFalse()
+	})
+
+	// type not match is reported by the processor
+	runWithRules([]interface{}{true}, func(in *rpcStream, out *rpcStream, success bool) {
+		assert(success).IsFalse()
+		assert(out.ReadBool()).Equals(false, true)
+		assert(out.Read()).Equals(
+			"rpc echo arguments not match\n"+
+				"Called: $.user:sayHello(rpc.Context, rpc.Bool) rpc.Return\n"+
+				"Required: $.user:sayHello(rpc.Context, rpc.String) rpc.Return",
+			true,
+		)
+	})
+}
@@ -1,5 +1,47 @@
 package rpc
 
+import (
+	"net/url"
+	"testing"
+)
+
+func TestWebSocketClient_SendMessage(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("sayHello", true, func(ctx Context, name string) Return {
+			return ctx.OK("hello " + name)
+		}))
+	server.StartBackground("127.0.0.1", 18446, "/ws")
+	defer server.Close()
+
+	client := NewWebSocketClient("ws://127.0.0.1:18446/ws")
+	for i := 0; i < 3; i++ {
+		assert(client.SendMessage("$.user:sayHello", "world")).
+			Equals("hello world", nil)
+	}
+	_, err := client.SendMessage("$.user:none")
+	assert(err).IsNotNil()
+	assert(client.Close()).IsNil()
+	assert(client.Close()).IsNotNil()
+
+	_, err = client.SendMessage("$.user:sayHello", "world")
+	assert(err.GetMessage()).Equals("client closed")
+}
+
+func TestWebSocketClient_dial(t *testing.T) {
+	assert := newAssert(t)
+
+	client := &WebSocketClient{urlString: "ws://127.0.0.1:18447/ws"}
+	_, err := client.dial(url.Values{"conn": {""}}, 1024)
+	assert(err).IsNotNil()
+
+	client = &WebSocketClient{urlString: "%"}
+	_, err = client.dial(url.Values{}, 1024)
+	assert(err).IsNotNil()
+}
+
 //
 //func TestWebSocketClient_basic(t *testing.T) {
 //	assert := newAssert(t)
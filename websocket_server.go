@@ -1,9 +1,14 @@
 package rpc
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/gorilla/websocket"
+	"io"
 	"math"
+	"net"
 	"net/http"
 	"path"
 	"runtime"
@@ -23,25 +28,102 @@ const (
 	wsServerClosed     = int32(5)
 )
 
-var (
-	wsUpgradeManager = websocket.Upgrader{
-		ReadBufferSize:    1024,
-		WriteBufferSize:   1024,
-		EnableCompression: true,
-	}
-)
-
 type wsServerConn struct {
-	id         uint32
-	wsConn     unsafe.Pointer
-	connIndex  uint32
-	security   string
-	deadlineNS int64
-	streamCH   chan *rpcStream
-	sequence   uint32
+	id          uint32
+	streamConn  rpcStreamConn
+	connIndex   uint32
+	security    string
+	deadlineNS  int64
+	streamCH    chan *rpcStream
+	streamLock  sync.RWMutex
+	sequence    uint32
+	rateLimiter *rpcRateLimiter
+	session     *rpcSession
+	connInfo    unsafe.Pointer
+	principal   unsafe.Pointer
+	owner       unsafe.Pointer
 	sync.Mutex
 }
 
+// getOwner get the connection which the temporary call connection works on
+// behalf of, see callByConn
+func (p *wsServerConn) getOwner() *wsServerConn {
+	return (*wsServerConn)(atomic.LoadPointer(&p.owner))
+}
+
+func (p *wsServerConn) setOwner(owner *wsServerConn) {
+	atomic.StorePointer(&p.owner, unsafe.Pointer(owner))
+}
+
+func (p *wsServerConn) getSession() *rpcSession {
+	if owner := p.getOwner(); owner != nil {
+		return owner.getSession()
+	}
+	return p.session
+}
+
+func (p *wsServerConn) getConnInfo() *ConnInfo {
+	if owner := p.getOwner(); owner != nil {
+		return owner.getConnInfo()
+	}
+	return (*ConnInfo)(atomic.LoadPointer(&p.connInfo))
+}
+
+func (p *wsServerConn) setConnInfo(req *http.Request) {
+	atomic.StorePointer(&p.connInfo, unsafe.Pointer(newConnInfo(p.id, req)))
+}
+
+func (p *wsServerConn) getPrincipal() *Principal {
+	if owner := p.getOwner(); owner != nil {
+		return owner.getPrincipal()
+	}
+	return (*Principal)(atomic.LoadPointer(&p.principal))
+}
+
+func (p *wsServerConn) setPrincipal(principal *Principal) {
+	if owner := p.getOwner(); owner != nil {
+		owner.setPrincipal(principal)
+		return
+	}
+	atomic.StorePointer(&p.principal, unsafe.Pointer(principal))
+}
+
+func (p *wsServerConn) getStreamConn() rpcStreamConn {
+	p.Lock()
+	defer p.Unlock()
+	return p.streamConn
+}
+
+func (p *wsServerConn) setStreamConn(streamConn rpcStreamConn) {
+	p.Lock()
+	p.streamConn = streamConn
+	p.Unlock()
+}
+
+// putStream send the stream to the write routine, it returns false if the
+// connection is freed
+func (p *wsServerConn) putStream(stream *rpcStream) bool {
+	p.streamLock.RLock()
+	defer p.streamLock.RUnlock()
+	if p.streamCH == nil {
+		return false
+	}
+	p.streamCH <- stream
+	return true
+}
+
+func (p *wsServerConn) getSecurity() string {
+	p.Lock()
+	defer p.Unlock()
+	return p.security
+}
+
+func (p *wsServerConn) setSecurity(security string) {
+	p.Lock()
+	p.security = security
+	p.Unlock()
+}
+
 func (p *wsServerConn) getSequence() uint32 {
 	ret := uint32(0)
 	p.Lock()
@@ -63,13 +145,32 @@ func (p *wsServerConn) setSequence(from uint32, to uint32) bool {
 
 // WebSocketServer is implement of INetServer via web socket
 type WebSocketServer struct {
-	processor     *rpcProcessor
-	logger        *Logger
-	status        int32
-	readSizeLimit uint64
-	readTimeoutNS uint64
-	httpServer    *http.Server
-	seed          uint32
+	processor        *rpcProcessor
+	logger           *Logger
+	status           int32
+	readSizeLimit    uint64
+	readTimeoutNS    uint64
+	sessionLimit     uint64
+	httpServer       *http.Server
+	seed             uint32
+	connRateLimit    float64
+	connRateBurst    int
+	ipRateLimit      float64
+	ipRateBurst      int
+	ipLimiters       map[string]*rpcRateLimiter
+	authenticator    Authenticator
+	loginEcho        string
+	upgrader         *websocket.Upgrader
+	allowedOrigins   []string
+	fnCheckOrigin    func(req *http.Request) bool
+	tlsConfig        *tls.Config
+	clientCAs        *x509.CertPool
+	clientAuth       tls.ClientAuthType
+	clientCertMapper ClientCertMapper
+	jsonRPCMapper    JSONRPCMethodMapper
+	listeners        map[net.Listener]bool
+	streamConns      map[rpcStreamConn]bool
+	streamLock       sync.RWMutex
 	sync.Map
 	sync.Mutex
 }
@@ -82,8 +183,22 @@ func NewWebSocketServer(fnCache FuncCache) *WebSocketServer {
 		status:        wsServerClosed,
 		readSizeLimit: 64 * 1024,
 		readTimeoutNS: 60 * uint64(time.Second),
+		sessionLimit:  defaultSessionSizeLimit,
 		httpServer:    nil,
 		seed:          1,
+		ipLimiters:    make(map[string]*rpcRateLimiter),
+		listeners:     make(map[net.Listener]bool),
+		streamConns:   make(map[rpcStreamConn]bool),
+	}
+
+	server.upgrader = &websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		EnableCompression: true,
+		// the origin is checked by checkOrigin before the authentication
+		CheckOrigin: func(req *http.Request) bool {
+			return true
+		},
 	}
 
 	server.processor = newRPCProcessor(
@@ -95,22 +210,31 @@ func NewWebSocketServer(fnCache FuncCache) *WebSocketServer {
 			if serverConn := server.getConnByID(
 				stream.GetClientConnID(),
 			); serverConn != nil {
-				serverConn.streamCH <- stream
+				if !serverConn.putStream(stream) {
+					stream.Release()
+				}
 			}
 		},
 		fnCache,
 	)
+	server.processor.getConn = func(connID uint32) rpcServerConn {
+		if serverConn := server.getConnByID(connID); serverConn != nil {
+			return serverConn
+		}
+		return nil
+	}
 	return server
 }
 
-func (p *WebSocketServer) serverConnWriteRoutine(serverConn *wsServerConn) {
-	ch := serverConn.streamCH
+func (p *WebSocketServer) serverConnWriteRoutine(
+	serverConn *wsServerConn,
+	ch chan *rpcStream,
+) {
 	for stream := <-ch; stream != nil; stream = <-ch {
 		stream.SetClientConnID(0)
-		for serverConn.security != "" {
-			if wsConn := atomic.LoadPointer(&serverConn.wsConn); wsConn != nil {
-				if err := (*websocket.Conn)(wsConn).WriteMessage(
-					websocket.BinaryMessage,
+		for serverConn.getSecurity() != "" {
+			if streamConn := serverConn.getStreamConn(); streamConn != nil {
+				if err := streamConn.WriteStream(
 					stream.GetBufferUnsafe(),
 				); err == nil {
 					// release old stream
@@ -126,15 +250,17 @@ func (p *WebSocketServer) serverConnWriteRoutine(serverConn *wsServerConn) {
 }
 
 func (p *WebSocketServer) registerConn(
-	wsConn *websocket.Conn,
+	streamConn rpcStreamConn,
 	id uint32,
 	security string,
 ) *wsServerConn {
-	// id and security is ok
-	if v, ok := p.Load(id); ok {
+	// id and security is ok, the connection which is forced to unregister
+	// (its security is empty) can not be resumed
+	if v, ok := p.Load(id); ok && security != "" {
 		serverConn, ok := v.(*wsServerConn)
-		if ok && serverConn != nil && serverConn.security == security {
-			atomic.StorePointer(&serverConn.wsConn, unsafe.Pointer(wsConn))
+		if ok && serverConn != nil &&
+			serverConn.getSecurity() == security {
+			serverConn.setStreamConn(streamConn)
 			atomic.StoreInt64(&serverConn.deadlineNS, 0)
 			return serverConn
 		}
@@ -154,13 +280,16 @@ func (p *WebSocketServer) registerConn(
 				id:         id,
 				sequence:   1,
 				security:   getRandString(32),
-				wsConn:     unsafe.Pointer(wsConn),
+				streamConn: streamConn,
 				connIndex:  0,
 				deadlineNS: 0,
 				streamCH:   make(chan *rpcStream, 256),
+				session: newSession(
+					int(atomic.LoadUint64(&p.sessionLimit)),
+				),
 			}
 			p.Store(id, ret)
-			go p.serverConnWriteRoutine(ret)
+			go p.serverConnWriteRoutine(ret, ret.streamCH)
 			break
 		}
 	}
@@ -171,9 +300,9 @@ func (p *WebSocketServer) registerConn(
 func (p *WebSocketServer) unregisterConn(id uint32, force bool) bool {
 	if serverConn, ok := p.Load(id); ok {
 		if force {
-			serverConn.(*wsServerConn).security = ""
+			serverConn.(*wsServerConn).setSecurity("")
 		}
-		atomic.StorePointer(&serverConn.(*wsServerConn).wsConn, nil)
+		serverConn.(*wsServerConn).setStreamConn(nil)
 		atomic.StoreInt64(
 			&serverConn.(*wsServerConn).deadlineNS,
 			timeNowNS()+35*int64(time.Second),
@@ -192,20 +321,32 @@ func (p *WebSocketServer) swipeConn() {
 			if ok && v != nil {
 				deadlineNS := atomic.LoadInt64(&v.deadlineNS)
 				if deadlineNS > 0 && deadlineNS < nowNS {
-					p.Delete(key)
-					atomic.StorePointer(&v.wsConn, nil)
-					v.security = ""
-					close(v.streamCH)
-					v.streamCH = nil
+					p.freeConn(v)
 				}
 			}
 			return true
 		})
+		p.swipeIPRateLimiters(nowNS)
 
 		time.Sleep(500 * time.Millisecond)
 	}
 }
 
+// freeConn remove the connection, and stop its write routine
+func (p *WebSocketServer) freeConn(serverConn *wsServerConn) {
+	p.Delete(serverConn.id)
+	serverConn.setStreamConn(nil)
+	serverConn.setSecurity("")
+	serverConn.streamLock.Lock()
+	close(serverConn.streamCH)
+	serverConn.streamCH = nil
+	serverConn.streamLock.Unlock()
+	serverConn.Lock()
+	serverConn.rateLimiter = nil
+	serverConn.Unlock()
+	serverConn.session.destroy()
+}
+
 func (p *WebSocketServer) getConnByID(id uint32) *wsServerConn {
 	if v, ok := p.Load(id); ok {
 		return v.(*wsServerConn)
@@ -267,117 +408,26 @@ func (p *WebSocketServer) Start(
 	path string,
 ) (ret Error) {
 	if atomic.CompareAndSwapInt32(&p.status, wsServerClosed, wsServerOpening) {
+		tlsConfig := p.getServeTLSConfig()
+		scheme := "ws"
+		if tlsConfig != nil {
+			scheme = "wss"
+		}
 		p.logger.Infof(
 			"WebSocketServer: start at %s",
-			getURLBySchemeHostPortAndPath("ws", host, port, path),
+			getURLBySchemeHostPortAndPath(scheme, host, port, path),
 		)
 		p.processor.Start()
 		serverMux := http.NewServeMux()
-		serverMux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
-			if req != nil && req.Header != nil {
-				req.Header.Del("Origin")
-			}
-
-			connID := uint32(0)
-			connSecurity := ""
-			keys, ok := req.URL.Query()["conn"]
-			if ok && len(keys) == 1 {
-				arr := strings.Split(keys[0], "-")
-				if len(arr) == 2 {
-					if parseID, err := strconv.ParseUint(arr[0], 10, 64); err == nil {
-						connID = uint32(parseID)
-						connSecurity = arr[1]
-					}
-				}
-			}
-
-			wsConn, err := wsUpgradeManager.Upgrade(w, req, nil)
-			if err != nil {
-				p.logger.Errorf("WebSocketServer: %s", err.Error())
-				return
-			}
-
-			serverConn := p.registerConn(wsConn, connID, connSecurity)
-
-			// set conn information
-			connStream := newStream()
-			connStream.SetClientCallbackID(0)
-			connStream.WriteString("#.connection.openInformation")
-			connStream.WriteUint64(uint64(serverConn.id))
-			connStream.WriteString(serverConn.security)
-			connStream.WriteUint64(uint64(serverConn.getSequence()))
-			serverConn.streamCH <- connStream
-
-			wsConn.SetReadLimit(int64(atomic.LoadUint64(&p.readSizeLimit)))
-			p.onOpen(serverConn)
-			defer func() {
-				p.unregisterConn(serverConn.id, false)
-				err := wsConn.Close()
-				if err != nil {
-					p.onError(serverConn, err.Error())
-				}
-				p.onClose(serverConn)
-			}()
-
-			for {
-				nextTimeoutNS := timeNowNS() +
-					int64(atomic.LoadUint64(&p.readTimeoutNS))
-				if err := wsConn.SetReadDeadline(time.Unix(
-					nextTimeoutNS/int64(time.Second),
-					nextTimeoutNS%int64(time.Second),
-				)); err != nil {
-					p.onError(serverConn, err.Error())
-					return
-				}
-
-				mt, message, err := wsConn.ReadMessage()
-				if err != nil {
-					if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-						p.onError(serverConn, err.Error())
-					}
-					return
-				}
-				switch mt {
-				case websocket.BinaryMessage:
-					stream := newStream()
-					stream.SetWritePos(0)
-					stream.PutBytes(message)
-
-					connSequence := stream.GetClientSequence()
-					callbackID := stream.GetClientCallbackID()
-
-					// this is system instructions
-					if callbackID == 0 {
-						// ignore system instructions
-						p.onError(serverConn, "unknown system instruction")
-						return
-					}
-
-					if connSequence > 4000000000 {
-						p.unregisterConn(serverConn.id, true)
-					}
-
-					// this is rpc callback function
-					if serverConn.setSequence(connSequence, callbackID) {
-						stream.SetClientConnID(serverConn.id)
-						p.onStream(serverConn, stream)
-					} else {
-						stream.Release()
-						p.onError(serverConn, "server sequence error")
-						return
-					}
-				default:
-					p.onError(serverConn, "unknown message type")
-					return
-				}
-			}
-		})
+		serverMux.Handle(path, p)
 
 		p.Lock()
 		p.httpServer = &http.Server{
-			Addr:    fmt.Sprintf("%s:%d", host, port),
-			Handler: serverMux,
+			Addr:      fmt.Sprintf("%s:%d", host, port),
+			Handler:   serverMux,
+			TLSConfig: tlsConfig,
 		}
+		httpServer := p.httpServer
 		p.Unlock()
 
 		time.AfterFunc(250*time.Millisecond, func() {
@@ -386,7 +436,12 @@ func (p *WebSocketServer) Start(
 
 		go p.swipeConn()
 
-		ret := p.httpServer.ListenAndServe()
+		ret := error(nil)
+		if tlsConfig != nil {
+			ret = httpServer.ListenAndServeTLS("", "")
+		} else {
+			ret = httpServer.ListenAndServe()
+		}
 		time.Sleep(400 * time.Millisecond)
 
 		p.Lock()
@@ -415,10 +470,229 @@ func (p *WebSocketServer) Start(
 	return NewError("WebSocketServer: has already been started")
 }
 
+// isOpened report whether the WebSocketServer is opened by Open or Start
+func (p *WebSocketServer) isOpened() bool {
+	status := atomic.LoadInt32(&p.status)
+	return status == wsServerOpening || status == wsServerOpened
+}
+
+// ServeHTTP upgrade the request to the websocket connection and serve it,
+// so the WebSocketServer can be mounted to an existing http.ServeMux. the
+// WebSocketServer must be opened by Open (or Start), otherwise it responds
+// 503 Service Unavailable
+func (p *WebSocketServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !p.isOpened() {
+		http.Error(w, "server is not opened", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !p.checkOrigin(req) {
+		http.Error(w, "origin is not allowed", http.StatusForbidden)
+		return
+	}
+
+	principal, ok := p.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	wsConn, err := p.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		p.logger.Errorf("WebSocketServer: %s", err.Error())
+		return
+	}
+
+	p.serveStreamConn(
+		newWSStreamConn(wsConn, int64(atomic.LoadUint64(&p.readSizeLimit))),
+		req,
+		principal,
+	)
+}
+
+// parseConnQuery parse the "conn" query parameter of the reconnection, it is
+// like "<id>-<security>"
+func parseConnQuery(req *http.Request) (uint32, string) {
+	if req.URL == nil {
+		return 0, ""
+	}
+	keys, ok := req.URL.Query()["conn"]
+	if ok && len(keys) == 1 {
+		arr := strings.Split(keys[0], "-")
+		if len(arr) == 2 {
+			if parseID, err := strconv.ParseUint(arr[0], 10, 64); err == nil {
+				return uint32(parseID), arr[1]
+			}
+		}
+	}
+	return 0, ""
+}
+
+// resolvePrincipal get the principal of the request, the principal of the
+// Authenticator goes first, then the client certificate and the peer
+// credentials
+func (p *WebSocketServer) resolvePrincipal(
+	req *http.Request,
+	principal *Principal,
+) *Principal {
+	if principal == nil {
+		principal = p.getClientCertPrincipal(req)
+	}
+	if cred := getRequestPeerCred(req); principal == nil && cred != nil {
+		principal = newPrincipalByPeerCred(cred)
+	}
+	return principal
+}
+
+// serveStreamConn serve the accepted transport connection until it is
+// closed. req is the upgrade request of websocket, or the handshake request
+// of the other transports, and principal is the authenticated principal
+func (p *WebSocketServer) serveStreamConn(
+	streamConn rpcStreamConn,
+	req *http.Request,
+	principal *Principal,
+) {
+	if !p.addStreamConn(streamConn) {
+		_ = streamConn.Close()
+		return
+	}
+	defer p.removeStreamConn(streamConn)
+
+	principal = p.resolvePrincipal(req, principal)
+	connID, connSecurity := parseConnQuery(req)
+	remoteIP := getRemoteIP(req)
+	serverConn := p.registerConn(streamConn, connID, connSecurity)
+	serverConn.setConnInfo(req)
+	if principal != nil {
+		serverConn.setPrincipal(principal)
+	}
+
+	// set conn information
+	connStream := newStream()
+	connStream.SetClientCallbackID(0)
+	connStream.WriteString("#.connection.openInformation")
+	connStream.WriteUint64(uint64(serverConn.id))
+	connStream.WriteString(serverConn.getSecurity())
+	connStream.WriteUint64(uint64(serverConn.getSequence()))
+	serverConn.putStream(connStream)
+
+	// the text messages are the JSON-RPC 2.0 requests, they are served in
+	// order by the worker of the connection. the read loop waits if the
+	// queue is full, and the requests are canceled if the connection closes
+	if textConn, ok := streamConn.(rpcTextStreamConn); ok {
+		textCH := make(chan []byte, jsonRPCTextQueueSize)
+		ctx, cancel := context.WithCancel(context.Background())
+		go p.serveJSONRPCTexts(ctx, textConn, serverConn, remoteIP, textCH)
+		textConn.SetTextHandler(func(text []byte) {
+			textCH <- text
+		})
+		defer func() {
+			cancel()
+			close(textCH)
+		}()
+	}
+
+	p.onOpen(serverConn)
+	defer func() {
+		p.unregisterConn(serverConn.id, false)
+		err := streamConn.Close()
+		if err != nil {
+			p.onError(serverConn, err.Error())
+		}
+		p.onClose(serverConn)
+	}()
+
+	for {
+		message, err := streamConn.ReadStream(
+			time.Duration(atomic.LoadUint64(&p.readTimeoutNS)),
+		)
+		if err != nil {
+			if err != io.EOF {
+				p.onError(serverConn, err.Error())
+			}
+			return
+		}
+
+		stream := newStream()
+		stream.SetWritePos(0)
+		stream.PutBytes(message)
+
+		connSequence := stream.GetClientSequence()
+		callbackID := stream.GetClientCallbackID()
+
+		// this is system instructions
+		if callbackID == 0 {
+			// ignore system instructions
+			p.onError(serverConn, "unknown system instruction")
+			return
+		}
+
+		if connSequence > 4000000000 {
+			p.unregisterConn(serverConn.id, true)
+		}
+
+		// this is rpc callback function
+		if serverConn.setSequence(connSequence, callbackID) {
+			err := p.checkAuthentication(serverConn, stream)
+			if err == nil {
+				err = p.checkRateLimit(serverConn, remoteIP, stream)
+			}
+			if err != nil {
+				p.onError(serverConn, err.GetMessage())
+				writeStreamError(
+					stream,
+					err.GetMessage(),
+					err.GetDebug(),
+					err.GetKind(),
+					err.GetDetails(),
+				)
+				serverConn.putStream(stream)
+			} else {
+				stream.SetClientConnID(serverConn.id)
+				if !p.onStream(serverConn, stream) {
+					return
+				}
+			}
+		} else {
+			stream.Release()
+			p.onError(serverConn, "server sequence error")
+			return
+		}
+	}
+}
+
+// Open make the WebSocketServer start the processor without listening, the
+// connections are served by ServeHTTP which is mounted to an existing http
+// server. Close stops the processor
+func (p *WebSocketServer) Open() Error {
+	if atomic.CompareAndSwapInt32(&p.status, wsServerClosed, wsServerOpening) {
+		p.processor.Start()
+		go p.swipeConn()
+		p.logger.Infof("WebSocketServer: opened")
+		atomic.StoreInt32(&p.status, wsServerOpened)
+		return nil
+	}
+
+	return NewError("WebSocketServer: has already been started")
+}
+
 // Close make the WebSocketServer stop serve
 func (p *WebSocketServer) Close() Error {
 	if atomic.CompareAndSwapInt32(&p.status, wsServerOpened, wsServerClosing) {
-		err := NewErrorBySystemError(p.httpServer.Close())
+		p.Lock()
+		httpServer := p.httpServer
+		p.Unlock()
+		p.closeListeners()
+		p.closeStreamConns()
+
+		// it is opened by Open, there is no http server to close
+		if httpServer == nil {
+			p.processor.Stop()
+			p.logger.Infof("WebSocketServer: stopped")
+			atomic.StoreInt32(&p.status, wsServerClosed)
+			return nil
+		}
+
+		err := NewErrorBySystemError(httpServer.Close())
 		for !atomic.CompareAndSwapInt32(
 			&p.status,
 			wsServerDidClosing,
@@ -445,8 +719,56 @@ func (p *WebSocketServer) onClose(serverConn *wsServerConn) {
 	p.logger.Infof("WebSocketServerConn[%d]: closed", serverConn.id)
 }
 
-func (p *WebSocketServer) onStream(_ *wsServerConn, stream *rpcStream) {
+// onStream put the stream to the processor, the stream is refused (and
+// released) if the server is closing, so that no stream is put after the
+// processor is stopped
+func (p *WebSocketServer) onStream(_ *wsServerConn, stream *rpcStream) bool {
+	p.streamLock.RLock()
+	defer p.streamLock.RUnlock()
+	if !p.isOpened() {
+		stream.Release()
+		return false
+	}
 	p.processor.PutStream(stream)
+	return true
+}
+
+// addStreamConn track the served stream connection, it returns false if the
+// server is closing
+func (p *WebSocketServer) addStreamConn(streamConn rpcStreamConn) bool {
+	p.Lock()
+	defer p.Unlock()
+	if !p.isOpened() {
+		return false
+	}
+	p.streamConns[streamConn] = true
+	return true
+}
+
+func (p *WebSocketServer) removeStreamConn(streamConn rpcStreamConn) {
+	p.Lock()
+	delete(p.streamConns, streamConn)
+	p.Unlock()
+}
+
+// closeStreamConns close the served stream connections, and wait until the
+// streams in putting are put, the later streams are refused by onStream
+func (p *WebSocketServer) closeStreamConns() {
+	p.Lock()
+	streamConns := make([]rpcStreamConn, 0, len(p.streamConns))
+	for streamConn := range p.streamConns {
+		streamConns = append(streamConns, streamConn)
+	}
+	p.Unlock()
+
+	for _, streamConn := range streamConns {
+		if err := streamConn.Close(); err != nil {
+			p.logger.Warnf("WebSocketServer: %s", err.Error())
+		}
+	}
+
+	p.streamLock.Lock()
+	p.streamLock.Unlock()
 }
 
 // GetLogger get WebSocketServer logger
@@ -463,3 +785,128 @@ func (p *WebSocketServer) SetReadSizeLimit(readLimit uint64) {
 func (p *WebSocketServer) SetReadTimeoutMS(readTimeoutMS uint64) {
 	atomic.StoreUint64(&p.readTimeoutNS, readTimeoutMS*uint64(time.Millisecond))
 }
+
+// SetSessionSizeLimit set the max number of keys in the session of every new
+// connection
+func (p *WebSocketServer) SetSessionSizeLimit(sizeLimit uint64) {
+	atomic.StoreUint64(&p.sessionLimit, sizeLimit)
+}
+
+// SetEchoStatus change the status of the echo at runtime, retryAfter is only
+// used by EchoStatusMaintenance
+func (p *WebSocketServer) SetEchoStatus(
+	path string,
+	status EchoStatus,
+	retryAfter time.Duration,
+) Error {
+	return p.processor.setEchoStatus(path, status, retryAfter)
+}
+
+// SetConnRateLimit limit the calls per second of every connection, burst is
+// the max calls at the same time. rate 0 removes the limit
+func (p *WebSocketServer) SetConnRateLimit(rate float64, burst int) {
+	p.Lock()
+	p.connRateLimit = rate
+	p.connRateBurst = burst
+	p.Unlock()
+}
+
+// SetIPRateLimit limit the calls per second of all the connections from the
+// same remote IP, burst is the max calls at the same time. rate 0 removes the
+// limit
+func (p *WebSocketServer) SetIPRateLimit(rate float64, burst int) {
+	p.Lock()
+	p.ipRateLimit = rate
+	p.ipRateBurst = burst
+	p.ipLimiters = make(map[string]*rpcRateLimiter)
+	p.Unlock()
+}
+
+func (p *WebSocketServer) getConnRateLimiter(
+	serverConn *wsServerConn,
+) *rpcRateLimiter {
+	p.Lock()
+	rate, burst := p.connRateLimit, p.connRateBurst
+	p.Unlock()
+
+	serverConn.Lock()
+	defer serverConn.Unlock()
+	if rate <= 0 || burst < 1 {
+		serverConn.rateLimiter = nil
+	} else if serverConn.rateLimiter == nil ||
+		!serverConn.rateLimiter.isSameConfig(rate, burst) {
+		serverConn.rateLimiter = newRateLimiter(rate, burst)
+	}
+	return serverConn.rateLimiter
+}
+
+func (p *WebSocketServer) getIPRateLimiter(ip string) *rpcRateLimiter {
+	p.Lock()
+	defer p.Unlock()
+	if p.ipRateLimit <= 0 || p.ipRateBurst < 1 {
+		return nil
+	}
+	ret, ok := p.ipLimiters[ip]
+	if !ok {
+		ret = newRateLimiter(p.ipRateLimit, p.ipRateBurst)
+		p.ipLimiters[ip] = ret
+	}
+	return ret
+}
+
+// swipeIPRateLimiters remove the idle limiters of the remote IPs, an idle
+// limiter is the same as a new one
+func (p *WebSocketServer) swipeIPRateLimiters(nowNS int64) {
+	p.Lock()
+	defer p.Unlock()
+	for ip, limiter := range p.ipLimiters {
+		if limiter.isIdle(nowNS) {
+			delete(p.ipLimiters, ip)
+		}
+	}
+}
+
+// checkRateLimit check the rate limits of the connection and the remote IP
+// before the stream is put to the processor
+func (p *WebSocketServer) checkRateLimit(
+	serverConn *wsServerConn,
+	ip string,
+	stream *rpcStream,
+) Error {
+	nowNS := timeNowNS()
+	scope := ""
+	retryAfter := time.Duration(0)
+
+	if limiter := p.getConnRateLimiter(serverConn); limiter != nil {
+		if ok, duration := limiter.allow(nowNS); !ok {
+			scope = fmt.Sprintf("connection %d", serverConn.id)
+			retryAfter = duration
+		}
+	}
+
+	if limiter := p.getIPRateLimiter(ip); scope == "" && limiter != nil {
+		if ok, duration := limiter.allow(nowNS); !ok {
+			scope = "ip " + ip
+			retryAfter = duration
+		}
+	}
+
+	if scope == "" {
+		return nil
+	}
+
+	readPos := stream.GetReadPos()
+	echoPath, _ := stream.ReadString()
+	stream.SetReadPos(readPos)
+	return newRateLimitedError(scope, echoPath, retryAfter)
+}
+
+func getRemoteIP(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
@@ -1,5 +1,156 @@
 package rpc
 
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocketServer_checkRateLimit(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	conn1 := &wsServerConn{id: 1}
+	conn2 := &wsServerConn{id: 2}
+	newEchoStream := func() *rpcStream {
+		stream := newStream()
+		stream.WriteString("$.user:sayHello")
+		stream.WriteUint64(3)
+		return stream
+	}
+
+	// no limit
+	for i := 0; i < 10; i++ {
+		assert(server.checkRateLimit(conn1, "1.1.1.1", newEchoStream())).IsNil()
+	}
+	assert(conn1.rateLimiter).IsNil()
+	assert(len(server.ipLimiters)).Equals(0)
+
+	// connection limit
+	server.SetConnRateLimit(0.001, 2)
+	assert(server.checkRateLimit(conn1, "1.1.1.1", newEchoStream())).IsNil()
+	assert(server.checkRateLimit(conn1, "1.1.1.1", newEchoStream())).IsNil()
+	stream := newEchoStream()
+	err := server.checkRateLimit(conn1, "1.1.1.1", stream)
+	assert(err.GetKind()).Equals(ErrorKindRateLimited)
+	assert(err.GetMessage()).Contains(
+		"rpc echo $.user:sayHello is rate limited by connection 1",
+	)
+	assert(err.GetDetails()["scope"]).Equals("connection 1")
+	assert(stream.ReadString()).Equals("$.user:sayHello", true)
+	assert(server.checkRateLimit(conn2, "1.1.1.1", newEchoStream())).IsNil()
+
+	// the limiter is recreated when the config is changed
+	server.SetConnRateLimit(0.001, 3)
+	assert(server.checkRateLimit(conn1, "1.1.1.1", newEchoStream())).IsNil()
+	server.SetConnRateLimit(0, 0)
+	assert(server.checkRateLimit(conn1, "1.1.1.1", newEchoStream())).IsNil()
+	assert(conn1.rateLimiter).IsNil()
+
+	// ip limit
+	server.SetIPRateLimit(0.001, 2)
+	assert(server.checkRateLimit(conn1, "1.1.1.1", newEchoStream())).IsNil()
+	assert(server.checkRateLimit(conn2, "1.1.1.1", newEchoStream())).IsNil()
+	err = server.checkRateLimit(conn2, "1.1.1.1", newEchoStream())
+	assert(err.GetDetails()["scope"]).Equals("ip 1.1.1.1")
+	assert(server.checkRateLimit(conn2, "2.2.2.2", newEchoStream())).IsNil()
+	assert(len(server.ipLimiters)).Equals(2)
+
+	// the idle ip limiters are removed
+	server.swipeIPRateLimiters(timeNowNS())
+	assert(len(server.ipLimiters)).Equals(2)
+	server.swipeIPRateLimiters(timeNowNS() + int64(time.Hour))
+	assert(len(server.ipLimiters)).Equals(0)
+}
+
+func TestWebSocketServer_Session(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	server.SetSessionSizeLimit(2)
+	serverConn := server.registerConn(nil, 0, "")
+	assert(serverConn.getSession().sizeLimit).Equals(2)
+	assert(serverConn.getSession().Set("user", "tom")).IsTrue()
+
+	// the session survives the reconnect
+	assert(server.registerConn(nil, serverConn.id, serverConn.security)).
+		Equals(serverConn)
+	assert(serverConn.getSession().Get("user")).Equals("tom", true)
+	assert(server.processor.getConn(serverConn.id)).Equals(serverConn)
+	assert(server.processor.getConn(serverConn.id + 1)).IsNil()
+
+	// the session of the new connection is empty
+	otherConn := server.registerConn(nil, serverConn.id, "wrong")
+	assert(otherConn == serverConn).IsFalse()
+	assert(otherConn.getSession().Len()).Equals(0)
+}
+
+func TestWebSocketServer_callByConn_canceled(t *testing.T) {
+	assert := newAssert(t)
+
+	releaseCH := make(chan bool)
+	server := NewWebSocketServer(nil)
+	server.AddService("user", NewService().
+		Echo("wait", true, func(ctx Context) Return {
+			<-releaseCH
+			return ctx.OK(true)
+		}))
+	assert(server.Open()).IsNil()
+	defer server.Close()
+
+	owner := server.newRequestConn(
+		httptest.NewRequest("POST", "/", nil),
+		&Principal{Name: "victim", Roles: []string{"admin"}},
+	)
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		20*time.Millisecond,
+	)
+	defer cancel()
+	_, err := server.callByConn(ctx, owner, "127.0.0.1", "$.user:wait", nil)
+	assert(err.GetMessage()).Equals("gateway: request is canceled")
+	callConnID := server.seed
+	close(releaseCH)
+
+	// the connection of the canceled call is freed, it can not be resumed
+	assert(server.getConnByID(callConnID)).IsNil()
+	for _, security := range []string{"", "wrong"} {
+		serverConn := server.registerConn(nil, callConnID, security)
+		assert(serverConn.id == callConnID).IsFalse()
+		assert(serverConn.getOwner()).IsNil()
+		assert(serverConn.getPrincipal()).IsNil()
+	}
+
+	// the connection which is forced to unregister can not be resumed
+	serverConn := server.registerConn(nil, 0, "")
+	server.unregisterConn(serverConn.id, true)
+	assert(server.registerConn(nil, serverConn.id, "") == serverConn).IsFalse()
+}
+
+func TestWsServerConn_setConnInfo(t *testing.T) {
+	assert := newAssert(t)
+
+	serverConn := &wsServerConn{id: 3}
+	assert(serverConn.getConnInfo()).IsNil()
+	serverConn.setConnInfo(&http.Request{RemoteAddr: "1.2.3.4:5678"})
+	assert(serverConn.getConnInfo().ID).Equals(uint32(3))
+	assert(serverConn.getConnInfo().RemoteAddr).Equals("1.2.3.4:5678")
+}
+
+func TestGetRemoteIP(t *testing.T) {
+	assert := newAssert(t)
+
+	assert(getRemoteIP(nil)).Equals("")
+	assert(getRemoteIP(&http.Request{RemoteAddr: "1.2.3.4:5678"})).
+		Equals("1.2.3.4")
+	assert(getRemoteIP(&http.Request{RemoteAddr: "[::1]:5678"})).Equals("::1")
+	assert(getRemoteIP(&http.Request{RemoteAddr: "unix"})).Equals("unix")
+}
+
 //
 //func TestWsServerConn_send(t *testing.T) {
 //	assert := newAssert(t)
@@ -378,3 +529,82 @@ package rpc
 //	b.StopTimer()
 //	_ = client.Close()
 //}
+
+func TestWebSocketServer_ServeHTTP(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	mux := http.NewServeMux()
+	mux.Handle("/rpc", server)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+	wsURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/rpc"
+
+	// the server is not opened
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert(err).IsNotNil()
+	assert(resp.StatusCode).Equals(http.StatusServiceUnavailable)
+
+	assert(server.Open()).IsNil()
+	assert(server.Open().GetMessage()).
+		Equals("WebSocketServer: has already been started")
+	assert(server.Start("127.0.0.1", 18445, "/")).IsNotNil()
+
+	// the websocket is served under the mounted path
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert(err).IsNil()
+	_, message, err := conn.ReadMessage()
+	assert(err).IsNil()
+	stream := newStream()
+	stream.SetWritePos(0)
+	stream.PutBytes(message)
+	assert(stream.ReadString()).Equals("#.connection.openInformation", true)
+	_ = conn.Close()
+
+	// the other handlers are not affected
+	resp, err = http.Get(httpServer.URL + "/health")
+	assert(err).IsNil()
+	assert(resp.StatusCode).Equals(http.StatusOK)
+	_ = resp.Body.Close()
+
+	assert(server.Close()).IsNil()
+	assert(server.Close()).IsNotNil()
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL, nil)
+	assert(err).IsNotNil()
+	assert(resp.StatusCode).Equals(http.StatusServiceUnavailable)
+
+	// it can be opened again
+	assert(server.Open()).IsNil()
+	assert(server.Close()).IsNil()
+}
+
+func TestWebSocketServer_closeStreamConns(t *testing.T) {
+	assert := newAssert(t)
+
+	server := NewWebSocketServer(nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	assert(server.Open()).IsNil()
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(httpServer.URL, "http"),
+		nil,
+	)
+	assert(err).IsNil()
+	defer conn.Close()
+	_, _, err = conn.ReadMessage()
+	assert(err).IsNil()
+
+	// the served connections are closed by Close
+	assert(server.Close()).IsNil()
+	assert(conn.SetReadDeadline(time.Now().Add(time.Second))).IsNil()
+	_, _, err = conn.ReadMessage()
+	assert(websocket.IsCloseError(err, websocket.CloseNormalClosure)).IsTrue()
+
+	// the streams are refused after closing
+	assert(server.onStream(nil, newStream())).IsFalse()
+	assert(server.addStreamConn(&gatewayStreamConn{})).IsFalse()
+}